@@ -15,6 +15,9 @@ require (
 	github.com/lmittmann/tint v1.0.5
 	github.com/qustavo/sqlhooks/v2 v2.1.0
 	github.com/spf13/viper v1.19.0
+	golang.org/x/crypto v0.27.0
+	golang.org/x/net v0.29.0
+	golang.org/x/sync v0.8.0
 )
 
 require (
@@ -46,7 +49,6 @@ require (
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/exp v0.0.0-20240909161429-701f63a606c0 // indirect
-	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/text v0.18.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
@@ -6,6 +6,7 @@ import (
 
 func (s *Server) serveBackgroundJobs(ctx context.Context) {
 	encodeURLChan := s.urlWasEncodedHandler(ctx)
+	reverifyLinkHostsChan := s.reverifyLinkHostsJob(ctx)
 
 	go func() {
 		for {
@@ -20,13 +21,21 @@ func (s *Server) serveBackgroundJobs(ctx context.Context) {
 				return
 			case err, ok := <-encodeURLChan:
 				if !ok {
-					s.logger.ErrorContext(ctx, "error channel is closes for worker", err)
+					s.logger.ErrorContext(ctx, "error channel is closes for worker", "err", err)
 
 					return
 				}
 				if err != nil {
-					s.logger.ErrorContext(ctx, "error url was encoded worker", err)
+					s.logger.ErrorContext(ctx, "error url was encoded worker", "err", err)
 				}
+			case err, ok := <-reverifyLinkHostsChan:
+				if !ok {
+					// Closes only on shutdown, the encode worker decides when to stop.
+					reverifyLinkHostsChan = nil
+
+					continue
+				}
+				s.logger.ErrorContext(ctx, "error reverify link hosts worker", "err", err)
 			}
 		}
 	}()
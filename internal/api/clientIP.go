@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are the networks of the proxies in front of the server. Only they may tell the client ip
+// with X-Forwarded-For or X-Real-IP, the headers of anyone else are ignored.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+func NewTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("NewTrustedProxies: %w", err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return &TrustedProxies{prefixes: prefixes}, nil
+}
+
+func (p TrustedProxies) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// realIP replaces RemoteAddr of requests sent by a trusted proxy with the client ip it forwarded.
+func (p TrustedProxies) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if clientIP, ok := p.forwardedClientIP(request); ok {
+			request.RemoteAddr = clientIP.String()
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// forwardedClientIP walks X-Forwarded-For from the right, every proxy appends the address it was sent from,
+// so the first address that is not a trusted proxy is the client. Entries left of it may be made up.
+func (p TrustedProxies) forwardedClientIP(request *http.Request) (netip.Addr, bool) {
+	peer, ok := parseAddr(request.RemoteAddr)
+	if !ok || !p.isTrusted(peer) {
+		return netip.Addr{}, false
+	}
+
+	forwardedFor := request.Header.Values("X-Forwarded-For")
+	if len(forwardedFor) == 0 {
+		return parseAddr(request.Header.Get("X-Real-IP"))
+	}
+
+	hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+	clientIP := peer
+	for i := len(hops) - 1; 0 <= i; i-- {
+		hop, isValid := parseAddr(hops[i])
+		if !isValid {
+			break
+		}
+		clientIP = hop
+		if !p.isTrusted(hop) {
+			break
+		}
+	}
+
+	return clientIP, clientIP != peer
+}
+
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
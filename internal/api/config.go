@@ -2,9 +2,20 @@ package api
 
 type Config struct {
 	Host string
-	HTTP configHTTP `mapstructure:"HTTP"`
+	// AdminToken guards the /admin routes, which are not mounted at all while it is empty.
+	AdminToken string
+	HTTP       configHTTP `mapstructure:"HTTP"`
 }
 
 type configHTTP struct {
 	InternalPort int
+	// TrustedProxies are the CIDRs of the proxies whose X-Forwarded-For and X-Real-IP headers are believed.
+	TrustedProxies []string
+	Batch          configBatch `mapstructure:"Batch"`
+}
+
+type configBatch struct {
+	TimeoutSeconds int
+	MaxItems       int
+	ChunkSize      int
 }
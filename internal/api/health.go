@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/beard-programmer/shortorg/internal/httpEncoder"
+)
+
+// HealthCheckFn returns nil while the component it checks can serve requests.
+type HealthCheckFn = func() error
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+const (
+	healthOk       = "ok"
+	healthDegraded = "degraded"
+)
+
+// healthHandlerFunc unlike /ping answers 503 as soon as any check fails, so the instance is taken out of rotation.
+func healthHandlerFunc(healthChecks map[string]HealthCheckFn) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		response := healthResponse{Status: healthOk, Checks: make(map[string]string, len(healthChecks))}
+		statusCode := http.StatusOK
+
+		for name, check := range healthChecks {
+			if err := check(); err != nil {
+				response.Status = healthDegraded
+				response.Checks[name] = err.Error()
+				statusCode = http.StatusServiceUnavailable
+
+				continue
+			}
+			response.Checks[name] = healthOk
+		}
+
+		httpEncoder.EncodeResponse(writer, request, statusCode, response)
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -10,7 +11,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/beard-programmer/shortorg/internal/editLink"
 	"github.com/beard-programmer/shortorg/internal/encode"
+	"github.com/beard-programmer/shortorg/internal/manageLinkHosts"
 	"github.com/beard-programmer/shortorg/internal/resolveLink"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -18,7 +21,8 @@ import (
 )
 
 const (
-	httpTimeout = 5 * time.Second
+	httpTimeout         = 5 * time.Second
+	defaultBatchTimeout = time.Minute
 )
 
 func (s *Server) serveHTTP(ctx context.Context) error {
@@ -43,7 +47,7 @@ func (s *Server) serveHTTP(ctx context.Context) error {
 		s.logger.WarnContext(ctx, "shutting down http-server")
 		shutdownErr := httpServer.Shutdown(shutdownCtx) //nolint:contextcheck // gracefully shutdown
 		if shutdownErr != nil {
-			s.logger.ErrorContext(ctx, "http shutdown error", shutdownErr)
+			s.logger.ErrorContext(ctx, "http shutdown error", "err", shutdownErr)
 
 			<-shutdownCtx.Done()
 
@@ -73,15 +77,103 @@ func (s *Server) getServerMux(_ context.Context) *chi.Mux {
 
 	mux.Route(
 		"/api", func(r chi.Router) {
-			r.Use(middleware.AllowContentType("application/json"))
-			r.HandleFunc("POST /encode", encode.HttpHandlerFunc(s.logger, s.encodeFn))
-			r.HandleFunc("POST /resolve-link", resolveLink.HTTPHandlerFunc(s.logger, s.decodeFn))
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Timeout(httpTimeout))
+				r.Use(middleware.AllowContentType("application/json"))
+				r.HandleFunc("POST /encode", encode.HttpHandlerFunc(s.logger, s.encodeFn))
+				r.HandleFunc("POST /resolve-link", resolveLink.HTTPHandlerFunc(s.logger, s.decodeFn))
+				// Links are edited and their past destinations listed by their owners only, with tokens issued
+				// under /admin.
+				if s.ownerTokens != nil {
+					r.HandleFunc(
+						"GET /links/{slug}/versions",
+						editLink.ListVersionsHTTPHandlerFunc(s.logger, *s.ownerTokens, s.listVersionsFn),
+					)
+					r.HandleFunc(
+						"PATCH /links/{slug}",
+						editLink.ChangeDestinationHTTPHandlerFunc(s.logger, *s.ownerTokens, s.changeDestinationFn),
+					)
+					r.HandleFunc(
+						"POST /links/{slug}/versions/{version}/restore",
+						editLink.RestoreVersionHTTPHandlerFunc(s.logger, *s.ownerTokens, s.restoreVersionFn),
+					)
+				}
+			})
+			// Batches run far longer than single requests and may stream NDJSON.
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Timeout(s.batchTimeout()))
+				r.Use(middleware.AllowContentType("application/json", "application/x-ndjson"))
+				r.HandleFunc("POST /encode/batch", encode.BatchHttpHandlerFunc(
+					s.logger,
+					s.encodeBatchFn,
+					s.config.HTTP.Batch.MaxItems,
+					s.config.HTTP.Batch.ChunkSize,
+				))
+			})
 		},
 	)
 
+	if s.config.AdminToken != "" {
+		mux.Route(
+			"/admin", func(r chi.Router) {
+				r.Use(middleware.Timeout(httpTimeout))
+				r.Use(requireBearerToken(s.config.AdminToken))
+				r.HandleFunc("GET /link-hosts", manageLinkHosts.ListHTTPHandlerFunc(s.logger, s.linkHostRegistry))
+				r.HandleFunc("GET /link-hosts/{hostname}", manageLinkHosts.GetHTTPHandlerFunc(s.logger, s.linkHostRegistry))
+				r.HandleFunc("PUT /link-hosts/{hostname}", manageLinkHosts.PutHTTPHandlerFunc(s.logger, s.linkHostRegistry))
+				r.HandleFunc(
+					"POST /link-hosts/{hostname}/verify",
+					manageLinkHosts.VerifyHTTPHandlerFunc(s.logger, s.verifyLinkHostFn),
+				)
+				r.HandleFunc(
+					"DELETE /link-hosts/{hostname}",
+					manageLinkHosts.DeleteHTTPHandlerFunc(s.logger, s.linkHostRegistry),
+				)
+				if s.ownerTokens != nil {
+					r.HandleFunc("POST /owner-tokens/{owner}", editLink.IssueOwnerTokenHTTPHandlerFunc(*s.ownerTokens))
+				}
+			},
+		)
+	}
+
+	mux.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(httpTimeout))
+		r.Mount("/debug", middleware.Profiler())
+		r.HandleFunc("GET /health", healthHandlerFunc(s.healthChecks))
+
+		redirectHandler := resolveLink.RedirectHTTPHandlerFunc(s.logger, s.decodeFn, s.redirectPolicy)
+		r.HandleFunc("GET /{slug}", redirectHandler)
+		r.HandleFunc("HEAD /{slug}", redirectHandler)
+		r.HandleFunc("POST /{slug}", redirectHandler)
+	})
+
 	return mux
 }
 
+func (s *Server) batchTimeout() time.Duration {
+	if s.config.HTTP.Batch.TimeoutSeconds <= 0 {
+		return defaultBatchTimeout
+	}
+
+	return time.Duration(s.config.HTTP.Batch.TimeoutSeconds) * time.Second
+}
+
+func requireBearerToken(token string) func(http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (s *Server) wrapWithDefaultMiddlewares(mux *chi.Mux) *chi.Mux {
 	logger := httplog.NewLogger(
 		"", httplog.Options{
@@ -95,15 +187,14 @@ func (s *Server) wrapWithDefaultMiddlewares(mux *chi.Mux) *chi.Mux {
 			QuietDownRoutes: []string{
 				"/api/resolve-link",
 				"/api/encode",
+				"/api/encode/batch",
 			},
 			QuietDownPeriod: 1 * time.Second,
 		},
 	)
-	mux.Use(httplog.RequestLogger(logger, []string{"/ping", "/debug"}))
-	mux.Use(middleware.RealIP)
+	mux.Use(httplog.RequestLogger(logger, []string{"/ping", "/health", "/debug"}))
+	mux.Use(s.trustedProxies.realIP)
 	mux.Use(middleware.Heartbeat("/ping"))
-	mux.Use(middleware.Timeout(httpTimeout))
-	mux.Mount("/debug", middleware.Profiler())
 
 	return mux
 }
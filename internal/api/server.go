@@ -6,7 +6,9 @@ import (
 	"time"
 
 	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/editLink"
 	"github.com/beard-programmer/shortorg/internal/encode"
+	"github.com/beard-programmer/shortorg/internal/manageLinkHosts"
 	"github.com/beard-programmer/shortorg/internal/resolveLink"
 )
 
@@ -15,9 +17,21 @@ const (
 )
 
 type Server struct {
-	encodeFn             encode.Fn
-	decodeFn             resolveLink.ResolveLinkFn
+	encodeFn            encode.Fn
+	encodeBatchFn       encode.BatchFn
+	decodeFn            resolveLink.ResolveLinkFn
+	changeDestinationFn editLink.ChangeDestinationFn
+	listVersionsFn      editLink.ListVersionsFn
+	restoreVersionFn    editLink.RestoreVersionFn
+	// ownerTokens is nil while links can not be edited.
+	ownerTokens          *editLink.OwnerTokenSigner
 	urlWasEncodedHandler encode.SaveEncodedURLJob
+	redirectPolicy       resolveLink.RedirectPolicy
+	healthChecks         map[string]HealthCheckFn
+	linkHostRegistry     manageLinkHosts.LinkHostRegistry
+	verifyLinkHostFn     manageLinkHosts.VerifyFn
+	reverifyLinkHostsJob manageLinkHosts.ReverifyJob
+	trustedProxies       TrustedProxies
 	config               Config
 
 	serverName string
@@ -27,8 +41,19 @@ type Server struct {
 
 func New(
 	encodeFn encode.Fn,
+	encodeBatchFn encode.BatchFn,
 	decodeFn resolveLink.ResolveLinkFn,
+	changeDestinationFn editLink.ChangeDestinationFn,
+	listVersionsFn editLink.ListVersionsFn,
+	restoreVersionFn editLink.RestoreVersionFn,
+	ownerTokens *editLink.OwnerTokenSigner,
 	urlWasEncodedHandler encode.SaveEncodedURLJob,
+	redirectPolicy resolveLink.RedirectPolicy,
+	healthChecks map[string]HealthCheckFn,
+	linkHostRegistry manageLinkHosts.LinkHostRegistry,
+	verifyLinkHostFn manageLinkHosts.VerifyFn,
+	reverifyLinkHostsJob manageLinkHosts.ReverifyJob,
+	trustedProxies TrustedProxies,
 	logger *appLogger.AppLogger,
 	config Config,
 	serverName string,
@@ -36,8 +61,19 @@ func New(
 ) *Server {
 	return &Server{
 		encodeFn:             encodeFn,
+		encodeBatchFn:        encodeBatchFn,
 		decodeFn:             decodeFn,
+		changeDestinationFn:  changeDestinationFn,
+		listVersionsFn:       listVersionsFn,
+		restoreVersionFn:     restoreVersionFn,
+		ownerTokens:          ownerTokens,
 		urlWasEncodedHandler: urlWasEncodedHandler,
+		redirectPolicy:       redirectPolicy,
+		healthChecks:         healthChecks,
+		linkHostRegistry:     linkHostRegistry,
+		verifyLinkHostFn:     verifyLinkHostFn,
+		reverifyLinkHostsJob: reverifyLinkHostsJob,
+		trustedProxies:       trustedProxies,
 		config:               config,
 		serverName:           serverName,
 		logger:               logger,
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/beard-programmer/shortorg/internal/api"
 	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/beard-programmer/shortorg/internal/editLink"
 	"github.com/beard-programmer/shortorg/internal/encode"
 	"github.com/beard-programmer/shortorg/internal/infrastructure"
+	"github.com/beard-programmer/shortorg/internal/manageLinkHosts"
 	"github.com/beard-programmer/shortorg/internal/resolveLink"
 )
 
@@ -17,8 +21,19 @@ type App struct {
 	logger               *logger.AppLogger
 	cfg                  config
 	encodeFn             encode.Fn
+	encodeBatchFn        encode.BatchFn
 	urlWasEncodedHandler encode.SaveEncodedURLJob
 	decodeFn             resolveLink.ResolveLinkFn
+	redirectPolicy       resolveLink.RedirectPolicy
+	healthChecks         map[string]api.HealthCheckFn
+	linkHostRegistry     *infrastructure.LinkHostRegistry
+	verifyLinkHostFn     manageLinkHosts.VerifyFn
+	reverifyLinkHostsJob manageLinkHosts.ReverifyJob
+	changeDestinationFn  editLink.ChangeDestinationFn
+	listVersionsFn       editLink.ListVersionsFn
+	restoreVersionFn     editLink.RestoreVersionFn
+	ownerTokens          *editLink.OwnerTokenSigner
+	trustedProxies       *api.TrustedProxies
 }
 
 func New(ctx context.Context, logger *logger.AppLogger) (*App, error) {
@@ -36,6 +51,7 @@ func New(ctx context.Context, logger *logger.AppLogger) (*App, error) {
 		ctx,
 		logger,
 		cfg.Infrastructure.PostgresClients,
+		cfg.Infrastructure.TokenStore.UsesIdentityDB(),
 		Name(),
 		cfg.isProdEnv(),
 	)
@@ -43,44 +59,269 @@ func New(ctx context.Context, logger *logger.AppLogger) (*App, error) {
 		return nil, fmt.Errorf("app.ConnectToPostgresClients: setup postgres clients: %w", err)
 	}
 
-	encodedURLCache, err := infrastructure.NewCache[string](cfg.Infrastructure.Cache)
+	encodedURLCache, err := infrastructure.NewCache[core.LinkDTO](cfg.Infrastructure.Cache)
 	if err != nil {
 		return nil, fmt.Errorf("app.ConnectToPostgresClients: setupEncodedURLStore: %w", err)
 	}
 
-	encodedURLStore, err := infrastructure.NewEncodedURLStore(postgresClients.ShortorgClient, encodedURLCache, logger)
+	linkKeyFilter, err := infrastructure.NewLinkKeyFilter(
+		ctx,
+		logger,
+		postgresClients.ShortorgClient,
+		cfg.Infrastructure.LinkKeyFilter,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup link key filter: %w", err)
+	}
+
+	canonicalizationPolicy, err := core.NewCanonicalizationPolicy(
+		cfg.Encode.CanonicalSortQuery,
+		cfg.Encode.CanonicalStripParams,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup canonicalization policy: %w", err)
+	}
+
+	encodedURLStore, err := infrastructure.NewEncodedURLStore(
+		postgresClients.ShortorgClient,
+		encodedURLCache,
+		logger,
+		cfg.Infrastructure.LinkStore,
+		linkKeyFilter,
+		*canonicalizationPolicy,
+	)
 	if err != nil {
 		return nil, fmt.Errorf("app.ConnectToPostgresClients: setupEncodedUrlStore: %w", err)
 	}
 
-	tokenStore, err := infrastructure.NewLinkKeyStore(
+	deadLetterStore, err := infrastructure.NewDeadLetterStore(postgresClients.ShortorgClient, logger)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup dead-letter store: %w", err)
+	}
+
+	linkAliasStore, err := infrastructure.NewLinkAliasStore(postgresClients.ShortorgClient, logger)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup link alias store: %w", err)
+	}
+
+	idempotencyStore, err := infrastructure.NewIdempotencyStore(
+		ctx,
+		postgresClients.ShortorgClient,
+		logger,
+		cfg.Infrastructure.IdempotencyKeys,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup idempotency store: %w", err)
+	}
+
+	linkHostRegistry, err := infrastructure.NewLinkHostRegistry(
+		ctx,
+		postgresClients.ShortorgClient,
+		logger,
+		cfg.Infrastructure.LinkHosts,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup link host registry: %w", err)
+	}
+	linkHostVerifier := infrastructure.NewLinkHostVerifier(cfg.Infrastructure.LinkHosts.Verifier, nil)
+
+	destinationPolicy, err := infrastructure.NewDestinationPolicy(
 		ctx,
 		logger,
-		postgresClients.TokenIdentifierClient,
-		cfg.Infrastructure.TokenStore,
+		cfg.Infrastructure.DestinationPolicy,
+		linkHostRegistry,
 	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup destination policy: %w", err)
+	}
+
+	tokenStore, err := infrastructure.NewTokenStore(ctx, logger, *postgresClients, cfg.Infrastructure.TokenStore)
 	if err != nil {
 		return nil, fmt.Errorf("app.ConnectToPostgresClients: setup token key store: %w", err)
 	}
 
-	urlWasEncodedChan := make(chan encode.URLWasEncoded, cfg.EncodedUrlsQueSize)
-	encodeFn := encode.NewEncodeFn(tokenStore, logger, urlWasEncodedChan)
-	decodeFn := resolveLink.NewResolveLinkFn(logger, encodedURLStore)
+	var deterministicLinkKeyStore encode.LinkKeyStore
+	if cfg.Infrastructure.DeterministicKeyStore.Enabled {
+		deterministicLinkKeyStore, err = infrastructure.NewDeterministicLinkKeyStore(
+			postgresClients.ShortorgClient,
+			logger,
+			cfg.Infrastructure.DeterministicKeyStore,
+			cfg.Infrastructure.TokenStore,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("app.New: setup deterministic link key store: %w", err)
+		}
+	}
+
+	encodedLinksLog, err := infrastructure.NewSegmentLog(ctx, logger, cfg.Infrastructure.EncodedLinksLog)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup encoded links log: %w", err)
+	}
+
+	pendingLinks := infrastructure.NewPendingLinks()
+	linkClickStore, err := infrastructure.NewLinkClickStore(
+		ctx,
+		postgresClients.ShortorgClient,
+		logger,
+		cfg.Infrastructure.LinkLifetime,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup link click store: %w", err)
+	}
+	_, err = infrastructure.NewLinkUpdateListener(
+		ctx,
+		logger,
+		cfg.Infrastructure.PostgresClients.ShortOrg,
+		Name(),
+		encodedURLStore,
+		pendingLinks,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup link update listener: %w", err)
+	}
+
+	urlWasEncodedQueue := encode.NewURLWasEncodedQueue(
+		cfg.EncodedUrlsQueSize,
+		time.Duration(cfg.Encode.AdmissionTimeoutMs)*time.Millisecond,
+		time.Duration(cfg.Encode.RetryAfterSeconds)*time.Second,
+	)
+	publishMetrics(urlWasEncodedQueue, pendingLinks, linkKeyFilter, tokenStore)
+
+	linkKeyCodec, err := core.NewLinkKeyCodec(cfg.LinkKeyCodec.Secret, cfg.LinkKeyCodec.PlainBelowKey)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup link key codec: %w", err)
+	}
+
+	encodeFn, err := encode.NewEncodeFn(
+		logger,
+		encode.Dependencies{
+			LinkKeyStore:              tokenStore,
+			DeterministicLinkKeyStore: deterministicLinkKeyStore,
+			LinkAliasStore:            linkAliasStore,
+			DestinationPolicy:         destinationPolicy,
+			LinkHostRegistry:          linkHostRegistry,
+			EncodedLinksLog:           encodedLinksLog,
+			PendingLinks:              pendingLinks,
+			IdempotencyStore:          idempotencyStore,
+			ReusableLinkStore:         encodedURLStore,
+			URLWasEncodedQueue:        urlWasEncodedQueue,
+		},
+		*linkKeyCodec,
+		cfg.Encode,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup encode: %w", err)
+	}
+
+	encodeBatchFn := encode.NewEncodeBatchFn(logger, encodeFn, tokenStore, tokenStore, cfg.Encode)
+
+	if cfg.ResolveLink.UnlockCookieSecret == "" {
+		logger.WarnContext(
+			ctx,
+			"app.New: unlock cookie secret is not set, unlocked links are asked for their password again after a restart",
+		)
+	}
+	unlockTokenSigner, err := resolveLink.NewUnlockTokenSigner(cfg.ResolveLink)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup unlock token signer: %w", err)
+	}
+
+	passwordAttemptLimiter, err := infrastructure.NewPasswordAttemptLimiter(
+		ctx,
+		postgresClients.ShortorgClient,
+		logger,
+		cfg.Infrastructure.PasswordAttempts,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup password attempt limiter: %w", err)
+	}
+
+	decodeFn := resolveLink.NewResolveLinkFn(
+		logger,
+		*linkKeyCodec,
+		linkHostRegistry,
+		pendingLinks,
+		linkAliasStore,
+		encodedURLStore,
+		linkClickStore,
+		passwordAttemptLimiter,
+		*unlockTokenSigner,
+	)
+
+	userinfoPolicy, err := core.NewUserinfoPolicy(cfg.Encode.UserinfoPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup userinfo policy: %w", err)
+	}
+	editLinkDependencies := editLink.Dependencies{
+		LinkHostRegistry: linkHostRegistry,
+		LinkAliasStore:   linkAliasStore,
+		PendingLinks:     pendingLinks,
+		LinkVersionStore: encodedURLStore,
+	}
+	// Destinations are held to the same policies whether a link is encoded or edited.
+	editLinkPolicies := editLink.Policies{
+		Userinfo:         *userinfoPolicy,
+		Canonicalization: *canonicalizationPolicy,
+		Destination:      destinationPolicy,
+	}
+
+	var ownerTokens *editLink.OwnerTokenSigner
+	if cfg.EditLink.OwnerTokenSecret != "" {
+		ownerTokens, err = editLink.NewOwnerTokenSigner(cfg.EditLink)
+		if err != nil {
+			return nil, fmt.Errorf("app.New: setup owner tokens: %w", err)
+		}
+	}
+
+	trustedProxies, err := api.NewTrustedProxies(cfg.APIServer.HTTP.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup trusted proxies: %w", err)
+	}
+
+	redirectPolicy, err := resolveLink.NewRedirectPolicy(cfg.ResolveLink)
+	if err != nil {
+		return nil, fmt.Errorf("app.New: setup redirect policy: %w", err)
+	}
 
 	urlWasEncodedHandler := encode.NewSaveEncodedURLJob(
 		logger,
 		encodedURLStore,
+		deadLetterStore,
+		encodedLinksLog,
+		pendingLinks,
 		cfg.EncodedUrlsQueSize,
 		1,
-		urlWasEncodedChan,
+		urlWasEncodedQueue,
+		cfg.Encode,
 	)
 
+	healthChecks := map[string]api.HealthCheckFn{
+		"linkKeyStore":    tokenStore.Health,
+		"encodedLinksLog": encodedLinksLog.Health,
+	}
+
 	return &App{
 		logger:               logger,
 		cfg:                  *cfg,
 		encodeFn:             encodeFn,
+		encodeBatchFn:        encodeBatchFn,
 		decodeFn:             decodeFn,
+		changeDestinationFn:  editLink.NewChangeDestinationFn(logger, editLinkDependencies, *linkKeyCodec, editLinkPolicies),
+		listVersionsFn:       editLink.NewListVersionsFn(editLinkDependencies, *linkKeyCodec),
+		restoreVersionFn:     editLink.NewRestoreVersionFn(logger, editLinkDependencies, *linkKeyCodec, editLinkPolicies),
+		ownerTokens:          ownerTokens,
 		urlWasEncodedHandler: urlWasEncodedHandler,
+		redirectPolicy:       *redirectPolicy,
+		healthChecks:         healthChecks,
+		linkHostRegistry:     linkHostRegistry,
+		verifyLinkHostFn:     manageLinkHosts.NewVerifyFn(logger, linkHostRegistry, linkHostVerifier, cfg.ManageLinkHosts),
+		reverifyLinkHostsJob: manageLinkHosts.NewReverifyJob(
+			logger,
+			linkHostRegistry,
+			linkHostVerifier,
+			cfg.ManageLinkHosts,
+		),
+		trustedProxies: trustedProxies,
 	}, nil
 }
 
@@ -91,8 +332,19 @@ func Name() string {
 func (app *App) Serve(ctx context.Context) error {
 	server := api.New(
 		app.encodeFn,
+		app.encodeBatchFn,
 		app.decodeFn,
+		app.changeDestinationFn,
+		app.listVersionsFn,
+		app.restoreVersionFn,
+		app.ownerTokens,
 		app.urlWasEncodedHandler,
+		app.redirectPolicy,
+		app.healthChecks,
+		app.linkHostRegistry,
+		app.verifyLinkHostFn,
+		app.reverifyLinkHostsJob,
+		*app.trustedProxies,
 		app.logger,
 		app.cfg.APIServer,
 		Name(),
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/beard-programmer/shortorg/internal/infrastructure"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+const commandsUsage = `usage:
+  shortorg                                   start the server
+  shortorg dead-letters list [-limit N]      print links that failed to persist as JSON lines
+  shortorg dead-letters replay [-limit N]    retry persisting links from the dead-letter store
+  shortorg rehash-urls [-batch N]            remake url hashes of links hashed under another canonical form`
+
+// RunCommand runs a one-off admin command instead of the server.
+func RunCommand(ctx context.Context, logger *logger.AppLogger, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w\n%s", errUnknownCommand, commandsUsage)
+	}
+
+	cfg, err := config{}.load(os.Getenv("APP_ENV"))
+	if err != nil {
+		return fmt.Errorf("app.RunCommand: setup cfg: %w", err)
+	}
+
+	switch args[0] {
+	case "dead-letters":
+		return runDeadLettersCommand(ctx, logger, *cfg, args[1:])
+	case "rehash-urls":
+		return runRehashURLsCommand(ctx, logger, *cfg, args[1:])
+	default:
+		return fmt.Errorf("%w %s\n%s", errUnknownCommand, args[0], commandsUsage)
+	}
+}
+
+func runDeadLettersCommand(ctx context.Context, logger *logger.AppLogger, cfg config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w dead-letters\n%s", errUnknownCommand, commandsUsage)
+	}
+
+	flags := flag.NewFlagSet("dead-letters "+args[0], flag.ContinueOnError)
+	limit := flags.Int("limit", 100, "max number of dead letters to process")
+	if err := flags.Parse(args[1:]); err != nil {
+		return fmt.Errorf("dead-letters: %w", err)
+	}
+
+	postgresClients, err := infrastructure.ConnectToPostgresClients(
+		ctx,
+		logger,
+		cfg.Infrastructure.PostgresClients,
+		false,
+		Name(),
+		cfg.isProdEnv(),
+	)
+	if err != nil {
+		return fmt.Errorf("dead-letters: setup postgres clients: %w", err)
+	}
+
+	deadLetterStore, err := infrastructure.NewDeadLetterStore(postgresClients.ShortorgClient, logger)
+	if err != nil {
+		return fmt.Errorf("dead-letters: setup dead-letter store: %w", err)
+	}
+
+	switch args[0] {
+	case "list":
+		return listDeadLetters(ctx, deadLetterStore, *limit)
+	case "replay":
+		cache, cacheErr := infrastructure.NewCache[core.LinkDTO](cfg.Infrastructure.Cache)
+		if cacheErr != nil {
+			return fmt.Errorf("dead-letters: setup cache: %w", cacheErr)
+		}
+
+		canonicalizationPolicy, policyErr := core.NewCanonicalizationPolicy(
+			cfg.Encode.CanonicalSortQuery,
+			cfg.Encode.CanonicalStripParams,
+		)
+		if policyErr != nil {
+			return fmt.Errorf("dead-letters: setup canonicalization policy: %w", policyErr)
+		}
+
+		linkStore, storeErr := infrastructure.NewEncodedURLStore(
+			postgresClients.ShortorgClient,
+			cache,
+			logger,
+			cfg.Infrastructure.LinkStore,
+			&infrastructure.LinkKeyFilterMock{},
+			*canonicalizationPolicy,
+		)
+		if storeErr != nil {
+			return fmt.Errorf("dead-letters: setup link store: %w", storeErr)
+		}
+
+		return replayDeadLetters(ctx, logger, deadLetterStore, linkStore, *limit)
+	default:
+		return fmt.Errorf("%w dead-letters %s\n%s", errUnknownCommand, args[0], commandsUsage)
+	}
+}
+
+func runRehashURLsCommand(ctx context.Context, logger *logger.AppLogger, cfg config, args []string) error {
+	flags := flag.NewFlagSet("rehash-urls", flag.ContinueOnError)
+	batch := flags.Int("batch", 1000, "number of links rehashed per statement")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("rehash-urls: %w", err)
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("rehash-urls: batch must be positive, got %d", *batch)
+	}
+
+	canonicalizationPolicy, err := core.NewCanonicalizationPolicy(
+		cfg.Encode.CanonicalSortQuery,
+		cfg.Encode.CanonicalStripParams,
+	)
+	if err != nil {
+		return fmt.Errorf("rehash-urls: setup canonicalization policy: %w", err)
+	}
+
+	postgresClients, err := infrastructure.ConnectToPostgresClients(
+		ctx,
+		logger,
+		cfg.Infrastructure.PostgresClients,
+		false,
+		Name(),
+		cfg.isProdEnv(),
+	)
+	if err != nil {
+		return fmt.Errorf("rehash-urls: setup postgres clients: %w", err)
+	}
+
+	rehasher, err := infrastructure.NewLinkHashRehasher(postgresClients.ShortorgClient, logger, *canonicalizationPolicy)
+	if err != nil {
+		return fmt.Errorf("rehash-urls: setup rehasher: %w", err)
+	}
+
+	rehashed, err := rehasher.RehashAll(ctx, *batch)
+	if err != nil {
+		return fmt.Errorf("rehash-urls: %w", err)
+	}
+
+	logger.InfoContext(ctx, "url hashes remade", "rehashed", rehashed, "policy", canonicalizationPolicy.ID())
+
+	return nil
+}
+
+func listDeadLetters(ctx context.Context, deadLetterStore *infrastructure.DeadLetterStore, limit int) error {
+	deadLetters, err := deadLetterStore.FindNotReplayed(ctx, limit)
+	if err != nil {
+		return fmt.Errorf("dead-letters list: %w", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, deadLetter := range deadLetters {
+		if err = encoder.Encode(deadLetter); err != nil {
+			return fmt.Errorf("dead-letters list: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func replayDeadLetters(
+	ctx context.Context,
+	logger *logger.AppLogger,
+	deadLetterStore *infrastructure.DeadLetterStore,
+	linkStore *infrastructure.LinkStore,
+	limit int,
+) error {
+	deadLetters, err := deadLetterStore.FindNotReplayed(ctx, limit)
+	if err != nil {
+		return fmt.Errorf("dead-letters replay: %w", err)
+	}
+
+	var replayed, failed int
+	for _, deadLetter := range deadLetters {
+		saveErr := linkStore.SaveMany(ctx, []core.LinkDTO{deadLetter.Link})
+		if saveErr != nil {
+			failed++
+			logger.ErrorContext(ctx, "dead letter replay failed", "id", deadLetter.ID, "err", saveErr)
+			if err = deadLetterStore.UpdateReason(ctx, deadLetter.ID, saveErr.Error()); err != nil {
+				return fmt.Errorf("dead-letters replay: %w", err)
+			}
+
+			continue
+		}
+
+		if err = deadLetterStore.MarkReplayed(ctx, deadLetter.ID); err != nil {
+			return fmt.Errorf("dead-letters replay: %w", err)
+		}
+		replayed++
+	}
+
+	logger.InfoContext(ctx, "dead letters replayed", "replayed", replayed, "failed", failed)
+
+	return nil
+}
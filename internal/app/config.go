@@ -2,9 +2,14 @@ package app
 
 import (
 	"fmt"
+	"strings"
 
 	apiServer "github.com/beard-programmer/shortorg/internal/api"
+	"github.com/beard-programmer/shortorg/internal/editLink"
+	"github.com/beard-programmer/shortorg/internal/encode"
 	"github.com/beard-programmer/shortorg/internal/infrastructure"
+	"github.com/beard-programmer/shortorg/internal/manageLinkHosts"
+	"github.com/beard-programmer/shortorg/internal/resolveLink"
 	"github.com/spf13/viper"
 )
 
@@ -13,8 +18,19 @@ type config struct {
 	EncodedUrlsQueSize int
 	Concurrency        int
 	IsDebug            bool
-	Infrastructure     infrastructure.Config `mapstructure:"Infrastructure"`
-	APIServer          apiServer.Config      `mapstructure:"APIServer"`
+	Infrastructure     infrastructure.Config  `mapstructure:"Infrastructure"`
+	APIServer          apiServer.Config       `mapstructure:"APIServer"`
+	Encode             encode.Config          `mapstructure:"Encode"`
+	ResolveLink        resolveLink.Config     `mapstructure:"ResolveLink"`
+	ManageLinkHosts    manageLinkHosts.Config `mapstructure:"ManageLinkHosts"`
+	EditLink           editLink.Config        `mapstructure:"EditLink"`
+	LinkKeyCodec       linkKeyCodecConfig     `mapstructure:"LinkKeyCodec"`
+}
+
+// linkKeyCodecConfig must not change once links were issued with it, see README.
+type linkKeyCodecConfig struct {
+	Secret        string
+	PlainBelowKey int64
 }
 
 func (config) load(env string) (*config, error) {
@@ -23,6 +39,10 @@ func (config) load(env string) (*config, error) {
 	viperConfig.SetConfigType("toml")
 	viperConfig.AddConfigPath("./config/")
 	viperConfig.SetConfigName(fmt.Sprintf("application.%s", env))
+	// Secrets can be given as env vars instead, e.g. SHORTORG_LINKKEYCODEC_SECRET.
+	viperConfig.SetEnvPrefix("shortorg")
+	viperConfig.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viperConfig.AutomaticEnv()
 
 	if err := viperConfig.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading cfg file: %w", err)
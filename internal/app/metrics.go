@@ -0,0 +1,22 @@
+package app
+
+import (
+	"expvar"
+
+	"github.com/beard-programmer/shortorg/internal/encode"
+	"github.com/beard-programmer/shortorg/internal/infrastructure"
+)
+
+// publishMetrics exposes runtime gauges on /debug/vars.
+func publishMetrics(
+	urlWasEncodedQueue *encode.URLWasEncodedQueue,
+	pendingLinks *infrastructure.PendingLinks,
+	linkKeyFilter infrastructure.LinkKeyFilter,
+	tokenStore infrastructure.TokenStore,
+) {
+	expvar.Publish("encoded_urls_queue_depth", expvar.Func(func() any { return urlWasEncodedQueue.Depth() }))
+	expvar.Publish("encoded_urls_queue_capacity", expvar.Func(func() any { return urlWasEncodedQueue.Capacity() }))
+	expvar.Publish("pending_links", expvar.Func(func() any { return pendingLinks.Len() }))
+	expvar.Publish("link_key_filter_rejected", expvar.Func(func() any { return linkKeyFilter.Rejected() }))
+	expvar.Publish("link_key_bands_remaining", expvar.Func(func() any { return tokenStore.RemainingByBand() }))
+}
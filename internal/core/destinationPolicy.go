@@ -0,0 +1,188 @@
+package core
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Rejection codes of destination policies, they are part of the api.
+const (
+	RejectionIPLiteral      = "ip_literal"
+	RejectionPrivateAddress = "private_address"
+	RejectionInternalHost   = "internal_host"
+	RejectionDeniedDomain   = "denied_domain"
+	RejectionNotAllowed     = "domain_not_allowed"
+	RejectionShortener      = "shortener"
+	RejectionLinkHost       = "link_host"
+)
+
+// DestinationRejection is why a destination policy refused a url.
+type DestinationRejection struct {
+	Code   string
+	Reason string
+}
+
+func (r *DestinationRejection) Error() string {
+	return fmt.Sprintf("destination was rejected: %s: %s", r.Code, r.Reason)
+}
+
+// internalHostSuffixes only resolve inside private networks.
+var internalHostSuffixes = []string{".localhost", ".local", ".internal", ".lan", ".home.arpa"}
+
+// CheckDestinationAddress rejects hosts that are written as an ip address, when rejectIPLiterals is set,
+// and hosts that point into a private network, when rejectPrivate is set: loopback, RFC 1918, link local
+// and unspecified addresses, localhost, single label hosts and internal suffixes.
+// Hosts are not resolved, only what the url itself says is checked.
+func CheckDestinationAddress(destinationURL *URL, rejectIPLiterals bool, rejectPrivate bool) *DestinationRejection {
+	hostname := strings.TrimSuffix(destinationURL.CanonicalHostname(), ".")
+
+	address, isIP := parseHostAddress(hostname)
+	if isIP {
+		if rejectIPLiterals {
+			return &DestinationRejection{Code: RejectionIPLiteral, Reason: hostname + " is an ip address"}
+		}
+		if rejectPrivate && IsPrivateAddress(address) {
+			return &DestinationRejection{Code: RejectionPrivateAddress, Reason: hostname + " is a private address"}
+		}
+
+		return nil
+	}
+
+	if !rejectPrivate {
+		return nil
+	}
+	if hostname == "localhost" || !strings.Contains(hostname, ".") {
+		return &DestinationRejection{Code: RejectionInternalHost, Reason: hostname + " is not a public host"}
+	}
+	for _, suffix := range internalHostSuffixes {
+		if strings.HasSuffix(hostname, suffix) {
+			return &DestinationRejection{Code: RejectionInternalHost, Reason: hostname + " is not a public host"}
+		}
+	}
+
+	return nil
+}
+
+// IsPrivateAddress is true for loopback, RFC 1918, link local and unspecified addresses.
+func IsPrivateAddress(address netip.Addr) bool {
+	address = address.Unmap()
+
+	return address.IsLoopback() || address.IsPrivate() || address.IsUnspecified() ||
+		address.IsLinkLocalUnicast() || address.IsLinkLocalMulticast() || address.IsInterfaceLocalMulticast()
+}
+
+// parseHostAddress also reads the ipv4 spellings browsers accept, e.g. 2130706433, 0x7f.1 or 0177.0.0.1.
+func parseHostAddress(hostname string) (netip.Addr, bool) {
+	if address, err := netip.ParseAddr(hostname); err == nil {
+		return address, true
+	}
+
+	parts := strings.Split(hostname, ".")
+	if 4 < len(parts) {
+		return netip.Addr{}, false
+	}
+
+	numbers := make([]uint64, 0, len(parts))
+	for _, part := range parts {
+		number, isNumber := parseIPv4Number(part)
+		if !isNumber {
+			return netip.Addr{}, false
+		}
+		numbers = append(numbers, number)
+	}
+
+	// Every part but the last is one byte, the last one fills the remaining bytes.
+	var value uint64
+	for _, number := range numbers[:len(numbers)-1] {
+		if 0xff < number {
+			return netip.Addr{}, false
+		}
+		value = value<<8 | number
+	}
+	lastBits := 8 * (5 - len(numbers))
+	last := numbers[len(numbers)-1]
+	if last>>lastBits != 0 {
+		return netip.Addr{}, false
+	}
+	value = value<<lastBits | last
+
+	return netip.AddrFrom4([4]byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}), true
+}
+
+func parseIPv4Number(part string) (uint64, bool) {
+	if part == "" {
+		return 0, false
+	}
+
+	base := 10
+	switch {
+	case strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X"):
+		base, part = 16, part[2:]
+		if part == "" {
+			return 0, true
+		}
+	case 1 < len(part) && part[0] == '0':
+		base, part = 8, part[1:]
+	}
+
+	number, err := strconv.ParseUint(part, base, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// DomainList matches hosts by exact domain, or by suffix for entries starting with a dot:
+// ".example.com" matches example.com and all of its subdomains.
+type DomainList struct {
+	exact    map[string]struct{}
+	suffixes map[string]struct{}
+}
+
+func NewDomainList(entries []string) (*DomainList, error) {
+	list := &DomainList{exact: make(map[string]struct{}), suffixes: make(map[string]struct{})}
+	for _, entry := range entries {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), ".")
+		domain, isSuffix := strings.CutPrefix(entry, ".")
+		if domain == "" || strings.ContainsAny(domain, "/:@ ") {
+			return nil, fmt.Errorf("%w NewDomainList: %q is not a domain", errValidation, entry)
+		}
+
+		domain = canonicalHostname(domain)
+		if isSuffix {
+			list.suffixes[domain] = struct{}{}
+		} else {
+			list.exact[domain] = struct{}{}
+		}
+	}
+
+	return list, nil
+}
+
+func (l *DomainList) Contains(hostname string) bool {
+	hostname = strings.TrimSuffix(hostname, ".")
+	if _, isFound := l.exact[hostname]; isFound {
+		return true
+	}
+
+	for domain := hostname; domain != ""; {
+		if _, isFound := l.suffixes[domain]; isFound {
+			return true
+		}
+
+		_, parent, hasParent := strings.Cut(domain, ".")
+		if !hasParent {
+			break
+		}
+		domain = parent
+	}
+
+	return false
+}
+
+func (l *DomainList) Len() int {
+	return len(l.exact) + len(l.suffixes)
+}
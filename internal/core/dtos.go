@@ -1,14 +1,30 @@
 package core
 
+import (
+	"fmt"
+	"time"
+)
+
+// URLDto carries the canonical form along, it may have been built with a policy the reader does not know.
+// Canonical is empty for urls stored before it existed and is then derived again.
 type URLDto struct {
-	Value string
+	Value     string
+	Canonical string
 }
 
 func (u *URL) IntoDto() URLDto {
-	return URLDto{u.String()}
+	return URLDto{Value: u.String(), Canonical: u.Canonical()}
 }
 func (dto URLDto) IntoDomain() (*URL, error) {
-	return NewURL(dto.Value)
+	destinationURL, err := NewURL(dto.Value)
+	if err != nil {
+		return nil, err
+	}
+	if dto.Canonical != "" {
+		destinationURL.canonical = dto.Canonical
+	}
+
+	return destinationURL, nil
 }
 
 type LinkSlugDto struct {
@@ -32,8 +48,13 @@ func (h LinkHost) IntoDto() LinkHostDto {
 	return LinkHostDto{Hostname: h.Hostname(), IsBranded: h.IsBranded()}
 }
 
+// IntoDomain trusts the dto, a link stays intact when its branded host is removed from the registry later.
 func (dto LinkHostDto) IntoDomain() (*LinkHost, error) {
-	return NewLinkHost(&dto.Hostname)
+	if dto.Hostname == "" {
+		return nil, fmt.Errorf("%w LinkHostDto.IntoDomain: hostname is empty", errValidation)
+	}
+
+	return &LinkHost{hostname: dto.Hostname, isBranded: dto.Hostname != DefaultLinkHost}, nil
 }
 
 type LinkKeyDto struct {
@@ -47,3 +68,103 @@ func (k LinkKey) IntoDto() LinkKeyDto {
 func (dto LinkKeyDto) IntoDomain() (*LinkKey, error) {
 	return NewLinkKey(dto.Value)
 }
+
+type RedirectStatusDto struct {
+	Value int
+}
+
+func (s RedirectStatus) IntoDto() RedirectStatusDto {
+	return RedirectStatusDto{Value: s.Value()}
+}
+
+func (dto RedirectStatusDto) IntoDomain() (*RedirectStatus, error) {
+	return NewRedirectStatus(dto.Value)
+}
+
+type LinkAliasDto struct {
+	Value string
+}
+
+func (a LinkAlias) IntoDto() LinkAliasDto {
+	return LinkAliasDto{Value: a.Value()}
+}
+
+func (dto LinkAliasDto) IntoDomain() (*LinkAlias, error) {
+	return NewLinkAlias(dto.Value)
+}
+
+// LinkKeySeedDto is what a key may be derived from, stores issuing keys from a sequence ignore it.
+// LegacyDestinationURL is the url as keys were derived from before canonical forms.
+type LinkKeySeedDto struct {
+	Host                 string
+	DestinationURL       string
+	LegacyDestinationURL string
+	Namespace            string
+	Owner                string
+	RedirectStatus       *RedirectStatusDto
+}
+
+// ReusableLinkQueryDto looks up an existing link of the owner for the same url and redirect status.
+type ReusableLinkQueryDto struct {
+	Owner          string
+	URLFingerprint []byte
+	Host           LinkHostDto
+	RedirectStatus *RedirectStatusDto
+}
+
+type IdempotencyKeyDto struct {
+	Owner string
+	Key   string
+}
+
+// IdempotencyRecordDto is what a claim of an idempotency key found. Link is nil while the first request
+// with the key is still in flight.
+type IdempotencyRecordDto struct {
+	IsClaimed          bool
+	RequestFingerprint []byte
+	Link               *LinkDTO
+}
+
+// BrandedHostDto is a host registered for branded links. Owner is optional, VerifiedAt and CheckedAt are nil
+// until the first successful and the first ownership check.
+type BrandedHostDto struct {
+	Hostname           string
+	Owner              string
+	Status             string
+	ChallengeToken     string
+	VerificationMethod string
+	VerifiedAt         *time.Time
+	CheckedAt          *time.Time
+	FailedChecks       int
+	LastError          string
+	CreatedAt          time.Time
+}
+
+// LinkVersionDto is a destination a link had. Version 1 is the one it was issued with, RestoredFrom is set
+// when the version brought back an older one.
+type LinkVersionDto struct {
+	Version        int
+	DestinationURL URLDto
+	Author         string
+	RestoredFrom   *int
+	CreatedAt      time.Time
+}
+
+// LinkDestinationChangeDto moves the link with Key on Host to DestinationURL as a new version.
+// Author has to be the owner of the link.
+type LinkDestinationChangeDto struct {
+	Key            LinkKeyDto
+	Host           LinkHostDto
+	DestinationURL URLDto
+	URLFingerprint []byte
+	Author         string
+	RestoredFrom   *int
+}
+
+// LinkLifetimeDto is nil on links that live forever, see LinkLifetime.
+type LinkLifetimeDto struct {
+	NotBefore *time.Time
+	ExpiresAt *time.Time
+	MaxClicks *int64
+	ExpiredAt *time.Time
+}
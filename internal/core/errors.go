@@ -5,3 +5,15 @@ import (
 )
 
 var errValidation = errors.New("validation")
+
+// ErrNonRetryable marks store failures that will fail the same way on every retry, e.g. constraint violations.
+var ErrNonRetryable = errors.New("non retryable")
+
+// ErrImmutableLink means the destination of a link can not change, e.g. deterministic keys are derived from it.
+var ErrImmutableLink = errors.New("link destination is immutable")
+
+// ErrNotLinkOwner means a link was asked to change by someone else than the owner it was encoded with.
+var ErrNotLinkOwner = errors.New("not the owner of the link")
+
+// ErrLinkKeyStoreDegraded means keys can not be issued until the key store recovers by itself.
+var ErrLinkKeyStoreDegraded = errors.New("link key store is degraded")
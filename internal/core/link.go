@@ -9,18 +9,59 @@ type Link struct {
 	Slug           LinkSlug
 	Host           LinkHost
 	DestinationURL DestinationURL
+	RedirectStatus *RedirectStatus
+	Alias          *LinkAlias
+	// Owner is who encoded the link, empty when unknown. Links are deduplicated per owner.
+	Owner string
+	// Lifetime is nil for links that live forever.
+	Lifetime *LinkLifetime
+	// Password is nil for links that redirect without one.
+	Password *LinkPasswordHash
 }
 
-func NewLink(linkKey LinkKey, linkHost LinkHost, destinationURL DestinationURL) (*Link, error) {
+type LinkOptions struct {
+	RedirectStatus *RedirectStatus
+	Alias          *LinkAlias
+	Owner          string
+	Lifetime       *LinkLifetime
+	Password       *LinkPasswordHash
+}
+
+func NewLink(
+	linkKey LinkKey,
+	linkHost LinkHost,
+	destinationURL DestinationURL,
+	codec LinkKeyCodec,
+	options LinkOptions,
+) (*Link, error) {
 	if destinationURL.Hostname() == linkHost.Hostname() {
 		return nil, fmt.Errorf("%w NewLink: destination url cannot have same host as link", errValidation)
 	}
 
-	linkSlug, err := linkKey.IntoLinkSlug()
+	linkSlug, err := linkKey.IntoLinkSlug(codec)
 	if err != nil {
 		return nil, err
 	}
-	return &Link{Key: linkKey, Slug: *linkSlug, Host: linkHost, DestinationURL: destinationURL}, nil
+	return &Link{
+		Key:            linkKey,
+		Slug:           *linkSlug,
+		Host:           linkHost,
+		DestinationURL: destinationURL,
+		RedirectStatus: options.RedirectStatus,
+		Alias:          options.Alias,
+		Owner:          options.Owner,
+		Lifetime:       options.Lifetime,
+		Password:       options.Password,
+	}, nil
+}
+
+// ShortPath is the path the link is served at: its alias when it has one, its slug otherwise.
+func (l *Link) ShortPath() string {
+	if l.Alias != nil {
+		return l.Alias.Value()
+	}
+
+	return l.Slug.Value()
 }
 
 type LinkDTO struct {
@@ -28,14 +69,51 @@ type LinkDTO struct {
 	Slug           LinkSlugDto
 	Host           LinkHostDto
 	DestinationURL URLDto
+	RedirectStatus *RedirectStatusDto
+	Alias          *LinkAliasDto
+	Owner          string
+	// URLFingerprint is derived from DestinationURL, see URL.Fingerprint.
+	URLFingerprint []byte
+	Lifetime       *LinkLifetimeDto
+	// PasswordHash is empty for links without a password.
+	PasswordHash []byte
 }
 
 func (l *Link) IntoDto() LinkDTO {
+	var redirectStatus *RedirectStatusDto
+	if l.RedirectStatus != nil {
+		dto := l.RedirectStatus.IntoDto()
+		redirectStatus = &dto
+	}
+
+	var alias *LinkAliasDto
+	if l.Alias != nil {
+		dto := l.Alias.IntoDto()
+		alias = &dto
+	}
+
+	var lifetime *LinkLifetimeDto
+	if l.Lifetime != nil {
+		dto := l.Lifetime.IntoDto()
+		lifetime = &dto
+	}
+
+	var passwordHash []byte
+	if l.Password != nil {
+		passwordHash = l.Password.IntoDto()
+	}
+
 	return LinkDTO{
 		Key:            l.Key.IntoDto(),
 		Slug:           l.Slug.IntoDto(),
 		Host:           l.Host.IntoDto(),
 		DestinationURL: l.DestinationURL.IntoDto(),
+		RedirectStatus: redirectStatus,
+		Alias:          alias,
+		Owner:          l.Owner,
+		URLFingerprint: l.DestinationURL.Fingerprint(),
+		Lifetime:       lifetime,
+		PasswordHash:   passwordHash,
 	}
 }
 
@@ -60,10 +138,36 @@ func (dto LinkDTO) IntoDomain() (*Link, error) {
 		return nil, err
 	}
 
+	var redirectStatus *RedirectStatus
+	if dto.RedirectStatus != nil {
+		redirectStatus, err = dto.RedirectStatus.IntoDomain()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var alias *LinkAlias
+	if dto.Alias != nil {
+		alias, err = dto.Alias.IntoDomain()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var lifetime *LinkLifetime
+	if dto.Lifetime != nil {
+		lifetime = dto.Lifetime.IntoDomain()
+	}
+
 	return &Link{
 		Key:            *key,
 		Slug:           *slug,
 		Host:           *host,
 		DestinationURL: *destinationURL,
+		RedirectStatus: redirectStatus,
+		Alias:          alias,
+		Owner:          dto.Owner,
+		Lifetime:       lifetime,
+		Password:       LinkPasswordHashFromDto(dto.PasswordHash),
 	}, nil
 }
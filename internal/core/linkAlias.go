@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LinkAlias is a custom, human readable alternative to a generated LinkSlug, e.g. "spring-sale".
+type LinkAlias struct {
+	value string
+}
+
+var aliasPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]*[a-z0-9])?$`)
+
+const (
+	minAliasSize = 3
+	maxAliasSize = 64
+)
+
+var reservedAliases = map[string]struct{}{
+	"api":    {},
+	"ping":   {},
+	"debug":  {},
+	"health": {},
+	"admin":  {},
+	"static": {},
+	"assets": {},
+}
+
+func NewLinkAlias(s string) (*LinkAlias, error) {
+	value := strings.ToLower(s)
+
+	if len(value) < minAliasSize || maxAliasSize < len(value) {
+		return nil, fmt.Errorf(
+			"%w NewLinkAlias: value length must be included in %d .. %d, got %d",
+			errValidation,
+			minAliasSize,
+			maxAliasSize,
+			len(value),
+		)
+	}
+
+	if !aliasPattern.MatchString(value) {
+		return nil, fmt.Errorf(
+			"%w NewLinkAlias: %s must only contain latin letters, digits and inner dashes",
+			errValidation,
+			s,
+		)
+	}
+
+	if _, isReserved := reservedAliases[value]; isReserved {
+		return nil, fmt.Errorf("%w NewLinkAlias: %s is reserved", errValidation, s)
+	}
+
+	if _, err := NewLinkSlug(value); err == nil {
+		return nil, fmt.Errorf("%w NewLinkAlias: %s is ambiguous with generated links", errValidation, s)
+	}
+
+	return &LinkAlias{value: value}, nil
+}
+
+func (a LinkAlias) Value() string {
+	return a.value
+}
@@ -1,6 +1,11 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
 
 type LinkHost struct {
 	hostname  string
@@ -15,12 +20,79 @@ func (h LinkHost) Hostname() string {
 	return h.hostname
 }
 
-func NewLinkHost(host *string) (*LinkHost, error) {
-	if host == nil || *host == "" || *host == DefaultLinkHost {
+// LinkHostRegistry knows the verified branded hosts links may be issued and resolved on besides DefaultLinkHost.
+type LinkHostRegistry interface {
+	IsBranded(hostname string) bool
+}
+
+// NewLinkHost accepts DefaultLinkHost, which an empty host stands for, and hosts registered as branded.
+// A nil registry has no branded hosts.
+func NewLinkHost(host *string, registry LinkHostRegistry) (*LinkHost, error) {
+	if host == nil || *host == "" {
+		return &LinkHost{hostname: DefaultLinkHost, isBranded: false}, nil
+	}
+
+	hostname := canonicalHostname(strings.TrimSuffix(*host, "."))
+	if hostname == DefaultLinkHost {
 		return &LinkHost{hostname: DefaultLinkHost, isBranded: false}, nil
 	}
+	if registry != nil && registry.IsBranded(hostname) {
+		return &LinkHost{hostname: hostname, isBranded: true}, nil
+	}
 
-	return nil, fmt.Errorf("link host %v is not supported", *host)
+	return nil, fmt.Errorf("%w NewLinkHost: link host %v is not supported", errValidation, *host)
 }
 
 const DefaultLinkHost = "shortl.org"
+
+// A branded host is pending until its ownership is verified and suspended once it fails re-verification,
+// only verified hosts issue and resolve links.
+const (
+	BrandedHostPending   = "pending"
+	BrandedHostVerified  = "verified"
+	BrandedHostSuspended = "suspended"
+)
+
+// Ownership of a branded host is proven by serving the challenge token at LinkHostVerificationPath
+// or by a TXT record named by LinkHostVerificationRecord holding LinkHostVerificationValue.
+const (
+	LinkHostVerificationPath = "/.well-known/shortorg-verification"
+	linkHostVerificationName = "shortorg-verification"
+)
+
+func LinkHostVerificationRecord(hostname string) string {
+	return "_" + linkHostVerificationName + "." + hostname
+}
+
+func LinkHostVerificationValue(challengeToken string) string {
+	return linkHostVerificationName + "=" + challengeToken
+}
+
+const maxHostnameSize = 253
+
+var hostnameLabelPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// NewBrandedHostname validates a host before it is registered as branded: a domain name with at least two
+// labels, in canonical form, that is neither DefaultLinkHost nor an ip address.
+func NewBrandedHostname(value string) (string, error) {
+	hostname := canonicalHostname(strings.TrimSuffix(strings.TrimSpace(value), "."))
+
+	if hostname == DefaultLinkHost {
+		return "", fmt.Errorf("%w NewBrandedHostname: %s is the default link host", errValidation, hostname)
+	}
+	if _, err := netip.ParseAddr(hostname); err == nil {
+		return "", fmt.Errorf("%w NewBrandedHostname: %s is an ip address", errValidation, hostname)
+	}
+
+	labels := strings.Split(hostname, ".")
+	if maxHostnameSize < len(hostname) || len(labels) < 2 {
+		return "", fmt.Errorf("%w NewBrandedHostname: %q is not a domain name", errValidation, value)
+	}
+	for _, label := range labels {
+		if !hostnameLabelPattern.MatchString(label) {
+			return "", fmt.Errorf("%w NewBrandedHostname: %q is not a domain name", errValidation, value)
+		}
+	}
+
+	return hostname, nil
+}
@@ -2,36 +2,87 @@ package core
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/itchyny/base58-go"
 )
 
 const (
-	minBase58Exp5 = 656356768   // 58^5
-	maxBase58Exp6 = 38068692543 // 58^6
+	MinSlugLength = 6
+	// MaxSlugLength is capped at 11 because keys are BIGINT: 58^11 overflows int64, so the 11 character band
+	// ends at math.MaxInt64 instead of 58^11-1. It still holds ~20 times more keys than all shorter bands together.
+	MaxSlugLength = 11
+
+	minBase58Exp5 = 656356768 // 58^5, the first key with a 6 characters slug
 )
 
+// LinkKeyBand is the range of keys whose slugs have the same length.
+type LinkKeyBand struct {
+	SlugLength int
+	First      int64
+	Last       int64
+}
+
+func NewLinkKeyBand(slugLength int) (*LinkKeyBand, error) {
+	if slugLength < MinSlugLength || MaxSlugLength < slugLength {
+		return nil, fmt.Errorf(
+			"%w NewLinkKeyBand: slug length must be included in %d .. %d, got %d",
+			errValidation,
+			MinSlugLength,
+			MaxSlugLength,
+			slugLength,
+		)
+	}
+
+	first := int64(1)
+	for range slugLength - 1 {
+		first *= 58
+	}
+
+	last := int64(math.MaxInt64)
+	if slugLength < MaxSlugLength {
+		last = first*58 - 1
+	}
+
+	return &LinkKeyBand{SlugLength: slugLength, First: first, Last: last}, nil
+}
+
+func (b LinkKeyBand) Contains(key int64) bool {
+	return b.First <= key && key <= b.Last
+}
+
+// Remaining is the number of keys of the band that are still free when keys up to lastIssued were issued.
+func (b LinkKeyBand) Remaining(lastIssued int64) int64 {
+	if lastIssued < b.First {
+		return b.Last - b.First + 1
+	}
+	if b.Last <= lastIssued {
+		return 0
+	}
+
+	return b.Last - lastIssued
+}
+
 type LinkKey struct {
 	value uint64
 }
 
 func NewLinkKey[T int64 | uint64](value T) (*LinkKey, error) {
-	if value < minBase58Exp5 || maxBase58Exp6 <= value {
+	if value < minBase58Exp5 || math.MaxInt64 < uint64(value) {
 		return nil, fmt.Errorf(
 			"%w NewLinkKey: value %d is out of range: must be included in %d .. %d",
 			errValidation,
 			value,
 			minBase58Exp5,
-			maxBase58Exp6-1,
+			int64(math.MaxInt64),
 		)
 	}
 
 	return &LinkKey{value: uint64(value)}, nil
 }
 
-// TODO: deprecated
-func (k LinkKey) IntoLinkSlug() (*LinkSlug, error) {
-	encoded := string(base58.BitcoinEncoding.EncodeUint64(k.value))
+func (k LinkKey) IntoLinkSlug(codec LinkKeyCodec) (*LinkSlug, error) {
+	encoded := string(base58.BitcoinEncoding.EncodeUint64(codec.encode(k.value)))
 	return NewLinkSlug(encoded)
 }
 
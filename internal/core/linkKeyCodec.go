@@ -0,0 +1,147 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	linkKeyCodecRounds   = 8
+	minLinkKeyCodecBytes = 16
+)
+
+// LinkKeyCodec turns sequential keys into random looking slugs and back without a lookup.
+// Keys are shuffled by a keyed Feistel permutation inside their slug length band, cycle walking keeps
+// the result in the band, so a slug is as long as it would be without the codec.
+// Keys below plainBelowKey are left as is, slugs issued before the codec was enabled keep resolving.
+// The zero value does not permute anything.
+type LinkKeyCodec struct {
+	secret        []byte
+	plainBelowKey int64
+}
+
+func NewLinkKeyCodec(secret string, plainBelowKey int64) (*LinkKeyCodec, error) {
+	if secret == "" {
+		return &LinkKeyCodec{}, nil
+	}
+	if len(secret) < minLinkKeyCodecBytes {
+		return nil, fmt.Errorf(
+			"%w NewLinkKeyCodec: secret must be at least %d bytes long, got %d",
+			errValidation,
+			minLinkKeyCodecBytes,
+			len(secret),
+		)
+	}
+
+	return &LinkKeyCodec{secret: []byte(secret), plainBelowKey: plainBelowKey}, nil
+}
+
+func (c LinkKeyCodec) encode(key uint64) uint64 {
+	domain, isPermuted := c.domainOf(key)
+	if !isPermuted {
+		return key
+	}
+
+	return domain.first + domain.walk(key-domain.first, domain.encrypt)
+}
+
+func (c LinkKeyCodec) decode(value uint64) uint64 {
+	domain, isPermuted := c.domainOf(value)
+	if !isPermuted {
+		return value
+	}
+
+	return domain.first + domain.walk(value-domain.first, domain.decrypt)
+}
+
+// domainOf is the permuted part of the band holding value, keys and slug values of a band share it.
+func (c LinkKeyCodec) domainOf(value uint64) (feistelDomain, bool) {
+	if len(c.secret) == 0 {
+		return feistelDomain{}, false
+	}
+
+	for slugLength := MinSlugLength; slugLength <= MaxSlugLength; slugLength++ {
+		band, err := NewLinkKeyBand(slugLength)
+		if err != nil {
+			return feistelDomain{}, false
+		}
+		if !band.Contains(int64(value)) { //nolint:gosec // keys are validated to fit int64
+			continue
+		}
+
+		first := uint64(max(band.First, c.plainBelowKey)) //nolint:gosec // positive
+		last := uint64(band.Last)                         //nolint:gosec // positive
+		if value < first {
+			return feistelDomain{}, false
+		}
+
+		return newFeistelDomain(c.secret, slugLength, first, last-first+1), true
+	}
+
+	return feistelDomain{}, false
+}
+
+type feistelDomain struct {
+	secret     []byte
+	slugLength int
+	first      uint64
+	size       uint64
+	halfBits   int
+	halfMask   uint64
+}
+
+func newFeistelDomain(secret []byte, slugLength int, first, size uint64) feistelDomain {
+	width := bits.Len64(size - 1)
+	width += width % 2 //nolint:mnd // halves must be equal
+	width = max(width, 2)
+
+	return feistelDomain{
+		secret:     secret,
+		slugLength: slugLength,
+		first:      first,
+		size:       size,
+		halfBits:   width / 2, //nolint:mnd // halves
+		halfMask:   1<<(width/2) - 1,
+	}
+}
+
+// walk applies step until the result is inside the domain again, it ends because step is a permutation.
+func (d feistelDomain) walk(x uint64, step func(uint64) uint64) uint64 {
+	x = step(x)
+	for d.size <= x {
+		x = step(x)
+	}
+
+	return x
+}
+
+func (d feistelDomain) encrypt(x uint64) uint64 {
+	left, right := x>>d.halfBits, x&d.halfMask
+	for round := range linkKeyCodecRounds {
+		left, right = right, left^d.roundFunction(round, right)
+	}
+
+	return left<<d.halfBits | right
+}
+
+func (d feistelDomain) decrypt(x uint64) uint64 {
+	left, right := x>>d.halfBits, x&d.halfMask
+	for round := linkKeyCodecRounds - 1; 0 <= round; round-- {
+		left, right = right^d.roundFunction(round, left), left
+	}
+
+	return left<<d.halfBits | right
+}
+
+func (d feistelDomain) roundFunction(round int, half uint64) uint64 {
+	mac := hmac.New(sha256.New, d.secret)
+	input := make([]byte, 0, 10) //nolint:mnd // two bytes and uint64
+	input = append(input, byte(d.slugLength), byte(round))
+	input = binary.BigEndian.AppendUint64(input, half)
+	mac.Write(input)
+
+	return binary.BigEndian.Uint64(mac.Sum(nil)) & d.halfMask
+}
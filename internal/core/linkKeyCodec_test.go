@@ -0,0 +1,164 @@
+package core
+
+import "testing"
+
+const testLinkKeyCodecSecret = "test-link-key-codec-secret"
+
+func TestLinkKeyCodecRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	band7, err := NewLinkKeyBand(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainBelowKey := band7.First + 1000
+
+	codecs := []struct {
+		name          string
+		secret        string
+		plainBelowKey int64
+	}{
+		{name: "zero codec"},
+		{name: "permuted", secret: testLinkKeyCodecSecret},
+		{name: "plain below a key inside a band", secret: testLinkKeyCodecSecret, plainBelowKey: plainBelowKey},
+	}
+
+	var keys []int64
+	for slugLength := MinSlugLength; slugLength <= MaxSlugLength; slugLength++ {
+		band, bandErr := NewLinkKeyBand(slugLength)
+		if bandErr != nil {
+			t.Fatal(bandErr)
+		}
+		keys = append(keys, band.First, band.First+1, band.Last-1, band.Last)
+	}
+	keys = append(keys, plainBelowKey-1, plainBelowKey, plainBelowKey+1)
+
+	for _, codecCase := range codecs {
+		t.Run(codecCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			codec, codecErr := NewLinkKeyCodec(codecCase.secret, codecCase.plainBelowKey)
+			if codecErr != nil {
+				t.Fatal(codecErr)
+			}
+
+			for _, value := range keys {
+				key, keyErr := NewLinkKey(value)
+				if keyErr != nil {
+					t.Fatal(keyErr)
+				}
+
+				slug, slugErr := key.IntoLinkSlug(*codec)
+				if slugErr != nil {
+					t.Fatalf("key %d: IntoLinkSlug: %v", value, slugErr)
+				}
+
+				band := bandOf(t, value)
+				if len(slug.Value()) != band.SlugLength {
+					t.Errorf("key %d: slug %s has length %d, want %d",
+						value, slug.Value(), len(slug.Value()), band.SlugLength)
+				}
+
+				isPlain := codecCase.secret == "" || value < codecCase.plainBelowKey
+				plainSlug, plainErr := key.IntoLinkSlug(LinkKeyCodec{})
+				if plainErr != nil {
+					t.Fatal(plainErr)
+				}
+				if isPlain && slug.Value() != plainSlug.Value() {
+					t.Errorf("key %d: slug %s, want the plain slug %s", value, slug.Value(), plainSlug.Value())
+				}
+
+				decoded, decodeErr := slug.IntoLinkKey(*codec)
+				if decodeErr != nil {
+					t.Fatalf("key %d: IntoLinkKey(%s): %v", value, slug.Value(), decodeErr)
+				}
+				if decoded.Value() != value {
+					t.Errorf("key %d: slug %s decodes to %d", value, slug.Value(), decoded.Value())
+				}
+			}
+		})
+	}
+}
+
+// TestLinkKeyCodecKeepsPlainSlugs checks that permuted keys never take a slug a plain key below plainBelowKey has.
+func TestLinkKeyCodecKeepsPlainSlugs(t *testing.T) {
+	t.Parallel()
+
+	band, err := NewLinkKeyBand(MinSlugLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainBelowKey := band.First + 64
+
+	codec, err := NewLinkKeyCodec(testLinkKeyCodecSecret, plainBelowKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for value := plainBelowKey; value < plainBelowKey+4096; value++ {
+		encoded := codec.encode(uint64(value))
+		if encoded < uint64(plainBelowKey) || uint64(band.Last) < encoded {
+			t.Fatalf("key %d encodes to %d, outside of %d .. %d", value, encoded, plainBelowKey, band.Last)
+		}
+	}
+}
+
+// TestLinkSlugRejects checks that malformed slugs fail in NewLinkSlug or, at the latest, in IntoLinkKey.
+func TestLinkSlugRejects(t *testing.T) {
+	t.Parallel()
+
+	codec, err := NewLinkKeyCodec(testLinkKeyCodecSecret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		slug string
+	}{
+		{name: "leading zero digit", slug: "1abcdef"},
+		{name: "too short", slug: "abcde"},
+		{name: "too long", slug: "abcdefghijkm"},
+		{name: "not base58", slug: "abcd0O"},
+		{name: "above max int64", slug: "zzzzzzzzzzz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			slug, slugErr := NewLinkSlug(tt.slug)
+			if slugErr != nil {
+				return
+			}
+			if key, keyErr := slug.IntoLinkKey(*codec); keyErr == nil {
+				t.Errorf("IntoLinkKey(%s) = %d, want an error", tt.slug, key.Value())
+			}
+		})
+	}
+}
+
+func TestNewLinkKeyCodecRejectsShortSecret(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewLinkKeyCodec("short", 0); err == nil {
+		t.Error("NewLinkKeyCodec with a short secret succeeded, want an error")
+	}
+}
+
+func bandOf(t *testing.T, value int64) LinkKeyBand {
+	t.Helper()
+
+	for slugLength := MinSlugLength; slugLength <= MaxSlugLength; slugLength++ {
+		band, err := NewLinkKeyBand(slugLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if band.Contains(value) {
+			return *band
+		}
+	}
+	t.Fatalf("key %d is in no band", value)
+
+	return LinkKeyBand{}
+}
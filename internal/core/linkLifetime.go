@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// LinkState is whether a link redirects at some moment, see LinkLifetime.StateAt.
+type LinkState int
+
+const (
+	LinkActive LinkState = iota
+	LinkNotYetActive
+	LinkExpired
+)
+
+const maxLinkClicks = 1_000_000_000_000
+
+// LinkLifetime limits when and how often a link redirects: not before NotBefore, not after ExpiresAt and
+// at most MaxClicks times. Every limit is optional. ExpiredAt is when the link was found expired or out of
+// clicks, it stays expired from then on.
+type LinkLifetime struct {
+	notBefore *time.Time
+	expiresAt *time.Time
+	maxClicks *int64
+	expiredAt *time.Time
+}
+
+// NewLinkLifetime is nil when no limit is given. ExpiresAt has to be in the future and after NotBefore.
+func NewLinkLifetime(notBefore *time.Time, expiresAt *time.Time, maxClicks *int64, now time.Time) (*LinkLifetime, error) {
+	if notBefore == nil && expiresAt == nil && maxClicks == nil {
+		return nil, nil //nolint:nilnil // no limits is no lifetime
+	}
+
+	if expiresAt != nil && !now.Before(*expiresAt) {
+		return nil, fmt.Errorf("%w NewLinkLifetime: expiresAt must be in the future", errValidation)
+	}
+	if notBefore != nil && expiresAt != nil && !notBefore.Before(*expiresAt) {
+		return nil, fmt.Errorf("%w NewLinkLifetime: notBefore must be before expiresAt", errValidation)
+	}
+	if maxClicks != nil && (*maxClicks < 1 || maxLinkClicks < *maxClicks) {
+		return nil, fmt.Errorf("%w NewLinkLifetime: maxClicks must be from 1 to %d", errValidation, int64(maxLinkClicks))
+	}
+
+	return &LinkLifetime{notBefore: utcOrNil(notBefore), expiresAt: utcOrNil(expiresAt), maxClicks: maxClicks}, nil
+}
+
+func (l *LinkLifetime) NotBefore() *time.Time {
+	return l.notBefore
+}
+
+func (l *LinkLifetime) ExpiresAt() *time.Time {
+	return l.expiresAt
+}
+
+func (l *LinkLifetime) MaxClicks() *int64 {
+	return l.maxClicks
+}
+
+// StateAt does not know about clicks, a link out of clicks is only expired once it was marked so.
+func (l *LinkLifetime) StateAt(now time.Time) LinkState {
+	switch {
+	case l == nil:
+		return LinkActive
+	case l.expiredAt != nil, l.expiresAt != nil && !now.Before(*l.expiresAt):
+		return LinkExpired
+	case l.notBefore != nil && now.Before(*l.notBefore):
+		return LinkNotYetActive
+	default:
+		return LinkActive
+	}
+}
+
+func (l *LinkLifetime) IntoDto() LinkLifetimeDto {
+	return LinkLifetimeDto{
+		NotBefore: l.notBefore,
+		ExpiresAt: l.expiresAt,
+		MaxClicks: l.maxClicks,
+		ExpiredAt: l.expiredAt,
+	}
+}
+
+// IntoDomain trusts the dto, a stored lifetime may have expired already.
+func (dto LinkLifetimeDto) IntoDomain() *LinkLifetime {
+	return &LinkLifetime{
+		notBefore: utcOrNil(dto.NotBefore),
+		expiresAt: utcOrNil(dto.ExpiresAt),
+		maxClicks: dto.MaxClicks,
+		expiredAt: utcOrNil(dto.ExpiredAt),
+	}
+}
+
+func utcOrNil(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	utc := value.UTC()
+
+	return &utc
+}
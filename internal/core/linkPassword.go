@@ -0,0 +1,59 @@
+package core
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minLinkPasswordSize = 4
+	// maxLinkPasswordSize is what bcrypt reads of a password, the rest would be ignored.
+	maxLinkPasswordSize = 72
+)
+
+// LinkPasswordHash is the bcrypt hash of the password a link is unlocked with, the password itself is never kept.
+type LinkPasswordHash struct {
+	hash []byte
+}
+
+// NewLinkPasswordHash hashes the password with the given bcrypt cost, bcrypt.DefaultCost when it is 0.
+func NewLinkPasswordHash(password string, cost int) (*LinkPasswordHash, error) {
+	if len(password) < minLinkPasswordSize || maxLinkPasswordSize < len(password) || !utf8.ValidString(password) {
+		return nil, fmt.Errorf(
+			"%w NewLinkPasswordHash: password must be %d to %d bytes of utf-8",
+			errValidation,
+			minLinkPasswordSize,
+			maxLinkPasswordSize,
+		)
+	}
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return nil, fmt.Errorf("NewLinkPasswordHash: %w", err)
+	}
+
+	return &LinkPasswordHash{hash: hash}, nil
+}
+
+// Matches takes as long as hashing, callers limit how often it is asked.
+func (h *LinkPasswordHash) Matches(password string) bool {
+	return bcrypt.CompareHashAndPassword(h.hash, []byte(password)) == nil
+}
+
+func (h *LinkPasswordHash) IntoDto() []byte {
+	return h.hash
+}
+
+// LinkPasswordHashFromDto trusts the stored hash, a damaged one never matches.
+func LinkPasswordHashFromDto(hash []byte) *LinkPasswordHash {
+	if len(hash) == 0 {
+		return nil
+	}
+
+	return &LinkPasswordHash{hash: hash}
+}
@@ -13,11 +13,15 @@ type LinkSlug struct {
 
 var pattern = regexp.MustCompile(`^[123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]+$`)
 
-const minSlugSize = 6
-
 func NewLinkSlug(s string) (*LinkSlug, error) {
-	if len(s) != minSlugSize {
-		return nil, fmt.Errorf("%w NewLinkSlug: value length must 6 characters, got %d", errValidation, len(s))
+	if len(s) < MinSlugLength || MaxSlugLength < len(s) {
+		return nil, fmt.Errorf(
+			"%w NewLinkSlug: value length must be included in %d .. %d, got %d",
+			errValidation,
+			MinSlugLength,
+			MaxSlugLength,
+			len(s),
+		)
 	}
 
 	if !pattern.MatchString(s) {
@@ -29,6 +33,11 @@ func NewLinkSlug(s string) (*LinkSlug, error) {
 			)
 	}
 
+	// A leading "1" is a zero digit in base58, such slug would be a longer spelling of a shorter one.
+	if s[0] == '1' {
+		return nil, fmt.Errorf("%w NewLinkSlug: %s value must not start with 1", errValidation, s)
+	}
+
 	return &LinkSlug{value: s}, nil
 }
 
@@ -36,11 +45,17 @@ func (s LinkSlug) Value() string {
 	return s.value
 }
 
-// TODO: deprecated
-func (s LinkSlug) IntoLinkKey() (*LinkKey, error) {
+func (s LinkSlug) IntoLinkKey(codec LinkKeyCodec) (*LinkKey, error) {
 	value, err := base58.BitcoinEncoding.DecodeUint64([]byte(s.value))
 	if err != nil {
 		return nil, err
 	}
-	return NewLinkKey(value)
+	// DecodeUint64 wraps around silently on overflow, which only long slugs can hit.
+	if string(base58.BitcoinEncoding.EncodeUint64(value)) != s.value {
+		return nil, fmt.Errorf("%w IntoLinkKey: %s value is out of range", errValidation, s.value)
+	}
+	if _, err = NewLinkKey(value); err != nil {
+		return nil, err
+	}
+	return NewLinkKey(codec.decode(value))
 }
@@ -0,0 +1,27 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type RedirectStatus struct {
+	value int
+}
+
+func NewRedirectStatus(value int) (*RedirectStatus, error) {
+	switch value {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return &RedirectStatus{value: value}, nil
+	default:
+		return nil, fmt.Errorf(
+			"%w NewRedirectStatus: value %d is not supported: must be one of 301, 302, 307, 308",
+			errValidation,
+			value,
+		)
+	}
+}
+
+func (s RedirectStatus) Value() int {
+	return s.value
+}
@@ -1,8 +1,11 @@
 package core
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"net"
 	"net/url"
+	"strings"
 )
 
 const (
@@ -10,13 +13,55 @@ const (
 	maxURLLen = 2048
 )
 
+type UserinfoPolicy int
+
+const (
+	UserinfoReject UserinfoPolicy = iota
+	UserinfoStrip
+)
+
+func NewUserinfoPolicy(value string) (*UserinfoPolicy, error) {
+	var policy UserinfoPolicy
+
+	switch strings.ToLower(value) {
+	case "", "reject":
+		policy = UserinfoReject
+	case "strip":
+		policy = UserinfoStrip
+	default:
+		return nil, fmt.Errorf("%w NewUserinfoPolicy: policy %s is not supported", errValidation, value)
+	}
+
+	return &policy, nil
+}
+
+// URL keeps the accepted url string as is, so what is stored is exactly what is resolved.
+// Its canonical form is what equivalent urls are compared by.
 type URL struct {
-	scheme   string
-	hostname string
-	path     string
+	value             string
+	canonical         string
+	canonicalHostname string
+	scheme            string
+	hostname          string
+	port              string
+	path              string
+	rawQuery          string
+	fragment          string
 }
 
 func NewURL(urlString string) (*URL, error) {
+	return NewURLWithUserinfoPolicy(urlString, UserinfoReject)
+}
+
+func NewURLWithUserinfoPolicy(urlString string, userinfoPolicy UserinfoPolicy) (*URL, error) {
+	return NewURLWithPolicies(urlString, userinfoPolicy, CanonicalizationPolicy{})
+}
+
+func NewURLWithPolicies(
+	urlString string,
+	userinfoPolicy UserinfoPolicy,
+	canonicalizationPolicy CanonicalizationPolicy,
+) (*URL, error) {
 	if len(urlString) < minURLLen || maxURLLen <= len(urlString) {
 		return nil, fmt.Errorf(
 			"%w NewURL: urlString %s is out of range: its len must be included in %d .. %d",
@@ -27,7 +72,11 @@ func NewURL(urlString string) (*URL, error) {
 		)
 	}
 
-	parsed, err := url.ParseRequestURI(urlString)
+	if strings.ContainsAny(urlString, " \t\r\n") {
+		return nil, fmt.Errorf("%w NewURL: urlString must not contain whitespace", errValidation)
+	}
+
+	parsed, err := url.Parse(urlString)
 	if err != nil {
 		return nil, fmt.Errorf("%w NewURL: failed to parse: %v", errValidation, err)
 	}
@@ -36,11 +85,36 @@ func NewURL(urlString string) (*URL, error) {
 		return nil, fmt.Errorf("%w NewURL: scheme %s is not supported", errValidation, parsed.Scheme)
 	}
 
-	return &URL{scheme: parsed.Scheme, hostname: parsed.Hostname(), path: parsed.Path}, nil
+	if parsed.Opaque != "" || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("%w NewURL: url must be absolute and have a host", errValidation)
+	}
+
+	value := urlString
+	if parsed.User != nil {
+		switch userinfoPolicy {
+		case UserinfoStrip:
+			parsed.User = nil
+			value = parsed.String()
+		case UserinfoReject:
+			return nil, fmt.Errorf("%w NewURL: url must not contain credentials", errValidation)
+		}
+	}
+
+	return &URL{
+		value:             value,
+		canonical:         canonicalize(parsed, canonicalizationPolicy),
+		canonicalHostname: canonicalHostname(parsed.Hostname()),
+		scheme:            parsed.Scheme,
+		hostname:          parsed.Hostname(),
+		port:              parsed.Port(),
+		path:              parsed.Path,
+		rawQuery:          parsed.RawQuery,
+		fragment:          parsed.EscapedFragment(),
+	}, nil
 }
 
 func (u *URL) String() string {
-	return fmt.Sprintf("%s://%s%s", u.scheme, u.hostname, u.path)
+	return u.value
 }
 
 func (u *URL) Hostname() string {
@@ -51,6 +125,59 @@ func (u *URL) Scheme() string {
 	return u.scheme
 }
 
+func (u *URL) Port() string {
+	return u.port
+}
+
 func (u *URL) Path() string {
 	return u.path
 }
+
+func (u *URL) RawQuery() string {
+	return u.rawQuery
+}
+
+func (u *URL) Fragment() string {
+	return u.fragment
+}
+
+// Canonical is the spelling shared by all urls equivalent to this one, see canonicalize.
+func (u *URL) Canonical() string {
+	return u.canonical
+}
+
+// CanonicalHostname is the lowercase, punycode host without brackets, what policies match hosts by.
+func (u *URL) CanonicalHostname() string {
+	return u.canonicalHostname
+}
+
+// Fingerprint identifies urls with the same canonical form.
+func (u *URL) Fingerprint() []byte {
+	sum := sha256.Sum256([]byte(u.canonical))
+
+	return sum[:]
+}
+
+// LegacyNormalized is how urls were compared before canonical forms: lowercase host, no default port and "/"
+// for an empty path. Deterministic keys claimed back then are still found by it.
+func (u *URL) LegacyNormalized() string {
+	host := strings.ToLower(u.hostname)
+	isDefaultPort := (u.scheme == "http" && u.port == "80") || (u.scheme == "https" && u.port == "443")
+	if u.port != "" && !isDefaultPort {
+		host = net.JoinHostPort(host, u.port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	path := u.path
+	if path == "" {
+		path = "/"
+	}
+
+	normalized := url.URL{Scheme: u.scheme, Host: host, Path: path, RawQuery: u.rawQuery}
+	if u.fragment != "" {
+		return normalized.String() + "#" + u.fragment
+	}
+
+	return normalized.String()
+}
@@ -0,0 +1,231 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// CanonicalizationPolicy holds the optional steps of canonicalization. The zero value sorts nothing and strips nothing.
+type CanonicalizationPolicy struct {
+	sortQuery bool
+	// strippedParams are exact query parameter names, or prefixes when they end with "*".
+	strippedParams []string
+}
+
+func NewCanonicalizationPolicy(sortQuery bool, strippedParams []string) (*CanonicalizationPolicy, error) {
+	for _, param := range strippedParams {
+		if strings.TrimSuffix(param, "*") == "" {
+			return nil, fmt.Errorf("%w NewCanonicalizationPolicy: stripped param %q is empty", errValidation, param)
+		}
+	}
+
+	return &CanonicalizationPolicy{sortQuery: sortQuery, strippedParams: slices.Clone(strippedParams)}, nil
+}
+
+// canonicalizationVersion changes whenever canonicalize spells some url differently than before.
+const canonicalizationVersion = "1"
+
+// ID names the canonical forms this policy produces, url hashes made under another ID have to be made again.
+func (p CanonicalizationPolicy) ID() string {
+	return fmt.Sprintf(
+		"v%s;sort=%t;strip=%s",
+		canonicalizationVersion,
+		p.sortQuery,
+		strings.Join(slices.Sorted(slices.Values(p.strippedParams)), ","),
+	)
+}
+
+func (p CanonicalizationPolicy) isStripped(name string) bool {
+	for _, param := range p.strippedParams {
+		if prefix, isPrefix := strings.CutSuffix(param, "*"); isPrefix {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == param {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalize spells equivalent urls the same way: lowercase scheme and host, punycode for IDN hosts,
+// no default port, percent-encoding only where needed with uppercase hex, no dot segments and "/" for an
+// empty path. The query is sorted and stripped of tracking parameters only when the policy asks for it.
+func canonicalize(parsed *url.URL, policy CanonicalizationPolicy) string {
+	scheme := strings.ToLower(parsed.Scheme)
+
+	host := canonicalHostname(parsed.Hostname())
+	port := parsed.Port()
+	isDefaultPort := (scheme == "http" && port == "80") || (scheme == "https" && port == "443")
+	if port != "" && !isDefaultPort {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	path := removeDotSegments(normalizePercentEncoding(parsed.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+
+	canonical := scheme + "://" + host + path
+	if query := canonicalQuery(parsed.RawQuery, policy); query != "" {
+		canonical += "?" + query
+	}
+	if fragment := normalizePercentEncoding(parsed.EscapedFragment()); fragment != "" {
+		canonical += "#" + fragment
+	}
+
+	return canonical
+}
+
+// canonicalHostname falls back to the lowercase host when it is not a valid IDN, such hosts were accepted before.
+func canonicalHostname(hostname string) string {
+	host := strings.ToLower(hostname)
+	if isASCII(host) {
+		return host
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return host
+	}
+
+	return ascii
+}
+
+func canonicalQuery(rawQuery string, policy CanonicalizationPolicy) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		param = normalizePercentEncoding(param)
+		if 0 < len(policy.strippedParams) {
+			name, _, _ := strings.Cut(param, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil {
+				name = unescaped
+			}
+			if policy.isStripped(name) {
+				continue
+			}
+		}
+		kept = append(kept, param)
+	}
+
+	if policy.sortQuery {
+		// Stable, so repeated parameters keep their order.
+		slices.SortStableFunc(kept, func(a, b string) int {
+			nameA, _, _ := strings.Cut(a, "=")
+			nameB, _, _ := strings.Cut(b, "=")
+
+			return strings.Compare(nameA, nameB)
+		})
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// normalizePercentEncoding decodes escaped unreserved characters, uppercases the hex of the other escapes
+// and escapes bytes outside of ascii.
+func normalizePercentEncoding(value string) string {
+	const upperHex = "0123456789ABCDEF"
+
+	var builder strings.Builder
+	builder.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		char := value[i]
+		switch {
+		case char == '%' && i+2 < len(value) && isHex(value[i+1]) && isHex(value[i+2]):
+			decoded := unhex(value[i+1])<<4 | unhex(value[i+2])
+			if isUnreserved(decoded) {
+				builder.WriteByte(decoded)
+			} else {
+				builder.WriteByte('%')
+				builder.WriteByte(upperHex[decoded>>4])
+				builder.WriteByte(upperHex[decoded&0x0f])
+			}
+			i += 2
+		case 0x80 <= char:
+			builder.WriteByte('%')
+			builder.WriteByte(upperHex[char>>4])
+			builder.WriteByte(upperHex[char&0x0f])
+		default:
+			builder.WriteByte(char)
+		}
+	}
+
+	return builder.String()
+}
+
+// removeDotSegments resolves "." and ".." segments as described in RFC 3986 section 5.2.4.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	output := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		isLast := i == len(segments)-1
+		switch segment {
+		case ".":
+			if isLast {
+				output = append(output, "")
+			}
+		case "..":
+			// The leading empty segment stands for the root, it is never removed.
+			if 1 < len(output) {
+				output = output[:len(output)-1]
+			}
+			if isLast {
+				output = append(output, "")
+			}
+		default:
+			output = append(output, segment)
+		}
+	}
+
+	return strings.Join(output, "/")
+}
+
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if 0x80 <= value[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isUnreserved(char byte) bool {
+	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || '0' <= char && char <= '9' ||
+		char == '-' || char == '.' || char == '_' || char == '~'
+}
+
+func isHex(char byte) bool {
+	return '0' <= char && char <= '9' || 'a' <= char && char <= 'f' || 'A' <= char && char <= 'F'
+}
+
+func unhex(char byte) byte {
+	switch {
+	case '0' <= char && char <= '9':
+		return char - '0'
+	case 'a' <= char && char <= 'f':
+		return char - 'a' + 10
+	default:
+		return char - 'A' + 10
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	t.Parallel()
+
+	sortAndStrip, err := NewCanonicalizationPolicy(true, []string{"utm_*", "fbclid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		policy CanonicalizationPolicy
+		want   string
+	}{
+		{
+			name: "lowercase scheme and host, default port and empty path",
+			url:  "HTTP://Example.COM:80",
+			want: "http://example.com/",
+		},
+		{
+			name: "other ports are kept",
+			url:  "https://example.com:8443/",
+			want: "https://example.com:8443/",
+		},
+		{
+			name: "dot segments",
+			url:  "https://example.com:443/a/./b/../c",
+			want: "https://example.com/a/c",
+		},
+		{
+			name: "dot segments never climb above the root",
+			url:  "https://example.com/../../a/.",
+			want: "https://example.com/a/",
+		},
+		{
+			name: "unreserved escapes are decoded, others get uppercase hex",
+			url:  "https://example.com/%7euser/%e2%82%ac?q=%2f",
+			want: "https://example.com/~user/%E2%82%AC?q=%2F",
+		},
+		{
+			name: "IDN host becomes punycode and non ascii path is escaped",
+			url:  "https://bücher.example/ü",
+			want: "https://xn--bcher-kva.example/%C3%BC",
+		},
+		{
+			name: "ipv6 host without default port",
+			url:  "http://[::1]:80/x",
+			want: "http://[::1]/x",
+		},
+		{
+			name: "query is kept as is without a policy",
+			url:  "https://example.com/?b=2&utm_source=x&a=1&&fbclid=y#Frag%7e",
+			want: "https://example.com/?b=2&utm_source=x&a=1&fbclid=y#Frag~",
+		},
+		{
+			name:   "query is sorted stably and stripped by the policy",
+			url:    "https://example.com/?b=2&utm_source=x&a=1&fbclid=y&a=0",
+			policy: *sortAndStrip,
+			want:   "https://example.com/?a=1&a=0&b=2",
+		},
+		{
+			name:   "stripped names are matched unescaped",
+			url:    "https://example.com/?utm%5Fmedium=x&id=1",
+			policy: *sortAndStrip,
+			want:   "https://example.com/?id=1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parsed, parseErr := url.Parse(tt.url)
+			if parseErr != nil {
+				t.Fatal(parseErr)
+			}
+			if got := canonicalize(parsed, tt.policy); got != tt.want {
+				t.Errorf("canonicalize(%s) = %s, want %s", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizationPolicyID(t *testing.T) {
+	t.Parallel()
+
+	policy, err := NewCanonicalizationPolicy(true, []string{"utm_*", "fbclid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reordered, err := NewCanonicalizationPolicy(true, []string{"fbclid", "utm_*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.ID() != reordered.ID() {
+		t.Errorf("ID() depends on the order of stripped params: %s != %s", policy.ID(), reordered.ID())
+	}
+	if policy.ID() == (CanonicalizationPolicy{}).ID() {
+		t.Errorf("ID() of different policies is the same: %s", policy.ID())
+	}
+}
@@ -0,0 +1,6 @@
+package editLink
+
+type Config struct {
+	// OwnerTokenSecret signs the tokens owners edit their links with, links can not be edited while it is empty.
+	OwnerTokenSecret string
+}
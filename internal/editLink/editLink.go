@@ -0,0 +1,259 @@
+package editLink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+var (
+	errValidation     = errors.New("validation")
+	errNotFound       = errors.New("not found")
+	errUnauthorized   = errors.New("unauthorized")
+	errForbidden      = errors.New("forbidden")
+	errConflict       = errors.New("conflict")
+	errNotSavedYet    = errors.New("link is still being saved, retry shortly")
+	errInfrastructure = errors.New("infrastructure")
+	errApplication    = errors.New("application")
+)
+
+type Dependencies struct {
+	LinkHostRegistry core.LinkHostRegistry
+	LinkAliasStore   LinkAliasStore
+	PendingLinks     PendingLinks
+	LinkVersionStore LinkVersionStore
+}
+
+// DestinationWasChanged is the version a link points at after its destination changed.
+type DestinationWasChanged struct {
+	ShortURL string
+	Version  core.LinkVersionDto
+}
+
+// LinkVersions are the destinations a link had, oldest first, the last one is current.
+type LinkVersions struct {
+	ShortURL string
+	Versions []core.LinkVersionDto
+}
+
+// ChangeDestinationFn is false when the link does not exist.
+type ChangeDestinationFn = func(context.Context, ChangeDestinationRequest) (*DestinationWasChanged, bool, error)
+
+// ListVersionsFn is false when the link does not exist.
+type ListVersionsFn = func(context.Context, ListVersionsRequest) (*LinkVersions, bool, error)
+
+// RestoreVersionFn makes an older destination current again as a new version, the history is kept.
+// It is false when the link does not exist.
+type RestoreVersionFn = func(context.Context, RestoreVersionRequest) (*DestinationWasChanged, bool, error)
+
+func NewChangeDestinationFn(
+	logger *appLogger.AppLogger,
+	dependencies Dependencies,
+	linkKeyCodec core.LinkKeyCodec,
+	policies Policies,
+) ChangeDestinationFn {
+	return func(ctx context.Context, request ChangeDestinationRequest) (*DestinationWasChanged, bool, error) {
+		ref, err := newLinkRef(request, dependencies.LinkHostRegistry)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: invalid link: %v", errValidation, err)
+		}
+		author, err := newAuthor(request.Author())
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %v", errValidation, err)
+		}
+		destinationURL, err := newDestinationURL(request.OriginalUrl(), ref.host, policies)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %w", errValidation, err)
+		}
+
+		linkKey, isFound, err := findLinkKey(ctx, dependencies, linkKeyCodec, *ref)
+		if err != nil || !isFound {
+			return nil, false, err
+		}
+
+		return changeDestination(ctx, logger, dependencies, *ref, *linkKey, *destinationURL, author, nil)
+	}
+}
+
+func NewListVersionsFn(
+	dependencies Dependencies,
+	linkKeyCodec core.LinkKeyCodec,
+) ListVersionsFn {
+	return func(ctx context.Context, request ListVersionsRequest) (*LinkVersions, bool, error) {
+		ref, err := newLinkRef(request, dependencies.LinkHostRegistry)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: invalid link: %v", errValidation, err)
+		}
+
+		linkKey, isFound, err := findLinkKey(ctx, dependencies, linkKeyCodec, *ref)
+		if err != nil || !isFound {
+			return nil, false, err
+		}
+
+		versions, isFound, err := listVersions(ctx, dependencies, *ref, *linkKey, request.Owner())
+		if err != nil || !isFound {
+			return nil, false, err
+		}
+
+		return &LinkVersions{ShortURL: ref.ShortURL(), Versions: versions}, true, nil
+	}
+}
+
+func NewRestoreVersionFn(
+	logger *appLogger.AppLogger,
+	dependencies Dependencies,
+	linkKeyCodec core.LinkKeyCodec,
+	policies Policies,
+) RestoreVersionFn {
+	return func(ctx context.Context, request RestoreVersionRequest) (*DestinationWasChanged, bool, error) {
+		ref, err := newLinkRef(request, dependencies.LinkHostRegistry)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: invalid link: %v", errValidation, err)
+		}
+		author, err := newAuthor(request.Author())
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: %v", errValidation, err)
+		}
+
+		linkKey, isFound, err := findLinkKey(ctx, dependencies, linkKeyCodec, *ref)
+		if err != nil || !isFound {
+			return nil, false, err
+		}
+
+		versions, isFound, err := listVersions(ctx, dependencies, *ref, *linkKey, author)
+		if err != nil || !isFound {
+			return nil, false, err
+		}
+
+		var restored *core.LinkVersionDto
+		for i := range versions {
+			if versions[i].Version == request.Version() {
+				restored = &versions[i]
+
+				break
+			}
+		}
+		if restored == nil {
+			return nil, false, fmt.Errorf("%w: link has no version %d", errNotFound, request.Version())
+		}
+
+		// The destination policy may have changed since, a restored url has to pass it again.
+		destinationURL, err := newDestinationURL(restored.DestinationURL.Value, ref.host, policies)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: version %d: %w", errValidation, restored.Version, err)
+		}
+
+		restoredFrom := restored.Version
+
+		return changeDestination(ctx, logger, dependencies, *ref, *linkKey, *destinationURL, author, &restoredFrom)
+	}
+}
+
+// findLinkKey is false when the alias is not claimed on the host.
+func findLinkKey(
+	ctx context.Context,
+	dependencies Dependencies,
+	linkKeyCodec core.LinkKeyCodec,
+	ref linkRef,
+) (*core.LinkKey, bool, error) {
+	if ref.alias != nil {
+		keyDto, isClaimed, err := dependencies.LinkAliasStore.FindKey(ctx, ref.host.IntoDto(), ref.alias.IntoDto())
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: failed to resolve alias: %v", errInfrastructure, err)
+		}
+		if !isClaimed {
+			return nil, false, nil
+		}
+
+		linkKey, err := keyDto.IntoDomain()
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: failed to resolve alias: %v", errApplication, err)
+		}
+
+		return linkKey, true, nil
+	}
+
+	linkKey, err := ref.slug.IntoLinkKey(linkKeyCodec)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: invalid link: %v", errValidation, err)
+	}
+
+	return linkKey, true, nil
+}
+
+func listVersions(
+	ctx context.Context,
+	dependencies Dependencies,
+	ref linkRef,
+	linkKey core.LinkKey,
+	owner string,
+) ([]core.LinkVersionDto, bool, error) {
+	versions, isFound, err := dependencies.LinkVersionStore.ListVersions(
+		ctx,
+		linkKey.IntoDto(),
+		ref.host.IntoDto(),
+		owner,
+	)
+	if errors.Is(err, core.ErrNotLinkOwner) {
+		return nil, false, fmt.Errorf("%w: %v", errForbidden, err)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: failed to list versions: %v", errInfrastructure, err)
+	}
+
+	return versions, isFound, nil
+}
+
+func changeDestination(
+	ctx context.Context,
+	logger *appLogger.AppLogger,
+	dependencies Dependencies,
+	ref linkRef,
+	linkKey core.LinkKey,
+	destinationURL core.DestinationURL,
+	author string,
+	restoredFrom *int,
+) (*DestinationWasChanged, bool, error) {
+	// A link encoded on this instance moments ago may not be stored yet, there is nothing to change then.
+	if pending, isPending := dependencies.PendingLinks.FindOne(linkKey.IntoDto()); isPending &&
+		pending.Host.Hostname == ref.host.Hostname() {
+		return nil, false, fmt.Errorf("%w: %w", errConflict, errNotSavedYet)
+	}
+
+	version, isFound, err := dependencies.LinkVersionStore.ChangeDestination(
+		ctx,
+		core.LinkDestinationChangeDto{
+			Key:            linkKey.IntoDto(),
+			Host:           ref.host.IntoDto(),
+			DestinationURL: destinationURL.IntoDto(),
+			URLFingerprint: destinationURL.Fingerprint(),
+			Author:         author,
+			RestoredFrom:   restoredFrom,
+		},
+	)
+	if errors.Is(err, core.ErrImmutableLink) {
+		return nil, false, fmt.Errorf("%w: %v", errConflict, err)
+	}
+	if errors.Is(err, core.ErrNotLinkOwner) {
+		return nil, false, fmt.Errorf("%w: %v", errForbidden, err)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: failed to change destination: %v", errInfrastructure, err)
+	}
+	if !isFound {
+		return nil, false, nil
+	}
+
+	logger.InfoContext(
+		ctx,
+		"link destination changed",
+		"shortUrl", ref.ShortURL(),
+		"version", version.Version,
+		"author", author,
+	)
+
+	return &DestinationWasChanged{ShortURL: ref.ShortURL(), Version: *version}, true, nil
+}
@@ -0,0 +1,332 @@
+package editLink
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/beard-programmer/shortorg/internal/httpEncoder"
+	"github.com/go-chi/chi/v5"
+)
+
+// linkAPIRequest names the link by its slug or alias in the path and its host in the "host" query parameter,
+// the default host when it is missing.
+type linkAPIRequest struct {
+	host *string
+	path string
+}
+
+func (r linkAPIRequest) Host() *string {
+	return r.host
+}
+
+func (r linkAPIRequest) Path() string {
+	return r.path
+}
+
+type listVersionsAPIRequest struct {
+	linkAPIRequest
+	owner string
+}
+
+func (r listVersionsAPIRequest) Owner() string {
+	return r.owner
+}
+
+func newLinkAPIRequest(r *http.Request) linkAPIRequest {
+	request := linkAPIRequest{path: chi.URLParam(r, "slug")}
+	if r.URL.Query().Has("host") {
+		host := r.URL.Query().Get("host")
+		request.host = &host
+	}
+
+	return request
+}
+
+// authenticateOwner is the owner named by the bearer token of the request.
+func authenticateOwner(r *http.Request, ownerTokens OwnerTokenSigner) (string, error) {
+	token, isBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !isBearer {
+		return "", fmt.Errorf("%w: owner token is missing", errUnauthorized)
+	}
+
+	owner, isValid := ownerTokens.OwnerOf(token)
+	if !isValid {
+		return "", fmt.Errorf("%w: owner token is invalid", errUnauthorized)
+	}
+
+	return owner, nil
+}
+
+// ChangeDestinationAPIRequest is made by the owner of the link, who is recorded as the author of the change.
+type ChangeDestinationAPIRequest struct {
+	linkAPIRequest
+	URL    string `json:"url"`
+	author string
+}
+
+func (r ChangeDestinationAPIRequest) OriginalUrl() string {
+	return r.URL
+}
+
+func (r ChangeDestinationAPIRequest) Author() string {
+	return r.author
+}
+
+type RestoreVersionAPIRequest struct {
+	linkAPIRequest
+	version int
+	author  string
+}
+
+func (r RestoreVersionAPIRequest) Version() int {
+	return r.version
+}
+
+func (r RestoreVersionAPIRequest) Author() string {
+	return r.author
+}
+
+type OwnerTokenAPIResponse struct {
+	Owner string `json:"owner"`
+	Token string `json:"token"`
+}
+
+type LinkVersionAPIResponse struct {
+	Version      int       `json:"version"`
+	URL          string    `json:"url"`
+	Author       string    `json:"author"`
+	RestoredFrom *int      `json:"restoredFrom,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type DestinationAPIResponse struct {
+	ShortURL string                 `json:"shortUrl"`
+	Version  LinkVersionAPIResponse `json:"version"`
+}
+
+type VersionsAPIResponse struct {
+	ShortURL string                   `json:"shortUrl"`
+	Versions []LinkVersionAPIResponse `json:"versions"`
+}
+
+type APIErrResponse struct {
+	httpStatusCode int
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+	// RejectionCode is set for DestinationRejectedError, see core.DestinationRejection.
+	RejectionCode string `json:"rejectionCode,omitempty"`
+}
+
+func newLinkVersionAPIResponse(version core.LinkVersionDto) LinkVersionAPIResponse {
+	return LinkVersionAPIResponse{
+		Version:      version.Version,
+		URL:          version.DestinationURL.Value,
+		Author:       version.Author,
+		RestoredFrom: version.RestoredFrom,
+		CreatedAt:    version.CreatedAt,
+	}
+}
+
+// IssueOwnerTokenHTTPHandlerFunc hands out the token of the owner in the path, it belongs behind admin auth.
+func IssueOwnerTokenHTTPHandlerFunc(ownerTokens OwnerTokenSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner := chi.URLParam(r, "owner")
+		token, err := ownerTokens.Issue(owner)
+		if err != nil {
+			handleError(w, r, errors.Join(errValidation, err))
+
+			return
+		}
+
+		httpEncoder.EncodeResponse(w, r, http.StatusOK, OwnerTokenAPIResponse{Owner: owner, Token: token})
+	}
+}
+
+func ChangeDestinationHTTPHandlerFunc(
+	logger *appLogger.AppLogger,
+	ownerTokens OwnerTokenSigner,
+	fn ChangeDestinationFn,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner, err := authenticateOwner(r, ownerTokens)
+		if err != nil {
+			handleError(w, r, err)
+
+			return
+		}
+
+		request, err := httpEncoder.DecodeRequest[ChangeDestinationAPIRequest](r)
+		if err != nil {
+			handleError(w, r, errors.Join(errValidation, err))
+
+			return
+		}
+		request.linkAPIRequest = newLinkAPIRequest(r)
+		request.author = owner
+
+		changed, isFound, err := fn(r.Context(), request)
+		respondWithChange(w, r, logger, changed, isFound, err)
+	}
+}
+
+func RestoreVersionHTTPHandlerFunc(
+	logger *appLogger.AppLogger,
+	ownerTokens OwnerTokenSigner,
+	fn RestoreVersionFn,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner, err := authenticateOwner(r, ownerTokens)
+		if err != nil {
+			handleError(w, r, err)
+
+			return
+		}
+
+		version, err := strconv.Atoi(chi.URLParam(r, "version"))
+		if err != nil || version < 1 {
+			handleError(w, r, errors.Join(errValidation, errors.New("version must be a positive number")))
+
+			return
+		}
+
+		request, err := httpEncoder.DecodeRequest[RestoreVersionAPIRequest](r)
+		if err != nil {
+			handleError(w, r, errors.Join(errValidation, err))
+
+			return
+		}
+		request.linkAPIRequest = newLinkAPIRequest(r)
+		request.version = version
+		request.author = owner
+
+		changed, isFound, err := fn(r.Context(), request)
+		respondWithChange(w, r, logger, changed, isFound, err)
+	}
+}
+
+func ListVersionsHTTPHandlerFunc(
+	logger *appLogger.AppLogger,
+	ownerTokens OwnerTokenSigner,
+	fn ListVersionsFn,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		owner, err := authenticateOwner(r, ownerTokens)
+		if err != nil {
+			handleError(w, r, err)
+
+			return
+		}
+
+		linkVersions, isFound, err := fn(
+			r.Context(),
+			listVersionsAPIRequest{linkAPIRequest: newLinkAPIRequest(r), owner: owner},
+		)
+		if err != nil {
+			logError(r, logger, err)
+			handleError(w, r, err)
+
+			return
+		}
+		if !isFound {
+			handleError(w, r, errors.Join(errNotFound, errors.New("link does not exist")))
+
+			return
+		}
+
+		response := VersionsAPIResponse{
+			ShortURL: linkVersions.ShortURL,
+			Versions: make([]LinkVersionAPIResponse, 0, len(linkVersions.Versions)),
+		}
+		for _, version := range linkVersions.Versions {
+			response.Versions = append(response.Versions, newLinkVersionAPIResponse(version))
+		}
+		httpEncoder.EncodeResponse(w, r, http.StatusOK, response)
+	}
+}
+
+func respondWithChange(
+	w http.ResponseWriter,
+	r *http.Request,
+	logger *appLogger.AppLogger,
+	changed *DestinationWasChanged,
+	isFound bool,
+	err error,
+) {
+	if err != nil {
+		logError(r, logger, err)
+		handleError(w, r, err)
+
+		return
+	}
+	if !isFound {
+		handleError(w, r, errors.Join(errNotFound, errors.New("link does not exist")))
+
+		return
+	}
+
+	httpEncoder.EncodeResponse(
+		w,
+		r,
+		http.StatusOK,
+		DestinationAPIResponse{ShortURL: changed.ShortURL, Version: newLinkVersionAPIResponse(changed.Version)},
+	)
+}
+
+func logError(r *http.Request, logger *appLogger.AppLogger, err error) {
+	if errors.Is(err, errInfrastructure) || errors.Is(err, errApplication) {
+		logger.ErrorContext(r.Context(), "editLink: request failed", "err", err)
+	}
+}
+
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		apiErr    APIErrResponse
+		rejection *core.DestinationRejection
+	)
+
+	switch {
+	case errors.As(err, &rejection):
+		apiErr = APIErrResponse{
+			Code:           "DestinationRejectedError",
+			Message:        err.Error(),
+			RejectionCode:  rejection.Code,
+			httpStatusCode: http.StatusBadRequest,
+		}
+	case errors.Is(err, errValidation):
+		apiErr = APIErrResponse{Code: "ValidationError", Message: err.Error(), httpStatusCode: http.StatusBadRequest}
+	case errors.Is(err, errUnauthorized):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		apiErr = APIErrResponse{Code: "UnauthorizedError", Message: err.Error(), httpStatusCode: http.StatusUnauthorized}
+	case errors.Is(err, errForbidden):
+		apiErr = APIErrResponse{Code: "ForbiddenError", Message: err.Error(), httpStatusCode: http.StatusForbidden}
+	case errors.Is(err, errNotFound):
+		apiErr = APIErrResponse{Code: "NotFoundError", Message: err.Error(), httpStatusCode: http.StatusNotFound}
+	case errors.Is(err, errConflict):
+		if errors.Is(err, errNotSavedYet) {
+			w.Header().Set("Retry-After", "1")
+		}
+		apiErr = APIErrResponse{Code: "ConflictError", Message: err.Error(), httpStatusCode: http.StatusConflict}
+	case errors.Is(err, errApplication):
+		apiErr = APIErrResponse{
+			Code:           "ApplicationError",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusUnprocessableEntity,
+		}
+	case errors.Is(err, errInfrastructure):
+		apiErr = APIErrResponse{
+			Code:           "InfrastructureError",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusServiceUnavailable,
+		}
+	default:
+		apiErr = APIErrResponse{Code: "UnknownError", Message: err.Error(), httpStatusCode: http.StatusInternalServerError}
+	}
+
+	httpEncoder.EncodeResponse(w, r, apiErr.httpStatusCode, apiErr)
+}
@@ -0,0 +1,60 @@
+package editLink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	minOwnerTokenSecretSize = 16
+	ownerTokenSeparator     = "."
+)
+
+// OwnerTokenSigner issues the bearer tokens links are edited with. A token names its owner and only edits
+// the links encoded with that owner, the owner is recorded as the author of every change made with it.
+type OwnerTokenSigner struct {
+	secret []byte
+}
+
+func NewOwnerTokenSigner(cfg Config) (*OwnerTokenSigner, error) {
+	if len(cfg.OwnerTokenSecret) < minOwnerTokenSecretSize {
+		return nil, fmt.Errorf("NewOwnerTokenSigner: secret must be at least %d bytes", minOwnerTokenSecretSize)
+	}
+
+	return &OwnerTokenSigner{secret: []byte(cfg.OwnerTokenSecret)}, nil
+}
+
+func (s OwnerTokenSigner) Issue(owner string) (string, error) {
+	owner, err := newAuthor(owner)
+	if err != nil {
+		return "", err
+	}
+
+	return owner + ownerTokenSeparator + base64.RawURLEncoding.EncodeToString(s.sign(owner)), nil
+}
+
+// OwnerOf is false for tokens this signer did not issue. Owners may contain dots, signatures never do.
+func (s OwnerTokenSigner) OwnerOf(token string) (string, bool) {
+	separatorAt := strings.LastIndex(token, ownerTokenSeparator)
+	if separatorAt <= 0 {
+		return "", false
+	}
+
+	owner := token[:separatorAt]
+	signature, err := base64.RawURLEncoding.DecodeString(token[separatorAt+1:])
+	if err != nil || !hmac.Equal(signature, s.sign(owner)) {
+		return "", false
+	}
+
+	return owner, true
+}
+
+func (s OwnerTokenSigner) sign(owner string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(owner))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,29 @@
+package editLink
+
+import (
+	"context"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+type LinkVersionStore interface {
+	ChangeDestination(context.Context, core.LinkDestinationChangeDto) (*core.LinkVersionDto, bool, error)
+	// ListVersions fails with core.ErrNotLinkOwner for anyone but the owner of the link.
+	ListVersions(ctx context.Context, key core.LinkKeyDto, host core.LinkHostDto, owner string) (
+		[]core.LinkVersionDto,
+		bool,
+		error,
+	)
+}
+
+type LinkAliasStore interface {
+	FindKey(context.Context, core.LinkHostDto, core.LinkAliasDto) (*core.LinkKeyDto, bool, error)
+}
+
+type PendingLinks interface {
+	FindOne(core.LinkKeyDto) (*core.LinkDTO, bool)
+}
+
+type DestinationPolicy interface {
+	Evaluate(*core.DestinationURL) *core.DestinationRejection
+}
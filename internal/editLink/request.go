@@ -0,0 +1,108 @@
+package editLink
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+type linkRequest interface {
+	Host() *string
+	Path() string
+}
+
+type ChangeDestinationRequest interface {
+	linkRequest
+	OriginalUrl() string
+	Author() string
+}
+
+// ListVersionsRequest is made by the owner of the link, past destinations may be behind a password or a lifetime.
+type ListVersionsRequest interface {
+	linkRequest
+	Owner() string
+}
+
+type RestoreVersionRequest interface {
+	linkRequest
+	Version() int
+	Author() string
+}
+
+const maxAuthorSize = 64
+
+var authorPattern = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// linkRef points either at a generated slug or at a custom alias on a host, never both.
+type linkRef struct {
+	slug  *core.LinkSlug
+	alias *core.LinkAlias
+	host  core.LinkHost
+}
+
+func (r linkRef) ShortURL() string {
+	if r.alias != nil {
+		return fmt.Sprintf("https://%s/%s", r.host.Hostname(), r.alias.Value())
+	}
+
+	return fmt.Sprintf("https://%s/%s", r.host.Hostname(), r.slug.Value())
+}
+
+func newLinkRef(request linkRequest, linkHostRegistry core.LinkHostRegistry) (*linkRef, error) {
+	linkHost, err := core.NewLinkHost(request.Host(), linkHostRegistry)
+	if err != nil {
+		return nil, err
+	}
+
+	linkSlug, err := core.NewLinkSlug(request.Path())
+	if err == nil {
+		return &linkRef{slug: linkSlug, host: *linkHost}, nil
+	}
+
+	linkAlias, aliasErr := core.NewLinkAlias(request.Path())
+	if aliasErr != nil {
+		return nil, errors.Join(err, aliasErr)
+	}
+
+	return &linkRef{alias: linkAlias, host: *linkHost}, nil
+}
+
+func newAuthor(value string) (string, error) {
+	if maxAuthorSize < len(value) || !authorPattern.MatchString(value) {
+		return "", fmt.Errorf(
+			"author must be 1 to %d latin letters, digits, dots, dashes, underscores and @",
+			maxAuthorSize,
+		)
+	}
+
+	return value, nil
+}
+
+// Policies are what a new destination is validated against, the same ones as when encoding. Destination may be
+// nil, every destination is accepted then.
+type Policies struct {
+	Userinfo         core.UserinfoPolicy
+	Canonicalization core.CanonicalizationPolicy
+	Destination      DestinationPolicy
+}
+
+func newDestinationURL(value string, linkHost core.LinkHost, policies Policies) (*core.DestinationURL, error) {
+	destinationURL, err := core.NewURLWithPolicies(value, policies.Userinfo, policies.Canonicalization)
+	if err != nil {
+		return nil, fmt.Errorf("parsing destination url failed: %w", err)
+	}
+
+	if policies.Destination != nil {
+		if rejection := policies.Destination.Evaluate(destinationURL); rejection != nil {
+			return nil, rejection
+		}
+	}
+
+	if destinationURL.Hostname() == linkHost.Hostname() {
+		return nil, fmt.Errorf("destination url cannot have same host as link")
+	}
+
+	return destinationURL, nil
+}
@@ -0,0 +1,131 @@
+package encode
+
+import (
+	"context"
+	"sync"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// BatchFn encodes every request on its own, a failed item does not fail the others.
+// Results are in the order of the requests.
+type BatchFn = func(context.Context, []EncodingRequest) []BatchResult
+
+type BatchResult struct {
+	URLWasEncoded *URLWasEncoded
+	Err           error
+}
+
+const defaultBatchConcurrency = 8
+
+// NewEncodeBatchFn runs the items through encodeFn. Keys for the items that need a sequence key are issued
+// for the whole batch up front, items run out of them fall back to the key store one by one.
+func NewEncodeBatchFn(
+	logger *appLogger.AppLogger,
+	encodeFn Fn,
+	linkKeyStore LinkKeyStore,
+	batchLinkKeyStore BatchLinkKeyStore,
+	cfg Config,
+) BatchFn {
+	deterministicHosts := make(map[string]struct{}, len(cfg.DeterministicHosts))
+	for _, host := range cfg.DeterministicHosts {
+		deterministicHosts[host] = struct{}{}
+	}
+	concurrency := cfg.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	return func(ctx context.Context, requests []EncodingRequest) []BatchResult {
+		prefetchCount := 0
+		for _, request := range requests {
+			if needsSequenceKey(request, deterministicHosts) {
+				prefetchCount++
+			}
+		}
+
+		prefetched := &prefetchedLinkKeys{linkKeyStore: linkKeyStore}
+		if 0 < prefetchCount {
+			keys, err := batchLinkKeyStore.IssueMany(ctx, prefetchCount)
+			if err != nil {
+				logger.WarnContext(ctx, "encode batch: failed to prefetch keys", "prefetched", len(keys), "err", err)
+			}
+			prefetched.keys = keys
+		}
+		ctx = context.WithValue(ctx, prefetchedLinkKeysCtxKey{}, prefetched)
+
+		results := make([]BatchResult, len(requests))
+		semaphore := make(chan struct{}, concurrency)
+		wg := sync.WaitGroup{}
+		for i, request := range requests {
+			semaphore <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-semaphore
+					wg.Done()
+				}()
+
+				urlWasEncoded, err := encodeFn(ctx, request)
+				results[i] = BatchResult{URLWasEncoded: urlWasEncoded, Err: err}
+			}()
+		}
+		wg.Wait()
+
+		if unused := prefetched.unused(); unused != 0 {
+			// Sequence keys are never handed back, unused ones only leave a gap.
+			logger.DebugContext(ctx, "encode batch: prefetched keys were not used", "count", unused)
+		}
+
+		return results
+	}
+}
+
+// needsSequenceKey guesses from the raw request, a wrong guess only costs a key or a fallback to the store.
+func needsSequenceKey(request EncodingRequest, deterministicHosts map[string]struct{}) bool {
+	if request.ReuseExisting() || request.IdempotencyKey() != nil {
+		return false
+	}
+
+	var keyMode string
+	if request.KeyMode() != nil {
+		keyMode = *request.KeyMode()
+	}
+	hostname := core.DefaultLinkHost
+	if request.Host() != nil && *request.Host() != "" {
+		hostname = *request.Host()
+	}
+
+	return resolveKeyMode(keyMode, hostname, deterministicHosts) == keyModeSequence
+}
+
+type prefetchedLinkKeysCtxKey struct{}
+
+// prefetchedLinkKeys is the LinkKeyStore of sequence keys issued for a batch.
+type prefetchedLinkKeys struct {
+	mu           sync.Mutex
+	keys         []core.LinkKey
+	linkKeyStore LinkKeyStore
+}
+
+func (p *prefetchedLinkKeys) Issue(ctx context.Context, seed core.LinkKeySeedDto) (*core.LinkKey, error) {
+	p.mu.Lock()
+	if len(p.keys) != 0 {
+		key := p.keys[0]
+		p.keys = p.keys[1:]
+		p.mu.Unlock()
+
+		return &key, nil
+	}
+	p.mu.Unlock()
+
+	return p.linkKeyStore.Issue(ctx, seed)
+}
+
+func (p *prefetchedLinkKeys) unused() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.keys)
+}
@@ -0,0 +1,178 @@
+package encode
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/httpEncoder"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	maxNDJSONLineSize = 1 << 20
+
+	defaultBatchMaxItems  = 10000
+	defaultBatchChunkSize = 500
+)
+
+// BatchAPIItemResponse is the result of one item of a batch, it has either the link or the error.
+type BatchAPIItemResponse struct {
+	Index    int             `json:"index"`
+	URL      string          `json:"url,omitempty"`
+	ShortURL string          `json:"shortUrl,omitempty"`
+	Error    *APIErrResponse `json:"error,omitempty"`
+}
+
+// BatchHttpHandlerFunc takes a JSON array of encode requests and answers with an array of their results,
+// or NDJSON in and out when the request is sent as application/x-ndjson. A JSON array may have up to maxItems,
+// NDJSON is encoded chunkSize lines at a time and has no limit.
+func BatchHttpHandlerFunc(
+	logger *appLogger.AppLogger,
+	encodeBatchFunc BatchFn,
+	maxItems int,
+	chunkSize int,
+) http.HandlerFunc {
+	if maxItems <= 0 {
+		maxItems = defaultBatchMaxItems
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultBatchChunkSize
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == ndjsonContentType {
+			streamBatch(logger, encodeBatchFunc, chunkSize, w, r)
+
+			return
+		}
+
+		rawItems, err := httpEncoder.DecodeRequest[[]json.RawMessage](r)
+		if err != nil {
+			handleError(w, r, fmt.Errorf("%w encode batch: invalid request body", errValidation))
+
+			return
+		}
+		if maxItems < len(rawItems) {
+			handleError(w, r, fmt.Errorf(
+				"%w encode batch: %d items is more than %d, send them as %s",
+				errValidation,
+				len(rawItems),
+				maxItems,
+				ndjsonContentType,
+			))
+
+			return
+		}
+
+		httpEncoder.EncodeResponse(w, r, http.StatusOK, encodeItems(r.Context(), encodeBatchFunc, rawItems, 0))
+	}
+}
+
+// streamBatch encodes NDJSON lines chunkSize at a time and writes each chunk of results as soon as it is done,
+// so neither the request nor the response is held in memory as a whole.
+func streamBatch(
+	logger *appLogger.AppLogger,
+	encodeBatchFunc BatchFn,
+	chunkSize int,
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	responseController := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	writeItems := func(items []BatchAPIItemResponse) bool {
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				logger.WarnContext(r.Context(), "encode batch: failed to write item", "err", err)
+
+				return false
+			}
+		}
+		_ = responseController.Flush()
+
+		return true
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxNDJSONLineSize)
+
+	index := 0
+	chunk := make([]json.RawMessage, 0, chunkSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		chunk = append(chunk, append(json.RawMessage(nil), line...))
+		if len(chunk) < chunkSize {
+			continue
+		}
+
+		if !writeItems(encodeItems(r.Context(), encodeBatchFunc, chunk, index)) {
+			return
+		}
+		index += len(chunk)
+		chunk = chunk[:0]
+	}
+
+	if 0 < len(chunk) {
+		if !writeItems(encodeItems(r.Context(), encodeBatchFunc, chunk, index)) {
+			return
+		}
+		index += len(chunk)
+	}
+
+	if err := scanner.Err(); err != nil {
+		apiErr := newAPIErrResponse(fmt.Errorf("%w encode batch: failed to read line: %v", errValidation, err))
+		writeItems([]BatchAPIItemResponse{{Index: index, Error: &apiErr}})
+	}
+}
+
+// encodeItems answers items that are not an encode request right away and encodes the rest as one batch.
+func encodeItems(
+	ctx context.Context,
+	encodeBatchFunc BatchFn,
+	rawItems []json.RawMessage,
+	firstIndex int,
+) []BatchAPIItemResponse {
+	responses := make([]BatchAPIItemResponse, len(rawItems))
+	requests := make([]EncodingRequest, 0, len(rawItems))
+	requestIndexes := make([]int, 0, len(rawItems))
+	for i, rawItem := range rawItems {
+		responses[i].Index = firstIndex + i
+
+		var apiRequest APIRequest
+		if err := json.Unmarshal(rawItem, &apiRequest); err != nil {
+			apiErr := newAPIErrResponse(fmt.Errorf("%w encode batch: invalid item: %v", errValidation, err))
+			responses[i].Error = &apiErr
+
+			continue
+		}
+		requests = append(requests, apiRequest)
+		requestIndexes = append(requestIndexes, i)
+	}
+
+	for j, result := range encodeBatchFunc(ctx, requests) {
+		i := requestIndexes[j]
+		if result.Err != nil {
+			apiErr := newAPIErrResponse(result.Err)
+			responses[i].Error = &apiErr
+
+			continue
+		}
+
+		response := newAPIResponse(*result.URLWasEncoded)
+		responses[i].URL = response.URL
+		responses[i].ShortURL = response.ShortURL
+	}
+
+	return responses
+}
@@ -0,0 +1,23 @@
+package encode
+
+type Config struct {
+	UserinfoPolicy     string
+	AdmissionTimeoutMs int
+	RetryAfterSeconds  int
+	// DeterministicHosts get deterministic keys unless a request asks for keyMode explicitly.
+	DeterministicHosts []string
+	// BatchConcurrency is how many items of a batch are encoded at once.
+	BatchConcurrency int
+
+	// CanonicalSortQuery and CanonicalStripParams only change how urls are compared, never the stored url.
+	// Stripped params are names, or prefixes when they end with "*", e.g. "utm_*".
+	CanonicalSortQuery   bool
+	CanonicalStripParams []string
+
+	// PasswordHashCost is the bcrypt cost link passwords are hashed with, the bcrypt default when 0.
+	PasswordHashCost int
+
+	SaveMaxAttempts      int
+	SaveRetryBaseDelayMs int
+	SaveRetryMaxDelayMs  int
+}
@@ -5,62 +5,241 @@ import (
 	"errors"
 	"fmt"
 
+	"golang.org/x/sync/singleflight"
+
 	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
 	"github.com/beard-programmer/shortorg/internal/core"
 )
 
 type URLWasEncoded struct {
 	NonBrandedLink core.Link
+	logOffset      uint64
+	// holdsQueueSlot is set for links pushed to URLWasEncodedQueue, links replayed from the log hold none.
+	holdsQueueSlot bool
+	// isReplayed is set when the link was answered from an earlier request with the same idempotency key.
+	isReplayed bool
 }
 
 var (
 	errValidation     = errors.New("validation")
 	errInfrastructure = errors.New("infrastructure")
 	errApplication    = errors.New("application")
+	errConflict       = errors.New("conflict")
 )
 
 type Fn = func(context.Context, EncodingRequest) (*URLWasEncoded, error)
 
+// Dependencies are the ports encode talks to. DeterministicLinkKeyStore is nil when deterministic keys are disabled,
+// DestinationPolicy is nil when every destination is accepted, LinkHostRegistry is nil without branded hosts.
+type Dependencies struct {
+	LinkKeyStore              LinkKeyStore
+	DeterministicLinkKeyStore LinkKeyStore
+	LinkAliasStore            LinkAliasStore
+	DestinationPolicy         DestinationPolicy
+	LinkHostRegistry          core.LinkHostRegistry
+	EncodedLinksLog           EncodedLinksLog
+	PendingLinks              PendingLinks
+	IdempotencyStore          IdempotencyStore
+	ReusableLinkStore         ReusableLinkStore
+	URLWasEncodedQueue        *URLWasEncodedQueue
+}
+
+type settings struct {
+	requestPolicies    RequestPolicies
+	linkKeyCodec       core.LinkKeyCodec
+	deterministicHosts map[string]struct{}
+	// inFlight coalesces concurrent requests that share an idempotency key or a reusable url.
+	inFlight *singleflight.Group
+}
+
 func NewEncodeFn(
-	tokenKeyStore LinkKeyStore,
 	logger *appLogger.AppLogger,
-	urlWasEncodedChan chan<- URLWasEncoded,
-) Fn {
-	return func(ctx context.Context, r EncodingRequest) (*URLWasEncoded, error) {
-		return encode(ctx, tokenKeyStore, logger, urlWasEncodedChan, r)
+	dependencies Dependencies,
+	linkKeyCodec core.LinkKeyCodec,
+	cfg Config,
+) (Fn, error) {
+	userinfoPolicy, err := core.NewUserinfoPolicy(cfg.UserinfoPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("NewEncodeFn: invalid userinfo policy: %w", err)
 	}
+
+	canonicalizationPolicy, err := core.NewCanonicalizationPolicy(cfg.CanonicalSortQuery, cfg.CanonicalStripParams)
+	if err != nil {
+		return nil, fmt.Errorf("NewEncodeFn: invalid canonicalization policy: %w", err)
+	}
+
+	deterministicHosts := make(map[string]struct{}, len(cfg.DeterministicHosts))
+	for _, host := range cfg.DeterministicHosts {
+		deterministicHosts[host] = struct{}{}
+	}
+
+	encodeSettings := settings{
+		requestPolicies: RequestPolicies{
+			Userinfo:         *userinfoPolicy,
+			Canonicalization: *canonicalizationPolicy,
+			Destination:      dependencies.DestinationPolicy,
+			LinkHosts:        dependencies.LinkHostRegistry,
+			PasswordHashCost: cfg.PasswordHashCost,
+		},
+		linkKeyCodec:       linkKeyCodec,
+		deterministicHosts: deterministicHosts,
+		inFlight:           &singleflight.Group{},
+	}
+
+	return func(ctx context.Context, r EncodingRequest) (*URLWasEncoded, error) {
+		return encode(ctx, logger, dependencies, encodeSettings, r)
+	}, nil
 }
 
 func encode(
 	ctx context.Context,
-	linkKeyStore LinkKeyStore,
 	logger *appLogger.AppLogger,
-	urlWasEncodedChan chan<- URLWasEncoded,
+	dependencies Dependencies,
+	encodeSettings settings,
 	request EncodingRequest,
 ) (*URLWasEncoded, error) {
-	validatedRequest, err := NewValidatedRequest(
-		request,
-	)
+	validatedRequest, err := NewValidatedRequest(request, encodeSettings.requestPolicies)
 
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode: %w", errValidation, err)
+	}
+
+	if validatedRequest.IdempotencyKey != nil {
+		return encodeIdempotent(ctx, logger, dependencies, encodeSettings, *validatedRequest)
+	}
+
+	return encodeOrReuse(ctx, logger, dependencies, encodeSettings, *validatedRequest)
+}
+
+func encodeNew(
+	ctx context.Context,
+	logger *appLogger.AppLogger,
+	dependencies Dependencies,
+	encodeSettings settings,
+	validatedRequest ValidatedRequest,
+) (*URLWasEncoded, error) {
+	urlWasEncodedQueue := dependencies.URLWasEncodedQueue
+	err := urlWasEncodedQueue.reserve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode: %w", errInfrastructure, err)
+	}
+
+	isQueued := false
+	defer func() {
+		if !isQueued {
+			urlWasEncodedQueue.release()
+		}
+	}()
+
+	keyStore, err := selectLinkKeyStore(ctx, dependencies, encodeSettings, validatedRequest)
 	if err != nil {
 		return nil, fmt.Errorf("%w: encode: %v", errValidation, err)
 	}
 
-	unclaimedKey, err := linkKeyStore.Issue(ctx)
+	seed := core.LinkKeySeedDto{
+		Host:                 validatedRequest.TokenHost.Hostname(),
+		DestinationURL:       validatedRequest.OriginalURL.Canonical(),
+		LegacyDestinationURL: validatedRequest.OriginalURL.LegacyNormalized(),
+		Namespace:            validatedRequest.Namespace,
+		Owner:                validatedRequest.Owner,
+	}
+	if validatedRequest.RedirectStatus != nil {
+		redirectStatus := validatedRequest.RedirectStatus.IntoDto()
+		seed.RedirectStatus = &redirectStatus
+	}
+
+	unclaimedKey, err := keyStore.Issue(ctx, seed)
 	if err != nil {
-		return nil, fmt.Errorf("%w: encode: failed to generate unclaimedKey: %v", errInfrastructure, err)
+		return nil, fmt.Errorf("%w: encode: failed to generate unclaimedKey: %w", errInfrastructure, err)
 	}
 
-	token, err := core.NewLink(*unclaimedKey, validatedRequest.TokenHost, validatedRequest.OriginalURL)
+	token, err := core.NewLink(
+		*unclaimedKey,
+		validatedRequest.TokenHost,
+		validatedRequest.OriginalURL,
+		encodeSettings.linkKeyCodec,
+		core.LinkOptions{
+			RedirectStatus: validatedRequest.RedirectStatus,
+			Alias:          validatedRequest.Alias,
+			Owner:          validatedRequest.Owner,
+			Lifetime:       validatedRequest.Lifetime,
+			Password:       validatedRequest.Password,
+		},
+	)
 
 	if err != nil {
 		return nil, fmt.Errorf("%w: encode: failed to build non branded link: %v", errApplication, err)
 	}
 
-	event := URLWasEncoded{*token}
-	go func() {
-		urlWasEncodedChan <- event
-	}()
+	linkDto := token.IntoDto()
+	if linkDto.Alias != nil {
+		isClaimed, claimErr := dependencies.LinkAliasStore.Claim(ctx, linkDto.Host, *linkDto.Alias, linkDto.Key)
+		if claimErr != nil {
+			return nil, fmt.Errorf("%w: encode: failed to claim alias: %v", errInfrastructure, claimErr)
+		}
+		if !isClaimed {
+			return nil, fmt.Errorf("%w: encode: alias %s is already taken", errConflict, linkDto.Alias.Value)
+		}
+	}
+
+	logOffset, err := dependencies.EncodedLinksLog.Append(ctx, linkDto)
+	if err != nil {
+		if linkDto.Alias != nil {
+			releaseErr := dependencies.LinkAliasStore.Release(ctx, linkDto.Host, *linkDto.Alias)
+			if releaseErr != nil {
+				logger.ErrorContext(ctx, "encode: failed to release alias", "alias", linkDto.Alias.Value, "err", releaseErr)
+			}
+		}
+
+		return nil, fmt.Errorf("%w: encode: failed to append link to log: %v", errInfrastructure, err)
+	}
+
+	dependencies.PendingLinks.Add(linkDto)
+
+	event := URLWasEncoded{NonBrandedLink: *token, logOffset: logOffset, holdsQueueSlot: true}
+	urlWasEncodedQueue.push(event)
+	isQueued = true
 
 	return &event, nil
 }
+
+func selectLinkKeyStore(
+	ctx context.Context,
+	dependencies Dependencies,
+	encodeSettings settings,
+	validatedRequest ValidatedRequest,
+) (LinkKeyStore, error) {
+	keyMode := resolveKeyMode(validatedRequest.KeyMode, validatedRequest.TokenHost.Hostname(), encodeSettings.deterministicHosts)
+
+	if keyMode == keyModeSequence {
+		if prefetched, isBatch := ctx.Value(prefetchedLinkKeysCtxKey{}).(*prefetchedLinkKeys); isBatch {
+			return prefetched, nil
+		}
+
+		return dependencies.LinkKeyStore, nil
+	}
+	if dependencies.DeterministicLinkKeyStore == nil {
+		return nil, errors.New("deterministic keys are disabled")
+	}
+	// The same url always gets the same deterministic link, it can not have a lifetime or a password of its own.
+	if validatedRequest.Lifetime != nil {
+		return nil, errors.New("deterministic keys can not be combined with notBefore, expiresAt or maxClicks")
+	}
+	if validatedRequest.Password != nil {
+		return nil, errors.New("deterministic keys can not be combined with a password")
+	}
+
+	return dependencies.DeterministicLinkKeyStore, nil
+}
+
+// resolveKeyMode leaves the key mode to the host when the request does not ask for one.
+func resolveKeyMode(keyMode string, hostname string, deterministicHosts map[string]struct{}) string {
+	if keyMode != "" {
+		return keyMode
+	}
+	if _, isDeterministic := deterministicHosts[hostname]; isDeterministic {
+		return keyModeDeterministic
+	}
+
+	return keyModeSequence
+}
@@ -3,15 +3,31 @@ package encode
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
 	"github.com/beard-programmer/shortorg/internal/httpEncoder"
 )
 
 type APIRequest struct {
-	URL          string  `json:"url"`
-	EncodeAtHost *string `json:"encodeAt_host"`
+	URL                 string     `json:"url"`
+	EncodeAtHost        *string    `json:"encodeAt_host"`
+	RedirectStatusValue *int       `json:"redirectStatus"`
+	AliasValue          *string    `json:"alias"`
+	KeyModeValue        *string    `json:"keyMode"`
+	NamespaceValue      *string    `json:"namespace"`
+	OwnerValue          *string    `json:"owner"`
+	ReuseExistingValue  bool       `json:"reuseExisting"`
+	NotBeforeValue      *time.Time `json:"notBefore"`
+	ExpiresAtValue      *time.Time `json:"expiresAt"`
+	MaxClicksValue      *int64     `json:"maxClicks"`
+	PasswordValue       *string    `json:"password"`
+	// IdempotencyKeyValue comes from the Idempotency-Key header.
+	IdempotencyKeyValue *string `json:"-"`
 }
 
 func (r APIRequest) OriginalUrl() string {
@@ -22,6 +38,55 @@ func (r APIRequest) Host() *string {
 	return r.EncodeAtHost
 }
 
+func (r APIRequest) RedirectStatus() *int {
+	return r.RedirectStatusValue
+}
+
+func (r APIRequest) Alias() *string {
+	return r.AliasValue
+}
+
+func (r APIRequest) KeyMode() *string {
+	return r.KeyModeValue
+}
+
+func (r APIRequest) Namespace() *string {
+	return r.NamespaceValue
+}
+
+func (r APIRequest) Owner() *string {
+	return r.OwnerValue
+}
+
+func (r APIRequest) ReuseExisting() bool {
+	return r.ReuseExistingValue
+}
+
+func (r APIRequest) NotBefore() *time.Time {
+	return r.NotBeforeValue
+}
+
+func (r APIRequest) ExpiresAt() *time.Time {
+	return r.ExpiresAtValue
+}
+
+func (r APIRequest) MaxClicks() *int64 {
+	return r.MaxClicksValue
+}
+
+func (r APIRequest) Password() *string {
+	return r.PasswordValue
+}
+
+func (r APIRequest) IdempotencyKey() *string {
+	return r.IdempotencyKeyValue
+}
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
 type APIResponse struct {
 	URL      string `json:"url"`
 	ShortURL string `json:"shortUrl"`
@@ -31,6 +96,8 @@ type APIErrResponse struct {
 	httpStatusCode int
 	Code           string `json:"code"`
 	Message        string `json:"message"`
+	// RejectionCode tells which destination policy rule refused the url.
+	RejectionCode string `json:"rejectionCode,omitempty"`
 }
 
 func HttpHandlerFunc(
@@ -43,6 +110,9 @@ func HttpHandlerFunc(
 			handleError(w, r, fmt.Errorf("%w encode: invalid request body", errValidation))
 			return
 		}
+		if idempotencyKey := r.Header.Get(idempotencyKeyHeader); idempotencyKey != "" {
+			apiRequest.IdempotencyKeyValue = &idempotencyKey
+		}
 
 		urlWasEncoded, err := encodeFunc(r.Context(), apiRequest)
 
@@ -51,34 +121,73 @@ func HttpHandlerFunc(
 			return
 		}
 
-		response := APIResponse{
-			URL: urlWasEncoded.NonBrandedLink.DestinationURL.String(),
-			ShortURL: fmt.Sprintf(
-				"https://%s/%s",
-				urlWasEncoded.NonBrandedLink.Host.Hostname(),
-				urlWasEncoded.NonBrandedLink.Slug.Value(),
-			),
+		response := newAPIResponse(*urlWasEncoded)
+		if urlWasEncoded.isReplayed {
+			w.Header().Set(idempotentReplayedHeader, "true")
 		}
 		httpEncoder.EncodeResponse(w, r, http.StatusOK, response)
 	}
 }
 
+func newAPIResponse(urlWasEncoded URLWasEncoded) APIResponse {
+	return APIResponse{
+		URL: urlWasEncoded.NonBrandedLink.DestinationURL.String(),
+		ShortURL: fmt.Sprintf(
+			"https://%s/%s",
+			urlWasEncoded.NonBrandedLink.Host.Hostname(),
+			urlWasEncoded.NonBrandedLink.ShortPath(),
+		),
+	}
+}
+
 func handleError(w http.ResponseWriter, r *http.Request, err error) {
-	var apiErr APIErrResponse
+	var queueFullErr queueFullError
+	if errors.As(err, &queueFullErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(queueFullErr.retryAfter.Seconds()))))
+	}
+
+	apiErr := newAPIErrResponse(err)
+	httpEncoder.EncodeResponse(w, r, apiErr.httpStatusCode, apiErr)
+}
+
+func newAPIErrResponse(err error) APIErrResponse {
+	var (
+		apiErr    APIErrResponse
+		rejection *core.DestinationRejection
+	)
 
 	switch {
+	case errors.As(err, &rejection):
+		apiErr = APIErrResponse{
+			Code:           "DestinationRejectedError",
+			Message:        err.Error(),
+			RejectionCode:  rejection.Code,
+			httpStatusCode: http.StatusBadRequest,
+		}
 	case errors.Is(err, errValidation):
 		apiErr = APIErrResponse{
 			Code:           "ValidationError",
 			Message:        err.Error(),
 			httpStatusCode: http.StatusBadRequest,
 		}
+	case errors.Is(err, errConflict):
+		apiErr = APIErrResponse{
+			Code:           "ConflictError",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusConflict,
+		}
 	case errors.Is(err, errApplication):
 		apiErr = APIErrResponse{
 			Code:           "ApplicationError",
 			Message:        err.Error(),
 			httpStatusCode: http.StatusUnprocessableEntity,
 		}
+	case errors.Is(err, core.ErrLinkKeyStoreDegraded):
+		apiErr = APIErrResponse{
+			Code:           "KeyStoreDegradedError",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusServiceUnavailable,
+		}
 	case errors.Is(err, errInfrastructure):
 		apiErr = APIErrResponse{
 			Code:           "InfrastructureError",
@@ -93,5 +202,5 @@ func handleError(w http.ResponseWriter, r *http.Request, err error) {
 		}
 	}
 
-	httpEncoder.EncodeResponse(w, r, apiErr.httpStatusCode, apiErr)
+	return apiErr
 }
@@ -0,0 +1,173 @@
+package encode
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// encodeIdempotent answers retries of a request with the link the first attempt produced. The key is claimed
+// before encoding, so a retry that races the first attempt gets a conflict instead of a second link.
+func encodeIdempotent(
+	ctx context.Context,
+	logger *appLogger.AppLogger,
+	dependencies Dependencies,
+	encodeSettings settings,
+	validatedRequest ValidatedRequest,
+) (*URLWasEncoded, error) {
+	idempotencyKey := core.IdempotencyKeyDto{Owner: validatedRequest.Owner, Key: *validatedRequest.IdempotencyKey}
+	requestFingerprint := validatedRequest.fingerprint()
+	// The fingerprint leaves the password out, requests with another password must not share the flight.
+	// The key only lives in memory.
+	flightKey := "idempotency:" + idempotencyKey.Owner + "\x00" + idempotencyKey.Key + "\x00" +
+		hex.EncodeToString(requestFingerprint) + "\x00" + validatedRequest.password
+
+	return coalesce(ctx, encodeSettings, flightKey, func(ctx context.Context) (*URLWasEncoded, error) {
+		record, err := dependencies.IdempotencyStore.Claim(ctx, idempotencyKey, requestFingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("%w: encode: failed to claim idempotency key: %v", errInfrastructure, err)
+		}
+
+		if !record.IsClaimed {
+			return replay(*record, validatedRequest, requestFingerprint)
+		}
+
+		event, err := encodeOrReuse(ctx, logger, dependencies, encodeSettings, validatedRequest)
+		if err != nil {
+			releaseErr := dependencies.IdempotencyStore.Release(ctx, idempotencyKey)
+			if releaseErr != nil {
+				logger.ErrorContext(ctx, "encode: failed to release idempotency key", "err", releaseErr)
+			}
+
+			return nil, err
+		}
+
+		err = dependencies.IdempotencyStore.Complete(ctx, idempotencyKey, event.NonBrandedLink.IntoDto())
+		if err != nil {
+			// The link is already queued, answering with it is better than failing a request that succeeded.
+			logger.ErrorContext(ctx, "encode: failed to complete idempotency key", "err", err)
+		}
+
+		return event, nil
+	})
+}
+
+func replay(
+	record core.IdempotencyRecordDto,
+	validatedRequest ValidatedRequest,
+	requestFingerprint []byte,
+) (*URLWasEncoded, error) {
+	if !bytes.Equal(record.RequestFingerprint, requestFingerprint) {
+		return nil, fmt.Errorf("%w: encode: idempotency key was already used with a different request", errValidation)
+	}
+	if record.Link == nil {
+		return nil, fmt.Errorf("%w: encode: request with the idempotency key is still in progress", errConflict)
+	}
+
+	link, err := record.Link.IntoDomain()
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode: failed to restore replayed link: %v", errApplication, err)
+	}
+	if !validatedRequest.matchesPassword(*link) {
+		return nil, fmt.Errorf("%w: encode: idempotency key was already used with a different request", errValidation)
+	}
+
+	return &URLWasEncoded{NonBrandedLink: *link, isReplayed: true}, nil
+}
+
+// encodeOrReuse answers with a link the owner already has for the same canonical url when the request asks
+// for it, links still waiting to be persisted included, and encodes a new one otherwise.
+func encodeOrReuse(
+	ctx context.Context,
+	logger *appLogger.AppLogger,
+	dependencies Dependencies,
+	encodeSettings settings,
+	validatedRequest ValidatedRequest,
+) (*URLWasEncoded, error) {
+	if !validatedRequest.ReuseExisting {
+		return encodeNew(ctx, logger, dependencies, encodeSettings, validatedRequest)
+	}
+
+	query := core.ReusableLinkQueryDto{
+		Owner:          validatedRequest.Owner,
+		URLFingerprint: validatedRequest.OriginalURL.Fingerprint(),
+		Host:           validatedRequest.TokenHost.IntoDto(),
+	}
+	var redirectStatus string
+	if validatedRequest.RedirectStatus != nil {
+		dto := validatedRequest.RedirectStatus.IntoDto()
+		query.RedirectStatus = &dto
+		redirectStatus = strconv.Itoa(dto.Value)
+	}
+	// A request that finds nothing to reuse encodes its own link, so everything deciding its key is in flightKey.
+	keyMode := resolveKeyMode(
+		validatedRequest.KeyMode,
+		validatedRequest.TokenHost.Hostname(),
+		encodeSettings.deterministicHosts,
+	)
+	flightKey := strings.Join([]string{
+		"reuse:" + query.Owner,
+		query.Host.Hostname,
+		redirectStatus,
+		keyMode,
+		validatedRequest.Namespace,
+		hex.EncodeToString(query.URLFingerprint),
+	}, "\x00")
+
+	return coalesce(ctx, encodeSettings, flightKey, func(ctx context.Context) (*URLWasEncoded, error) {
+		if linkDto, isFound := dependencies.PendingLinks.FindReusable(query); isFound {
+			return reused(*linkDto)
+		}
+
+		linkDto, isFound, err := dependencies.ReusableLinkStore.FindReusable(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("%w: encode: failed to find reusable link: %v", errInfrastructure, err)
+		}
+		if isFound {
+			return reused(*linkDto)
+		}
+
+		return encodeNew(ctx, logger, dependencies, encodeSettings, validatedRequest)
+	})
+}
+
+func reused(linkDto core.LinkDTO) (*URLWasEncoded, error) {
+	link, err := linkDto.IntoDomain()
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode: failed to restore reused link: %v", errApplication, err)
+	}
+
+	return &URLWasEncoded{NonBrandedLink: *link}, nil
+}
+
+// coalesce runs fn once for concurrent callers with the same key, they all get its result. fn runs without
+// the cancellation of the caller that started it, a caller that gives up stops waiting but does not fail the rest.
+func coalesce(
+	ctx context.Context,
+	encodeSettings settings,
+	key string,
+	fn func(context.Context) (*URLWasEncoded, error),
+) (*URLWasEncoded, error) {
+	sharedCtx := context.WithoutCancel(ctx)
+	resultCh := encodeSettings.inFlight.DoChan(key, func() (interface{}, error) {
+		return fn(sharedCtx)
+	})
+
+	select {
+	case result := <-resultCh:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		event, _ := result.Val.(*URLWasEncoded)
+
+		return event, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: encode: stopped waiting for an identical request: %v", errInfrastructure, ctx.Err())
+	}
+}
@@ -7,9 +7,52 @@ import (
 )
 
 type LinkKeyStore interface {
-	Issue(ctx context.Context) (*core.LinkKey, error)
+	Issue(context.Context, core.LinkKeySeedDto) (*core.LinkKey, error)
+}
+
+// BatchLinkKeyStore issues the keys of a whole batch at once. It may return fewer keys along with an error.
+type BatchLinkKeyStore interface {
+	IssueMany(context.Context, int) ([]core.LinkKey, error)
+}
+
+// DestinationPolicy decides which urls may be shortened.
+type DestinationPolicy interface {
+	Evaluate(*core.DestinationURL) *core.DestinationRejection
+}
+
+type LinkAliasStore interface {
+	Claim(context.Context, core.LinkHostDto, core.LinkAliasDto, core.LinkKeyDto) (bool, error)
+	Release(context.Context, core.LinkHostDto, core.LinkAliasDto) error
+}
+
+// IdempotencyStore remembers which link a request with an idempotency key produced. Claim returns a record
+// with IsClaimed set when the caller is the first to use the key and must Complete or Release it.
+type IdempotencyStore interface {
+	Claim(context.Context, core.IdempotencyKeyDto, []byte) (*core.IdempotencyRecordDto, error)
+	Complete(context.Context, core.IdempotencyKeyDto, core.LinkDTO) error
+	Release(context.Context, core.IdempotencyKeyDto) error
+}
+
+type ReusableLinkStore interface {
+	FindReusable(context.Context, core.ReusableLinkQueryDto) (*core.LinkDTO, bool, error)
 }
 
 type EncodedURLStore interface {
-	SaveMany(context.Context, []URLWasEncoded) error
+	SaveMany(context.Context, []core.LinkDTO) error
+}
+
+type DeadLetterStore interface {
+	SaveDeadLetters(context.Context, []core.LinkDTO, string) error
+}
+
+type PendingLinks interface {
+	Add(core.LinkDTO)
+	RemoveMany([]core.LinkDTO)
+	FindReusable(core.ReusableLinkQueryDto) (*core.LinkDTO, bool)
+}
+
+type EncodedLinksLog interface {
+	Append(context.Context, core.LinkDTO) (uint64, error)
+	Commit(context.Context, []uint64) error
+	Replay(context.Context, func(uint64, core.LinkDTO) error) error
 }
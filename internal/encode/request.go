@@ -1,7 +1,12 @@
 package encode
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/beard-programmer/shortorg/internal/core"
 )
@@ -9,26 +14,225 @@ import (
 type EncodingRequest interface {
 	OriginalUrl() string
 	Host() *string
+	RedirectStatus() *int
+	Alias() *string
+	KeyMode() *string
+	Namespace() *string
+	Owner() *string
+	ReuseExisting() bool
+	IdempotencyKey() *string
+	NotBefore() *time.Time
+	ExpiresAt() *time.Time
+	MaxClicks() *int64
+	Password() *string
 }
 
+const (
+	keyModeSequence      = "sequence"
+	keyModeDeterministic = "deterministic"
+
+	maxNamespaceSize      = 64
+	maxOwnerSize          = 64
+	maxIdempotencyKeySize = 255
+)
+
+var (
+	namespacePattern      = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+	ownerPattern          = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+	idempotencyKeyPattern = regexp.MustCompile(`^[\x21-\x7e]+$`)
+)
+
 type ValidatedRequest struct {
-	OriginalURL core.DestinationURL
-	TokenHost   core.LinkHost
+	OriginalURL    core.DestinationURL
+	TokenHost      core.LinkHost
+	RedirectStatus *core.RedirectStatus
+	Alias          *core.LinkAlias
+	// KeyMode is empty when the request leaves it to the host.
+	KeyMode   string
+	Namespace string
+	Owner     string
+	// ReuseExisting asks for the owner's existing link to the same canonical url instead of a new one.
+	ReuseExisting  bool
+	IdempotencyKey *string
+	// Lifetime is nil for links that live forever.
+	Lifetime *core.LinkLifetime
+	// Password is nil for links that redirect without one.
+	Password *core.LinkPasswordHash
+	// password is the plain password, it is only checked against the link of a retried request and never
+	// stored. It is empty without a password.
+	password string
 }
 
-func NewValidatedRequest(request EncodingRequest) (*ValidatedRequest, error) {
-	destinationURL, err := core.NewURL(request.OriginalUrl())
+// RequestPolicies are what a request is validated against besides its own fields. Destination and LinkHosts
+// may be nil, every destination is accepted then and links are only issued on the default host.
+type RequestPolicies struct {
+	Userinfo         core.UserinfoPolicy
+	Canonicalization core.CanonicalizationPolicy
+	Destination      DestinationPolicy
+	LinkHosts        core.LinkHostRegistry
+	// PasswordHashCost is the bcrypt cost of link passwords, the bcrypt default when 0.
+	PasswordHashCost int
+}
+
+func NewValidatedRequest(request EncodingRequest, policies RequestPolicies) (*ValidatedRequest, error) {
+	destinationURL, err := core.NewURLWithPolicies(request.OriginalUrl(), policies.Userinfo, policies.Canonicalization)
 	if err != nil {
 		return nil, fmt.Errorf("parsing original url failed: %w", err)
 	}
 
-	linkHost, err := core.NewLinkHost(request.Host())
+	if policies.Destination != nil {
+		if rejection := policies.Destination.Evaluate(destinationURL); rejection != nil {
+			return nil, rejection
+		}
+	}
+
+	linkHost, err := core.NewLinkHost(request.Host(), policies.LinkHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var redirectStatus *core.RedirectStatus
+	if request.RedirectStatus() != nil {
+		redirectStatus, err = core.NewRedirectStatus(*request.RedirectStatus())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var alias *core.LinkAlias
+	if request.Alias() != nil {
+		alias, err = core.NewLinkAlias(*request.Alias())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var keyMode string
+	if request.KeyMode() != nil {
+		keyMode = *request.KeyMode()
+		if keyMode != keyModeSequence && keyMode != keyModeDeterministic {
+			return nil, fmt.Errorf("key mode %s is not supported", keyMode)
+		}
+	}
+
+	var namespace string
+	if request.Namespace() != nil {
+		namespace = *request.Namespace()
+		if maxNamespaceSize < len(namespace) || !namespacePattern.MatchString(namespace) {
+			return nil, fmt.Errorf(
+				"namespace must be up to %d latin letters, digits, dots, dashes and underscores",
+				maxNamespaceSize,
+			)
+		}
+	}
+
+	var owner string
+	if request.Owner() != nil {
+		owner = *request.Owner()
+		if maxOwnerSize < len(owner) || !ownerPattern.MatchString(owner) {
+			return nil, fmt.Errorf(
+				"owner must be up to %d latin letters, digits, dots, dashes and underscores",
+				maxOwnerSize,
+			)
+		}
+	}
+
+	if request.ReuseExisting() && alias != nil {
+		return nil, errors.New("reuseExisting can not be combined with an alias")
+	}
+
+	lifetime, err := core.NewLinkLifetime(request.NotBefore(), request.ExpiresAt(), request.MaxClicks(), time.Now())
 	if err != nil {
 		return nil, err
 	}
+	if request.ReuseExisting() && lifetime != nil {
+		return nil, errors.New("reuseExisting can not be combined with notBefore, expiresAt or maxClicks")
+	}
+
+	var password *core.LinkPasswordHash
+	var plainPassword string
+	if request.Password() != nil {
+		if request.ReuseExisting() {
+			return nil, errors.New("reuseExisting can not be combined with a password")
+		}
+		password, err = core.NewLinkPasswordHash(*request.Password(), policies.PasswordHashCost)
+		if err != nil {
+			return nil, err
+		}
+		plainPassword = *request.Password()
+	}
+
+	idempotencyKey := request.IdempotencyKey()
+	if idempotencyKey != nil {
+		if maxIdempotencyKeySize < len(*idempotencyKey) || !idempotencyKeyPattern.MatchString(*idempotencyKey) {
+			return nil, fmt.Errorf("idempotency key must be 1 to %d printable ascii characters", maxIdempotencyKeySize)
+		}
+	}
 
 	return &ValidatedRequest{
-		OriginalURL: *destinationURL,
-		TokenHost:   *linkHost,
+		OriginalURL:    *destinationURL,
+		TokenHost:      *linkHost,
+		RedirectStatus: redirectStatus,
+		Alias:          alias,
+		KeyMode:        keyMode,
+		Namespace:      namespace,
+		Owner:          owner,
+		ReuseExisting:  request.ReuseExisting(),
+		IdempotencyKey: idempotencyKey,
+		Lifetime:       lifetime,
+		Password:       password,
+		password:       plainPassword,
 	}, nil
 }
+
+// fingerprint tells retries of a request apart from a different request reusing its idempotency key. It is
+// stored, so only whether there is a password counts, matchesPassword checks the password itself on replay.
+func (r ValidatedRequest) fingerprint() []byte {
+	var redirectStatus, alias, notBefore, expiresAt, maxClicks string
+	if r.RedirectStatus != nil {
+		redirectStatus = strconv.Itoa(r.RedirectStatus.Value())
+	}
+	if r.Alias != nil {
+		alias = r.Alias.Value()
+	}
+	if r.Lifetime != nil {
+		if r.Lifetime.NotBefore() != nil {
+			notBefore = r.Lifetime.NotBefore().Format(time.RFC3339Nano)
+		}
+		if r.Lifetime.ExpiresAt() != nil {
+			expiresAt = r.Lifetime.ExpiresAt().Format(time.RFC3339Nano)
+		}
+		if r.Lifetime.MaxClicks() != nil {
+			maxClicks = strconv.FormatInt(*r.Lifetime.MaxClicks(), 10)
+		}
+	}
+
+	hash := sha256.New()
+	for _, field := range []string{
+		r.OriginalURL.String(),
+		r.TokenHost.Hostname(),
+		redirectStatus,
+		alias,
+		r.KeyMode,
+		r.Namespace,
+		strconv.FormatBool(r.ReuseExisting),
+		notBefore,
+		expiresAt,
+		maxClicks,
+		strconv.FormatBool(r.Password != nil),
+	} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+
+	return hash.Sum(nil)
+}
+
+// matchesPassword tells whether the link answered to an earlier request was created with the same password.
+func (r ValidatedRequest) matchesPassword(link core.Link) bool {
+	if r.Password == nil || link.Password == nil {
+		return r.Password == nil && link.Password == nil
+	}
+
+	return link.Password.Matches(r.password)
+}
@@ -0,0 +1,116 @@
+package encode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func newRetryPolicy(cfg Config) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts: cfg.SaveMaxAttempts,
+		baseDelay:   time.Duration(cfg.SaveRetryBaseDelayMs) * time.Millisecond,
+		maxDelay:    time.Duration(cfg.SaveRetryMaxDelayMs) * time.Millisecond,
+	}
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = 5
+	}
+	if policy.baseDelay <= 0 {
+		policy.baseDelay = 50 * time.Millisecond
+	}
+	if policy.maxDelay < policy.baseDelay {
+		policy.maxDelay = 5 * time.Second
+	}
+
+	return policy
+}
+
+// backoff returns exponential delay with full jitter for the given zero based attempt.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.maxDelay
+	if attempt < 32 && p.baseDelay<<attempt < p.maxDelay {
+		delay = p.baseDelay << attempt
+	}
+
+	return rand.N(delay + 1) //nolint:gosec // jitter does not need crypto rand
+}
+
+type batchSaver struct {
+	store           EncodedURLStore
+	deadLetterStore DeadLetterStore
+	retryPolicy     retryPolicy
+}
+
+// save persists the batch, retrying transient failures. Batches rejected as non retryable are split in halves
+// until the bad rows are isolated, only those are moved to the dead-letter store. Rows that still fail
+// transiently stay unhandled, the caller retries them later and their log offsets stay open meanwhile.
+// It returns every event that is either persisted or dead-lettered.
+func (s batchSaver) save(ctx context.Context, batch []URLWasEncoded) ([]URLWasEncoded, int, error) {
+	err := s.saveWithRetries(ctx, batch)
+	if err == nil {
+		return batch, 0, nil
+	}
+	if ctx.Err() != nil || !errors.Is(err, core.ErrNonRetryable) {
+		return nil, 0, err
+	}
+
+	if len(batch) == 1 {
+		deadLetterErr := s.deadLetterStore.SaveDeadLetters(ctx, intoLinkDTOs(batch), err.Error())
+		if deadLetterErr != nil {
+			return nil, 0, fmt.Errorf("save: dead-letter after %w: %w", err, deadLetterErr)
+		}
+
+		return batch, len(batch), nil
+	}
+
+	middle := len(batch) / 2
+	leftHandled, leftDeadLettered, leftErr := s.save(ctx, batch[:middle])
+	rightHandled, rightDeadLettered, rightErr := s.save(ctx, batch[middle:])
+
+	return append(leftHandled, rightHandled...), leftDeadLettered + rightDeadLettered, errors.Join(leftErr, rightErr)
+}
+
+func (s batchSaver) saveWithRetries(ctx context.Context, batch []URLWasEncoded) error {
+	links := intoLinkDTOs(batch)
+
+	var err error
+	for attempt := range s.retryPolicy.maxAttempts {
+		err = s.store.SaveMany(ctx, links)
+		if err == nil || errors.Is(err, core.ErrNonRetryable) {
+			return err
+		}
+		if attempt == s.retryPolicy.maxAttempts-1 {
+			break
+		}
+
+		timer := time.NewTimer(s.retryPolicy.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+
+			return fmt.Errorf("saveWithRetries: %w: last error: %w", ctx.Err(), err)
+		}
+	}
+
+	return err
+}
+
+func intoLinkDTOs(batch []URLWasEncoded) []core.LinkDTO {
+	links := make([]core.LinkDTO, 0, len(batch))
+	for _, urlWasEncoded := range batch {
+		links = append(links, urlWasEncoded.NonBrandedLink.IntoDto())
+	}
+
+	return links
+}
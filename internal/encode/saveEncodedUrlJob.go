@@ -2,39 +2,174 @@ package encode
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
 )
 
 type SaveEncodedURLJob = func(ctx context.Context) <-chan error
 
+const shutdownFlushTimeout = 3 * time.Second
+
+// failedBatches keeps links that were neither persisted nor dead-lettered. Their log offsets stay open until
+// a retry handles them, a failed batch is never left behind while the checkpoint waits for it. Links from
+// encode keep their queue slots meanwhile, so failed batches never hold more of them than the queue does.
+type failedBatches struct {
+	mu      sync.Mutex
+	batches [][]URLWasEncoded
+}
+
+func (f *failedBatches) add(batch []URLWasEncoded) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.batches = append(f.batches, batch)
+}
+
+func (f *failedBatches) takeAll() [][]URLWasEncoded {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	batches := f.batches
+	f.batches = nil
+
+	return batches
+}
+
+// unhandledOf is the part of the batch that handled does not hold.
+func unhandledOf(batch []URLWasEncoded, handled []URLWasEncoded) []URLWasEncoded {
+	if len(handled) == len(batch) {
+		return nil
+	}
+
+	handledOffsets := make(map[uint64]struct{}, len(handled))
+	for _, urlWasEncoded := range handled {
+		handledOffsets[urlWasEncoded.logOffset] = struct{}{}
+	}
+
+	unhandled := make([]URLWasEncoded, 0, len(batch)-len(handled))
+	for _, urlWasEncoded := range batch {
+		if _, isHandled := handledOffsets[urlWasEncoded.logOffset]; !isHandled {
+			unhandled = append(unhandled, urlWasEncoded)
+		}
+	}
+
+	return unhandled
+}
+
 func NewSaveEncodedURLJob(
 	logger *appLogger.AppLogger,
 	store EncodedURLStore,
+	deadLetterStore DeadLetterStore,
+	encodedLinksLog EncodedLinksLog,
+	pendingLinks PendingLinks,
 	batchSize int,
 	concurrency int,
-	tChan <-chan URLWasEncoded,
+	urlWasEncodedQueue *URLWasEncodedQueue,
+	cfg Config,
 ) SaveEncodedURLJob {
 	retryPeriod := time.Duration(1+batchSize/40) * time.Millisecond
+	saver := batchSaver{store: store, deadLetterStore: deadLetterStore, retryPolicy: newRetryPolicy(cfg)}
+	failedBatchesRetryPeriod := saver.retryPolicy.maxDelay
 	return func(ctx context.Context) <-chan error {
 
 		errChan := make(chan error, concurrency+1)
+		failed := &failedBatches{}
 
 		process := func(ctx context.Context, batch []URLWasEncoded) error {
-			err := store.SaveMany(ctx, batch)
+			handled, deadLettered, err := saver.save(ctx, batch)
+			if 0 < deadLettered {
+				logger.WarnContext(ctx, "Links were moved to dead-letter store", "count", deadLettered)
+			}
+			// Links cut short by shutdown are replayed from the log on the next start instead.
+			if unhandled := unhandledOf(batch, handled); 0 < len(unhandled) && ctx.Err() == nil {
+				failed.add(unhandled)
+			}
+
+			if 0 < len(handled) {
+				logOffsets := make([]uint64, 0, len(handled))
+				for _, urlWasEncoded := range handled {
+					logOffsets = append(logOffsets, urlWasEncoded.logOffset)
+				}
+				err = errors.Join(err, encodedLinksLog.Commit(ctx, logOffsets))
+				pendingLinks.RemoveMany(intoLinkDTOs(handled))
+				for _, urlWasEncoded := range handled {
+					if urlWasEncoded.holdsQueueSlot {
+						urlWasEncodedQueue.release()
+					}
+				}
+			}
+
 			if err != nil {
 				select {
 				case errChan <- err:
 				default:
-					logger.ErrorContext(ctx, "Error channel full, error discarded:", err)
+					logger.ErrorContext(ctx, "Error channel full, error discarded", "err", err)
 				}
 			}
 			return nil
 		}
 
 		wg := sync.WaitGroup{}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(failedBatchesRetryPeriod)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					for _, batch := range failed.takeAll() {
+						_ = process(ctx, batch)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var (
+				batch    []URLWasEncoded
+				replayed int
+			)
+			err := encodedLinksLog.Replay(ctx, func(logOffset uint64, dto core.LinkDTO) error {
+				link, intoDomainErr := dto.IntoDomain()
+				if intoDomainErr != nil {
+					return fmt.Errorf("replay: log record %d: %w", logOffset, intoDomainErr)
+				}
+
+				pendingLinks.Add(dto)
+				batch = append(batch, URLWasEncoded{NonBrandedLink: *link, logOffset: logOffset})
+				if batchSize <= len(batch) {
+					replayed += len(batch)
+					_ = process(ctx, batch)
+					batch = nil
+				}
+
+				return nil
+			})
+			if 0 < len(batch) {
+				replayed += len(batch)
+				_ = process(ctx, batch)
+			}
+			if err != nil {
+				errChan <- fmt.Errorf("NewSaveEncodedURLJob: replay encoded links log: %w", err)
+			}
+			if 0 < replayed {
+				logger.WarnContext(ctx, "Replayed not persisted links from encoded links log", "count", replayed)
+			}
+		}()
+
 		for range concurrency {
 			wg.Add(1)
 
@@ -45,7 +180,7 @@ func NewSaveEncodedURLJob(
 				var batch []URLWasEncoded
 				for {
 					select {
-					case element, ok := <-tChan:
+					case element, ok := <-urlWasEncodedQueue.receive():
 						if !ok {
 							if 0 < len(batch) {
 								err := process(ctx, batch)
@@ -82,7 +217,9 @@ func NewSaveEncodedURLJob(
 					case <-ctx.Done():
 						if 0 < len(batch) {
 							logger.WarnContext(ctx, "Context canceled, processing remaining batch before shutdown")
-							err := process(ctx, batch)
+							flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownFlushTimeout)
+							err := process(flushCtx, batch)
+							cancel()
 							if err != nil {
 								errChan <- err
 								return
@@ -0,0 +1,90 @@
+package encode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errQueueFull = errors.New("url was encoded queue is full")
+
+type queueFullError struct {
+	retryAfter time.Duration
+}
+
+func (e queueFullError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", errQueueFull, e.retryAfter)
+}
+
+func (e queueFullError) Unwrap() error {
+	return errQueueFull
+}
+
+// URLWasEncodedQueue bounds the number of encoded links that wait to be persisted.
+// A slot is reserved before the link is issued and released once the save job has persisted or dead-lettered
+// it, links waiting for a retry keep theirs, so encode is refused while saves are failing.
+type URLWasEncodedQueue struct {
+	events           chan URLWasEncoded
+	slots            chan struct{}
+	admissionTimeout time.Duration
+	retryAfter       time.Duration
+}
+
+func NewURLWasEncodedQueue(size int, admissionTimeout time.Duration, retryAfter time.Duration) *URLWasEncodedQueue {
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+
+	return &URLWasEncodedQueue{
+		events:           make(chan URLWasEncoded, size),
+		slots:            make(chan struct{}, size),
+		admissionTimeout: admissionTimeout,
+		retryAfter:       retryAfter,
+	}
+}
+
+func (q *URLWasEncodedQueue) Depth() int {
+	return len(q.slots)
+}
+
+func (q *URLWasEncodedQueue) Capacity() int {
+	return cap(q.slots)
+}
+
+func (q *URLWasEncodedQueue) reserve(ctx context.Context) error {
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if q.admissionTimeout <= 0 {
+		return queueFullError{retryAfter: q.retryAfter}
+	}
+
+	timer := time.NewTimer(q.admissionTimeout)
+	defer timer.Stop()
+
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return queueFullError{retryAfter: q.retryAfter}
+	case <-ctx.Done():
+		return fmt.Errorf("reserve: %w", ctx.Err())
+	}
+}
+
+func (q *URLWasEncodedQueue) release() {
+	<-q.slots
+}
+
+// push must only be called after a successful reserve, so it never blocks.
+func (q *URLWasEncodedQueue) push(event URLWasEncoded) {
+	q.events <- event
+}
+
+func (q *URLWasEncodedQueue) receive() <-chan URLWasEncoded {
+	return q.events
+}
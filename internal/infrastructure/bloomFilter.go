@@ -0,0 +1,138 @@
+package infrastructure
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+var errBloomFilter = errors.New("errBloomFilter")
+
+const bloomFilterSnapshotMagic = "SOBF0001"
+
+// bloomFilter is a lock free bloom filter over int64 values, safe for concurrent add and mayContain.
+type bloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+}
+
+func newBloomFilter(expectedItems int64, falsePositiveRate float64) *bloomFilter {
+	if expectedItems <= 0 {
+		expectedItems = 1
+	}
+	if falsePositiveRate <= 0 || 1 <= falsePositiveRate {
+		falsePositiveRate = 0.01
+	}
+
+	size := uint64(math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	size = max(64, (size+63)/64*64) //nolint:mnd // round up to whole words
+	hashes := uint64(math.Round(float64(size) / float64(expectedItems) * math.Ln2))
+	hashes = max(1, min(hashes, 16)) //nolint:mnd // more hashes do not pay off
+
+	return &bloomFilter{bits: make([]uint64, size/64), size: size, hashes: hashes} //nolint:mnd // word size
+}
+
+func (f *bloomFilter) add(value int64) {
+	h1, h2 := bloomFilterHashes(value)
+	for i := range f.hashes {
+		bit := (h1 + i*h2) % f.size
+		atomic.OrUint64(&f.bits[bit/64], 1<<(bit%64))
+	}
+}
+
+func (f *bloomFilter) mayContain(value int64) bool {
+	h1, h2 := bloomFilterHashes(value)
+	for i := range f.hashes {
+		bit := (h1 + i*h2) % f.size
+		if atomic.LoadUint64(&f.bits[bit/64])&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *bloomFilter) writeTo(w io.Writer, watermark string) error {
+	writer := bufio.NewWriter(w)
+
+	header := make([]byte, 0, len(bloomFilterSnapshotMagic)+8+8+4+len(watermark))
+	header = append(header, bloomFilterSnapshotMagic...)
+	header = binary.BigEndian.AppendUint64(header, f.size)
+	header = binary.BigEndian.AppendUint64(header, f.hashes)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(watermark))) //nolint:gosec // short string
+	header = append(header, watermark...)
+	if _, err := writer.Write(header); err != nil {
+		return fmt.Errorf("%w: writeTo: %s", errBloomFilter, err)
+	}
+
+	word := make([]byte, 8) //nolint:mnd // uint64
+	for i := range f.bits {
+		binary.BigEndian.PutUint64(word, atomic.LoadUint64(&f.bits[i]))
+		if _, err := writer.Write(word); err != nil {
+			return fmt.Errorf("%w: writeTo: %s", errBloomFilter, err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("%w: writeTo: %s", errBloomFilter, err)
+	}
+
+	return nil
+}
+
+func readBloomFilter(r io.Reader) (*bloomFilter, string, error) {
+	reader := bufio.NewReader(r)
+
+	header := make([]byte, len(bloomFilterSnapshotMagic)+8+8+4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, "", fmt.Errorf("%w: readBloomFilter: header: %s", errBloomFilter, err)
+	}
+	if string(header[:len(bloomFilterSnapshotMagic)]) != bloomFilterSnapshotMagic {
+		return nil, "", fmt.Errorf("%w: readBloomFilter: unknown snapshot format", errBloomFilter)
+	}
+
+	offset := len(bloomFilterSnapshotMagic)
+	size := binary.BigEndian.Uint64(header[offset : offset+8])
+	hashes := binary.BigEndian.Uint64(header[offset+8 : offset+16])
+	watermarkLen := binary.BigEndian.Uint32(header[offset+16 : offset+20])
+	if size == 0 || size%64 != 0 || hashes == 0 || 64 < watermarkLen {
+		return nil, "", fmt.Errorf("%w: readBloomFilter: corrupted header", errBloomFilter)
+	}
+
+	watermark := make([]byte, watermarkLen)
+	if _, err := io.ReadFull(reader, watermark); err != nil {
+		return nil, "", fmt.Errorf("%w: readBloomFilter: watermark: %s", errBloomFilter, err)
+	}
+
+	filter := &bloomFilter{bits: make([]uint64, size/64), size: size, hashes: hashes} //nolint:mnd // word size
+	word := make([]byte, 8)                                                           //nolint:mnd // uint64
+	for i := range filter.bits {
+		if _, err := io.ReadFull(reader, word); err != nil {
+			return nil, "", fmt.Errorf("%w: readBloomFilter: bits: %s", errBloomFilter, err)
+		}
+		filter.bits[i] = binary.BigEndian.Uint64(word)
+	}
+
+	return filter, string(watermark), nil
+}
+
+// bloomFilterHashes derives two independent hashes for double hashing with splitmix64.
+func bloomFilterHashes(value int64) (uint64, uint64) {
+	h1 := splitmix64(uint64(value)) //nolint:gosec // bits are hashed, sign does not matter
+	h2 := splitmix64(h1) | 1
+
+	return h1, h2
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9 //nolint:mnd // splitmix64 constants
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb //nolint:mnd // splitmix64 constants
+
+	return x ^ (x >> 31) //nolint:mnd // splitmix64 constants
+}
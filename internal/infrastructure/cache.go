@@ -3,14 +3,17 @@ package infrastructure
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/dgraph-io/ristretto"
 	ekoCache "github.com/eko/gocache/lib/v4/cache"
+	ekoStore "github.com/eko/gocache/lib/v4/store"
 	ristrettoStore "github.com/eko/gocache/store/ristretto/v4"
 )
 
 type CacheInMemory[T any] struct {
 	cacheManager ekoCache.Cache[T]
+	ttl          time.Duration
 }
 
 func NewCache[T any](cfg cacheConfig) (Cache[T], error) {
@@ -21,8 +24,8 @@ func NewCache[T any](cfg cacheConfig) (Cache[T], error) {
 
 	ristrettoCache, err := ristretto.NewCache(
 		&ristretto.Config{
-			NumCounters: cfg.MaxNumberOfElements,
-			MaxCost:     cfg.MaxMbSize,
+			NumCounters: cfg.MaxNumberOfElements * 10, //nolint:mnd // ristretto recommends 10x of max items
+			MaxCost:     cfg.MaxMbSize << 20,          //nolint:mnd // cost is in bytes
 			BufferItems: 64,
 		},
 	)
@@ -31,15 +34,28 @@ func NewCache[T any](cfg cacheConfig) (Cache[T], error) {
 	}
 	rStore := ristrettoStore.NewRistretto(ristrettoCache)
 	cacheManager := ekoCache.New[T](rStore)
-	return &CacheInMemory[T]{*cacheManager}, nil
+	return &CacheInMemory[T]{*cacheManager, time.Duration(cfg.TTLSeconds) * time.Second}, nil
 }
 
 func (c *CacheInMemory[T]) Get(ctx context.Context, key any) (T, error) {
 	return c.cacheManager.Get(ctx, key)
 }
 
-func (c *CacheInMemory[T]) Set(ctx context.Context, key any, value T) error {
-	return c.cacheManager.Set(ctx, key, value)
+func (c *CacheInMemory[T]) Set(ctx context.Context, key any, value T, cost int64) error {
+	options := []ekoStore.Option{ekoStore.WithCost(cost)}
+	if 0 < c.ttl {
+		options = append(options, ekoStore.WithExpiration(c.ttl))
+	}
+
+	return c.cacheManager.Set(ctx, key, value, options...)
+}
+
+func (c *CacheInMemory[T]) Delete(ctx context.Context, key any) error {
+	return c.cacheManager.Delete(ctx, key)
+}
+
+func (c *CacheInMemory[T]) Clear(ctx context.Context) error {
+	return c.cacheManager.Clear(ctx)
 }
 
 type CacheMock[T any] struct{}
@@ -48,6 +64,14 @@ func (m *CacheMock[T]) Get(_ context.Context, key any) (T, error) {
 	return *new(T), fmt.Errorf("not found in MOCK cache %v", key)
 }
 
-func (m *CacheMock[T]) Set(_ context.Context, _ any, _ T) error {
+func (m *CacheMock[T]) Set(_ context.Context, _ any, _ T, _ int64) error {
+	return nil
+}
+
+func (m *CacheMock[T]) Delete(_ context.Context, _ any) error {
+	return nil
+}
+
+func (m *CacheMock[T]) Clear(_ context.Context) error {
 	return nil
 }
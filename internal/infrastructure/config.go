@@ -1,9 +1,21 @@
 package infrastructure
 
 type Config struct {
-	PostgresClients postgresClientsConfig `mapstructure:"PostgresClients"`
-	Cache           cacheConfig           `mapstructure:"Cache"`
-	TokenStore      tokenStoreConfig      `mapstructure:"TokenStore"`
+	PostgresClients postgresClientsConfig  `mapstructure:"PostgresClients"`
+	Cache           cacheConfig            `mapstructure:"Cache"`
+	TokenStore      tokenStoreConfig       `mapstructure:"TokenStore"`
+	EncodedLinksLog segmentLogConfig       `mapstructure:"EncodedLinksLog"`
+	LinkStore       linkStoreConfig        `mapstructure:"LinkStore"`
+	LinkKeyFilter   linkKeyFilterConfig    `mapstructure:"LinkKeyFilter"`
+	IdempotencyKeys idempotencyStoreConfig `mapstructure:"IdempotencyKeys"`
+	LinkHosts       linkHostRegistryConfig `mapstructure:"LinkHosts"`
+	LinkLifetime    linkLifetimeConfig     `mapstructure:"LinkLifetime"`
+	// PasswordAttempts limits how often passwords of protected links may be guessed.
+	PasswordAttempts passwordAttemptsConfig `mapstructure:"PasswordAttempts"`
+
+	DestinationPolicy destinationPolicyConfig `mapstructure:"DestinationPolicy"`
+
+	DeterministicKeyStore deterministicKeyStoreConfig `mapstructure:"DeterministicKeyStore"`
 }
 
 type postgresClientsConfig struct {
@@ -25,8 +37,104 @@ type cacheConfig struct {
 	UseCache            bool
 	MaxNumberOfElements int64
 	MaxMbSize           int64
+	TTLSeconds          int
 }
 
 type tokenStoreConfig struct {
-	BufferSize int
+	BufferSize         int
+	MinSlugLength      int
+	MaxSlugLength      int
+	Mode               string
+	LeaseMinSize       int64
+	LeaseMaxSize       int64
+	LeaseTargetSeconds int
+	RetryBaseDelayMs   int
+	RetryMaxDelayMs    int
+	Node               nodeKeyStoreConfig `mapstructure:"Node"`
+}
+
+type nodeKeyStoreConfig struct {
+	SlugLength  int
+	NodeBits    int
+	CounterBits int
+	// Registry is "table" to claim node ids from key_nodes, or "static" to use StaticNodeID and StatePath.
+	Registry                 string
+	StaticNodeID             int
+	StatePath                string
+	HeartbeatIntervalSeconds int
+	StaleAfterSeconds        int
+	ReserveSeconds           int
+}
+
+type deterministicKeyStoreConfig struct {
+	Enabled    bool
+	Secret     string
+	SlugLength int
+	MaxProbes  int
+}
+
+type segmentLogConfig struct {
+	Dir             string
+	SegmentMaxBytes int64
+	FsyncPolicy     string
+	FsyncIntervalMs int
+}
+
+type linkStoreConfig struct {
+	CopyThreshold int
+	ForceCopy     bool
+}
+
+type idempotencyStoreConfig struct {
+	WindowSeconds int
+	// AbandonedAfterSeconds is how long a key may stay claimed without a link before another request takes it over.
+	AbandonedAfterSeconds int
+	PruneIntervalSeconds  int
+}
+
+// linkLifetimeConfig is how often links that expired or ran out of clicks are looked for and marked.
+type linkLifetimeConfig struct {
+	SweepIntervalSeconds int
+	SweepBatchSize       int
+}
+
+type passwordAttemptsConfig struct {
+	PerLinkLimit  int
+	PerIPLimit    int
+	WindowSeconds int
+}
+
+type linkHostRegistryConfig struct {
+	RefreshIntervalSeconds int
+	Verifier               linkHostVerifierConfig `mapstructure:"Verifier"`
+}
+
+type linkHostVerifierConfig struct {
+	TimeoutSeconds int
+	// DNSServer is the host:port TXT records are looked up at, the system resolver is used when it is empty.
+	DNSServer string
+}
+
+type destinationPolicyConfig struct {
+	RejectIPLiterals       bool
+	RejectPrivateAddresses bool
+	// DenyListPath and AllowListPath are files of domains, one per line, ".example.com" also matches subdomains.
+	// An empty path turns the list off.
+	DenyListPath      string
+	AllowListPath     string
+	DetectShorteners  bool
+	ShortenerListPath string
+	// LinkHosts are the other short domains this service answers on, links to them would redirect in a loop.
+	LinkHosts             []string
+	ReloadIntervalSeconds int
+}
+
+type linkKeyFilterConfig struct {
+	Enabled                 bool
+	ExpectedItems           int64
+	FalsePositiveRate       float64
+	SnapshotPath            string
+	SnapshotIntervalSeconds int
+	RefreshIntervalMs       int
+	CatchUpOverlapSeconds   int
 }
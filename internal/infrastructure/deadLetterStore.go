@@ -0,0 +1,135 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errDeadLetterStore = errors.New("errDeadLetterStore")
+
+type DeadLetterStore struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+}
+
+type DeadLetter struct {
+	ID         int64        `json:"id"`
+	Link       core.LinkDTO `json:"link"`
+	Reason     string       `json:"reason"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	ReplayedAt *time.Time   `json:"replayedAt"`
+}
+
+func NewDeadLetterStore(postgresClient *sqlx.DB, logger *logger.AppLogger) (*DeadLetterStore, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewDeadLetterStore: postgresClient is nil", errDeadLetterStore)
+	}
+
+	return &DeadLetterStore{postgresClient, logger}, nil
+}
+
+func (s *DeadLetterStore) SaveDeadLetters(ctx context.Context, links []core.LinkDTO, reason string) error {
+	tx, err := s.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: SaveDeadLetters: begin: %s", errDeadLetterStore, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, link := range links {
+		payload, marshalErr := json.Marshal(link)
+		if marshalErr != nil {
+			return fmt.Errorf("%w: SaveDeadLetters: marshal: %s", errDeadLetterStore, marshalErr)
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO encoded_urls_dead_letters (token_identifier, link, reason) VALUES ($1, $2, $3)",
+			link.Key.Value,
+			payload,
+			reason,
+		)
+		if err != nil {
+			return fmt.Errorf("%w: SaveDeadLetters: insert: %s", errDeadLetterStore, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: SaveDeadLetters: commit: %s", errDeadLetterStore, err)
+	}
+
+	return nil
+}
+
+func (s *DeadLetterStore) FindNotReplayed(ctx context.Context, limit int) ([]DeadLetter, error) {
+	rows, err := s.postgresClient.QueryxContext(
+		ctx,
+		`SELECT id, link, reason, created_at, replayed_at
+		FROM encoded_urls_dead_letters
+		WHERE replayed_at IS NULL
+		ORDER BY id
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: FindNotReplayed: query: %s", errDeadLetterStore, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var deadLetters []DeadLetter
+	for rows.Next() {
+		var (
+			deadLetter DeadLetter
+			payload    []byte
+		)
+		if err = rows.Scan(&deadLetter.ID, &payload, &deadLetter.Reason, &deadLetter.CreatedAt, &deadLetter.ReplayedAt); err != nil {
+			return nil, fmt.Errorf("%w: FindNotReplayed: scan: %s", errDeadLetterStore, err)
+		}
+		if err = json.Unmarshal(payload, &deadLetter.Link); err != nil {
+			return nil, fmt.Errorf("%w: FindNotReplayed: unmarshal %d: %s", errDeadLetterStore, deadLetter.ID, err)
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: FindNotReplayed: rows: %s", errDeadLetterStore, err)
+	}
+
+	return deadLetters, nil
+}
+
+func (s *DeadLetterStore) MarkReplayed(ctx context.Context, id int64) error {
+	_, err := s.postgresClient.ExecContext(
+		ctx,
+		"UPDATE encoded_urls_dead_letters SET replayed_at = CURRENT_TIMESTAMP WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: MarkReplayed: %s", errDeadLetterStore, err)
+	}
+
+	return nil
+}
+
+func (s *DeadLetterStore) UpdateReason(ctx context.Context, id int64, reason string) error {
+	_, err := s.postgresClient.ExecContext(
+		ctx,
+		"UPDATE encoded_urls_dead_letters SET reason = $2 WHERE id = $1",
+		id,
+		reason,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: UpdateReason: %s", errDeadLetterStore, err)
+	}
+
+	return nil
+}
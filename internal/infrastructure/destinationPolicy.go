@@ -0,0 +1,225 @@
+package infrastructure
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+var errDestinationPolicy = errors.New("errDestinationPolicy")
+
+// knownShorteners are hosts of public url shorteners, links to them hide the real destination.
+var knownShorteners = []string{
+	"bit.ly", "bitly.com", "tinyurl.com", "t.co", "goo.gl", "ow.ly", "is.gd", "v.gd", "buff.ly", "rebrand.ly",
+	"cutt.ly", "shorturl.at", "tiny.cc", "rb.gy", "t.ly", "s.id", "lnkd.in", "db.tt", "qr.ae", "adf.ly",
+}
+
+// DestinationPolicy runs the configured rules in order, the first rule that rejects a url decides.
+// Domain lists read from files are reloaded when the file changes, a file that fails to load keeps its last list.
+type DestinationPolicy struct {
+	logger *logger.AppLogger
+	config destinationPolicyConfig
+	rules  []destinationRule
+	files  []*domainListFile
+}
+
+type destinationRule func(*core.DestinationURL) *core.DestinationRejection
+
+func NewDestinationPolicy(
+	ctx context.Context,
+	logger *logger.AppLogger,
+	config destinationPolicyConfig,
+	linkHostRegistry core.LinkHostRegistry,
+) (*DestinationPolicy, error) {
+	policy := &DestinationPolicy{logger: logger, config: config}
+
+	linkHosts, err := core.NewDomainList(append([]string{core.DefaultLinkHost}, config.LinkHosts...))
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewDestinationPolicy: link hosts: %s", errDestinationPolicy, err)
+	}
+	policy.rules = append(policy.rules, func(destinationURL *core.DestinationURL) *core.DestinationRejection {
+		hostname := destinationURL.CanonicalHostname()
+		isBranded := linkHostRegistry != nil && linkHostRegistry.IsBranded(strings.TrimSuffix(hostname, "."))
+		if !isBranded && !linkHosts.Contains(hostname) {
+			return nil
+		}
+
+		return &core.DestinationRejection{Code: core.RejectionLinkHost, Reason: hostname + " is served by this shortener"}
+	})
+
+	if config.RejectIPLiterals || config.RejectPrivateAddresses {
+		policy.rules = append(policy.rules, func(destinationURL *core.DestinationURL) *core.DestinationRejection {
+			return core.CheckDestinationAddress(destinationURL, config.RejectIPLiterals, config.RejectPrivateAddresses)
+		})
+	}
+
+	if config.DenyListPath != "" {
+		denyList, err := policy.watch(config.DenyListPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.rules = append(policy.rules, listRule(denyList.current, true, core.RejectionDeniedDomain, "is denied"))
+	}
+
+	if config.AllowListPath != "" {
+		allowList, err := policy.watch(config.AllowListPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.rules = append(policy.rules, listRule(allowList.current, false, core.RejectionNotAllowed, "is not allowed"))
+	}
+
+	if config.DetectShorteners {
+		shorteners, err := core.NewDomainList(knownShorteners)
+		if err != nil {
+			return nil, fmt.Errorf("%w: NewDestinationPolicy: known shorteners: %s", errDestinationPolicy, err)
+		}
+		policy.rules = append(policy.rules, listRule(
+			func() *core.DomainList { return shorteners },
+			true,
+			core.RejectionShortener,
+			"is a url shortener",
+		))
+
+		if config.ShortenerListPath != "" {
+			shortenerList, err := policy.watch(config.ShortenerListPath)
+			if err != nil {
+				return nil, err
+			}
+			policy.rules = append(policy.rules, listRule(
+				shortenerList.current,
+				true,
+				core.RejectionShortener,
+				"is a url shortener",
+			))
+		}
+	}
+
+	if 0 < len(policy.files) {
+		go policy.reloadLoop(ctx)
+	}
+
+	return policy, nil
+}
+
+func (p *DestinationPolicy) Evaluate(destinationURL *core.DestinationURL) *core.DestinationRejection {
+	for _, rule := range p.rules {
+		if rejection := rule(destinationURL); rejection != nil {
+			return rejection
+		}
+	}
+
+	return nil
+}
+
+// listRule rejects hosts on the list when rejectListed is set, and hosts missing from it otherwise.
+func listRule(list func() *core.DomainList, rejectListed bool, code string, reason string) destinationRule {
+	return func(destinationURL *core.DestinationURL) *core.DestinationRejection {
+		hostname := destinationURL.CanonicalHostname()
+		if list().Contains(hostname) != rejectListed {
+			return nil
+		}
+
+		return &core.DestinationRejection{Code: code, Reason: hostname + " " + reason}
+	}
+}
+
+func (p *DestinationPolicy) watch(path string) (*domainListFile, error) {
+	file := &domainListFile{path: path}
+	if _, err := file.reload(); err != nil {
+		return nil, fmt.Errorf("%w: NewDestinationPolicy: %s", errDestinationPolicy, err)
+	}
+	p.files = append(p.files, file)
+
+	return file, nil
+}
+
+func (p *DestinationPolicy) reloadLoop(ctx context.Context) {
+	reloadInterval := time.Duration(p.config.ReloadIntervalSeconds) * time.Second
+	if reloadInterval <= 0 {
+		reloadInterval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, file := range p.files {
+				isReloaded, err := file.reload()
+				if err != nil {
+					p.logger.WarnContext(ctx, "destination policy list reload failed", "path", file.path, "err", err)
+
+					continue
+				}
+				if isReloaded {
+					p.logger.InfoContext(ctx, "destination policy list reloaded", "path", file.path, "entries", file.current().Len())
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// domainListFile is a domain list read from a file with one entry per line, "#" starts a comment.
+type domainListFile struct {
+	path    string
+	list    atomic.Pointer[core.DomainList]
+	modTime time.Time
+	size    int64
+}
+
+func (f *domainListFile) current() *core.DomainList {
+	return f.list.Load()
+}
+
+// reload reads the file again when its modification time or size changed since the last load.
+func (f *domainListFile) reload() (bool, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("reload %s: %w", f.path, err)
+	}
+	if f.list.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false, fmt.Errorf("reload %s: %w", f.path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, fmt.Errorf("reload %s: %w", f.path, err)
+	}
+
+	list, err := core.NewDomainList(entries)
+	if err != nil {
+		return false, fmt.Errorf("reload %s: %w", f.path, err)
+	}
+
+	f.list.Store(list)
+	f.modTime, f.size = info.ModTime(), info.Size()
+
+	return true, nil
+}
@@ -0,0 +1,207 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errDeterministicLinkKeyStore = errors.New("errDeterministicLinkKeyStore")
+
+// DeterministicLinkKeyStore derives the key from a keyed hash of the link host, destination url, a namespace,
+// the owner and the redirect status, so the same request always gets the same link without the identity db.
+// Keys live in their own slug length band, apart from every band the token store may reach, so they never meet
+// its keys in encoded_urls. Claims are recorded in deterministic_link_keys; a key claimed for another seed is
+// a collision and the next probe is derived instead. Claims derived before owner and redirect status were
+// part of the seed are marked is_unscoped_seed and are looked up instead, so their links keep their keys.
+// Those made before canonical forms are also marked is_legacy_seed and are found by the url as spelled then.
+type DeterministicLinkKeyStore struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	config         deterministicKeyStoreConfig
+	band           core.LinkKeyBand
+}
+
+func NewDeterministicLinkKeyStore(
+	postgresClient *sqlx.DB,
+	logger *logger.AppLogger,
+	config deterministicKeyStoreConfig,
+	tokenStoreConfig tokenStoreConfig,
+) (*DeterministicLinkKeyStore, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewDeterministicLinkKeyStore: postgresClient is nil", errDeterministicLinkKeyStore)
+	}
+	if len(config.Secret) < minSecretBytes {
+		return nil, fmt.Errorf(
+			"%w: NewDeterministicLinkKeyStore: secret must be at least %d bytes long",
+			errDeterministicLinkKeyStore,
+			minSecretBytes,
+		)
+	}
+
+	band, err := core.NewLinkKeyBand(config.SlugLength)
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewDeterministicLinkKeyStore: %s", errDeterministicLinkKeyStore, err)
+	}
+
+	minIssued, maxIssued, err := tokenStoreConfig.issuedSlugLengths()
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewDeterministicLinkKeyStore: %s", errDeterministicLinkKeyStore, err)
+	}
+	if minIssued <= band.SlugLength && band.SlugLength <= maxIssued {
+		return nil, fmt.Errorf(
+			"%w: NewDeterministicLinkKeyStore: slug length %d is issued by the token store already (%d .. %d)",
+			errDeterministicLinkKeyStore,
+			band.SlugLength,
+			minIssued,
+			maxIssued,
+		)
+	}
+
+	return &DeterministicLinkKeyStore{
+		postgresClient: postgresClient,
+		logger:         logger,
+		config:         config,
+		band:           *band,
+	}, nil
+}
+
+const minSecretBytes = 16
+
+func (s *DeterministicLinkKeyStore) Issue(ctx context.Context, seed core.LinkKeySeedDto) (*core.LinkKey, error) {
+	unscopedKey, err := s.findUnscopedClaim(ctx, seed)
+	if err != nil {
+		return nil, err
+	}
+	if unscopedKey != nil {
+		return core.NewLinkKey(*unscopedKey)
+	}
+
+	maxProbes := max(1, s.config.MaxProbes)
+	for probe := range maxProbes {
+		key := s.derive(seed, probe)
+
+		isClaimed, err := s.claim(ctx, key, seed)
+		if err != nil {
+			return nil, err
+		}
+		if isClaimed {
+			return core.NewLinkKey(key)
+		}
+
+		s.logger.WarnContext(ctx, "deterministic link key collision, probing next", "key", key, "probe", probe)
+	}
+
+	return nil, fmt.Errorf("%w: Issue: no free key after %d probes", errDeterministicLinkKeyStore, maxProbes)
+}
+
+func (s *DeterministicLinkKeyStore) derive(seed core.LinkKeySeedDto, probe int) int64 {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	// The default host is left out, so keys derived before branded hosts existed stay the same.
+	if seed.Host != core.DefaultLinkHost {
+		mac.Write([]byte(seed.Host))
+		mac.Write([]byte{0})
+	}
+	mac.Write([]byte(seed.Namespace))
+	mac.Write([]byte{0, byte(probe)})
+	mac.Write([]byte(seed.DestinationURL))
+	// Owner and redirect status are left out when unset, so keys of anonymous links stay the same as well.
+	if seed.Owner != "" {
+		mac.Write([]byte("\x00owner=" + seed.Owner))
+	}
+	if seed.RedirectStatus != nil {
+		mac.Write([]byte("\x00status=" + strconv.Itoa(seed.RedirectStatus.Value)))
+	}
+
+	size := uint64(s.band.Last - s.band.First + 1) //nolint:gosec // positive
+	offset := binary.BigEndian.Uint64(mac.Sum(nil)) % size
+
+	return s.band.First + int64(offset) //nolint:gosec // less than band size
+}
+
+// findUnscopedClaim is nil when no key was claimed for the seed before owner and redirect status were part of it.
+func (s *DeterministicLinkKeyStore) findUnscopedClaim(ctx context.Context, seed core.LinkKeySeedDto) (*int64, error) {
+	var key int64
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		`SELECT token_identifier FROM deterministic_link_keys
+		WHERE is_unscoped_seed AND host = $1 AND namespace = $2 AND owner = $3
+			AND redirect_status IS NOT DISTINCT FROM $4
+			AND ((is_legacy_seed AND url = $5) OR (NOT is_legacy_seed AND url = $6))
+		ORDER BY token_identifier
+		LIMIT 1`,
+		seed.Host,
+		seed.Namespace,
+		seed.Owner,
+		seedRedirectStatus(seed),
+		seed.LegacyDestinationURL,
+		seed.DestinationURL,
+	).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil //nolint:nilnil // not claimed before owner and redirect status were part of the seed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: findUnscopedClaim: %s", errDeterministicLinkKeyStore, err)
+	}
+
+	return &key, nil
+}
+
+// claim is true when the key is now or was already claimed for the same host, url, namespace, owner and
+// redirect status.
+func (s *DeterministicLinkKeyStore) claim(ctx context.Context, key int64, seed core.LinkKeySeedDto) (bool, error) {
+	var (
+		host, namespace, url, owner string
+		redirectStatus              sql.NullInt16
+	)
+	// A claim racing with an uncommitted one for the same key sees neither row, it is simply repeated.
+	for range 2 {
+		err := s.postgresClient.QueryRowxContext(
+			ctx,
+			`WITH claimed AS (
+				INSERT INTO deterministic_link_keys (token_identifier, namespace, url, host, owner, redirect_status)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (token_identifier) DO NOTHING
+				RETURNING host, namespace, url, owner, redirect_status
+			)
+			SELECT host, namespace, url, owner, redirect_status FROM claimed
+			UNION ALL
+			SELECT host, namespace, url, owner, redirect_status FROM deterministic_link_keys WHERE token_identifier = $1
+			LIMIT 1`,
+			key,
+			seed.Namespace,
+			seed.DestinationURL,
+			seed.Host,
+			seed.Owner,
+			seedRedirectStatus(seed),
+		).Scan(&host, &namespace, &url, &owner, &redirectStatus)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: claim: %s", errDeterministicLinkKeyStore, err)
+		}
+
+		return host == seed.Host && namespace == seed.Namespace && url == seed.DestinationURL &&
+			owner == seed.Owner && redirectStatus == seedRedirectStatus(seed), nil
+	}
+
+	return false, fmt.Errorf("%w: claim: key %d is being claimed concurrently", errDeterministicLinkKeyStore, key)
+}
+
+func seedRedirectStatus(seed core.LinkKeySeedDto) sql.NullInt16 {
+	if seed.RedirectStatus == nil {
+		return sql.NullInt16{}
+	}
+
+	return sql.NullInt16{Int16: int16(seed.RedirectStatus.Value), Valid: true} //nolint:gosec // its validated
+}
@@ -0,0 +1,183 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errIdempotencyStore = errors.New("errIdempotencyStore")
+
+// IdempotencyStore keeps the link produced for each idempotency key during the retry window. A key is claimed
+// with a placeholder row before encoding and completed with the link after, so concurrent retries on other
+// instances see the request in progress. Placeholders left by crashed requests are taken over once abandoned.
+type IdempotencyStore struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	config         idempotencyStoreConfig
+}
+
+func NewIdempotencyStore(
+	ctx context.Context,
+	postgresClient *sqlx.DB,
+	logger *logger.AppLogger,
+	config idempotencyStoreConfig,
+) (*IdempotencyStore, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewIdempotencyStore: postgresClient is nil", errIdempotencyStore)
+	}
+	if config.WindowSeconds <= 0 {
+		config.WindowSeconds = 24 * 60 * 60
+	}
+	if config.AbandonedAfterSeconds <= 0 {
+		config.AbandonedAfterSeconds = 60
+	}
+	if config.PruneIntervalSeconds <= 0 {
+		config.PruneIntervalSeconds = 60
+	}
+
+	store := &IdempotencyStore{postgresClient: postgresClient, logger: logger, config: config}
+	go store.pruneLoop(ctx)
+
+	return store, nil
+}
+
+func (s *IdempotencyStore) Claim(
+	ctx context.Context,
+	keyDto core.IdempotencyKeyDto,
+	requestFingerprint []byte,
+) (*core.IdempotencyRecordDto, error) {
+	// A claim racing with an uncommitted one for the same key sees neither row, it is simply repeated.
+	for range 2 {
+		var isClaimed bool
+		err := s.postgresClient.QueryRowxContext(
+			ctx,
+			`INSERT INTO idempotency_keys (owner, idempotency_key, request_fingerprint) VALUES ($1, $2, $3)
+			ON CONFLICT (owner, idempotency_key) DO UPDATE
+			SET request_fingerprint = EXCLUDED.request_fingerprint, link = NULL, created_at = CURRENT_TIMESTAMP
+			WHERE idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $4)
+				OR (idempotency_keys.link IS NULL AND idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $5))
+			RETURNING true`,
+			keyDto.Owner,
+			keyDto.Key,
+			requestFingerprint,
+			s.config.WindowSeconds,
+			s.config.AbandonedAfterSeconds,
+		).Scan(&isClaimed)
+		if err == nil {
+			return &core.IdempotencyRecordDto{IsClaimed: true, RequestFingerprint: requestFingerprint}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: Claim: %s", errIdempotencyStore, err)
+		}
+
+		record, isFound, err := s.find(ctx, keyDto)
+		if err != nil {
+			return nil, err
+		}
+		if isFound {
+			return record, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: Claim: key %s is contended", errIdempotencyStore, keyDto.Key)
+}
+
+func (s *IdempotencyStore) find(
+	ctx context.Context,
+	keyDto core.IdempotencyKeyDto,
+) (*core.IdempotencyRecordDto, bool, error) {
+	var (
+		record  core.IdempotencyRecordDto
+		payload []byte
+	)
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		"SELECT request_fingerprint, link FROM idempotency_keys WHERE owner = $1 AND idempotency_key = $2",
+		keyDto.Owner,
+		keyDto.Key,
+	).Scan(&record.RequestFingerprint, &payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: find: %s", errIdempotencyStore, err)
+	}
+
+	if payload != nil {
+		var link core.LinkDTO
+		if err = json.Unmarshal(payload, &link); err != nil {
+			return nil, false, fmt.Errorf("%w: find: unmarshal: %s", errIdempotencyStore, err)
+		}
+		record.Link = &link
+	}
+
+	return &record, true, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, keyDto core.IdempotencyKeyDto, link core.LinkDTO) error {
+	payload, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("%w: Complete: marshal: %s", errIdempotencyStore, err)
+	}
+
+	_, err = s.postgresClient.ExecContext(
+		ctx,
+		"UPDATE idempotency_keys SET link = $3 WHERE owner = $1 AND idempotency_key = $2",
+		keyDto.Owner,
+		keyDto.Key,
+		payload,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: Complete: %s", errIdempotencyStore, err)
+	}
+
+	return nil
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, keyDto core.IdempotencyKeyDto) error {
+	_, err := s.postgresClient.ExecContext(
+		ctx,
+		"DELETE FROM idempotency_keys WHERE owner = $1 AND idempotency_key = $2 AND link IS NULL",
+		keyDto.Owner,
+		keyDto.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: Release: %s", errIdempotencyStore, err)
+	}
+
+	return nil
+}
+
+func (s *IdempotencyStore) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.PruneIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := s.postgresClient.ExecContext(
+				ctx,
+				"DELETE FROM idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+				s.config.WindowSeconds,
+			)
+			if err != nil {
+				s.logger.WarnContext(ctx, "idempotency keys prune failed", "err", err)
+
+				continue
+			}
+			if pruned, _ := result.RowsAffected(); 0 < pruned {
+				s.logger.DebugContext(ctx, "idempotency keys pruned", "count", pruned)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	linkKeyStoreModeSequence = "sequence"
+	linkKeyStoreModeLease    = "lease"
+
+	// linkKeySequenceLock serializes whoever moves the sequence in bulk (first band floor, leases)
+	// against batches of nextval, which take it shared.
+	linkKeySequenceLock = "SELECT pg_advisory_xact_lock(hashtext('token_identifier'))"
+	linkKeyBatchLock    = "SELECT pg_advisory_xact_lock_shared(hashtext('token_identifier'))"
+
+	releaseLeaseTimeout = time.Second
+)
+
+// keyLeaser claims contiguous ranges of keys and hands them out locally. It is used by the refill loop and
+// by batches that need more keys than the buffer holds at the same time, mu keeps them from sharing a key.
+// Leases are taken from the same space as the sequence: a lease starts after the sequence and moves it
+// past its end, so instances in both modes never share a key.
+type keyLeaser struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	config         tokenStoreConfig
+	owner          string
+
+	mu        sync.Mutex
+	leaseID   int64
+	next      int64
+	last      int64
+	size      int64
+	claimedAt time.Time
+	issued    int64
+}
+
+func newKeyLeaser(postgresClient *sqlx.DB, logger *logger.AppLogger, config tokenStoreConfig) *keyLeaser {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &keyLeaser{
+		postgresClient: postgresClient,
+		logger:         logger,
+		config:         config,
+		owner:          fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		size:           max(1, config.LeaseMinSize),
+	}
+}
+
+func (l *keyLeaser) nextIDs(ctx context.Context, count int) ([]int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := make([]int64, 0, count)
+	for len(ids) < count {
+		if l.last < l.next {
+			if err := l.claim(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		take := min(int64(count-len(ids)), l.last-l.next+1)
+		for i := range take {
+			ids = append(ids, l.next+i)
+		}
+		l.next += take
+		l.issued += take
+	}
+
+	return ids, nil
+}
+
+// claim takes the next lease sized so it lasts about LeaseTargetSeconds at the rate the previous one was used.
+// The caller holds l.mu.
+func (l *keyLeaser) claim(ctx context.Context) error {
+	if !l.claimedAt.IsZero() {
+		if elapsed := time.Since(l.claimedAt).Seconds(); 0 < elapsed {
+			rate := float64(l.issued) / elapsed
+			l.size = int64(rate * float64(l.config.LeaseTargetSeconds))
+			l.size = max(l.size, l.config.LeaseMinSize, 1)
+			if 0 < l.config.LeaseMaxSize {
+				l.size = min(l.size, l.config.LeaseMaxSize)
+			}
+		}
+	}
+
+	tx, err := l.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: claim: begin: %s", errLinkKeyStore, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, linkKeySequenceLock); err != nil {
+		return fmt.Errorf("%w: claim: lock: %s", errLinkKeyStore, err)
+	}
+
+	var leaseID, first, last, sequenceValue int64
+	err = tx.QueryRowxContext(
+		ctx,
+		`WITH cursor AS (
+			UPDATE key_lease_cursor
+			SET next_key = GREATEST(next_key, (SELECT last_value + 1 FROM token_identifier)) + $1::bigint
+			WHERE id = 1
+			RETURNING next_key - $1::bigint AS first_key, next_key - 1 AS last_key
+		), lease AS (
+			INSERT INTO key_leases (owner, first_key, last_key)
+			SELECT $2, first_key, last_key FROM cursor
+			RETURNING id, first_key, last_key
+		)
+		SELECT id, first_key, last_key, setval('token_identifier', last_key) FROM lease`,
+		l.size,
+		l.owner,
+	).Scan(&leaseID, &first, &last, &sequenceValue)
+	if err != nil {
+		return fmt.Errorf("%w: claim: %s", errLinkKeyStore, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: claim: commit: %s", errLinkKeyStore, err)
+	}
+
+	l.leaseID, l.next, l.last = leaseID, first, last
+	l.claimedAt, l.issued = time.Now(), 0
+	l.logger.InfoContext(ctx, "link key lease claimed", "lease", leaseID, "first", first, "last", last)
+
+	return nil
+}
+
+// release records how far the lease was used, the rest of it is never handed out again.
+func (l *keyLeaser) release(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.leaseID == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseLeaseTimeout)
+	defer cancel()
+
+	_, err := l.postgresClient.ExecContext(
+		ctx,
+		"UPDATE key_leases SET released_at = now(), last_issued_key = $2 WHERE id = $1",
+		l.leaseID,
+		l.next-1,
+	)
+	if err != nil {
+		l.logger.WarnContext(ctx, "link key lease release failed", "lease", l.leaseID, "err", err)
+	}
+}
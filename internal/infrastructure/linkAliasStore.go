@@ -0,0 +1,91 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errLinkAliasStore = errors.New("errLinkAliasStore")
+
+// LinkAliasStore owns uniqueness of aliases per host. An alias is claimed synchronously while encoding,
+// before the link itself is persisted by the batch job, so two requests can never end up with the same alias.
+type LinkAliasStore struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+}
+
+func NewLinkAliasStore(postgresClient *sqlx.DB, logger *logger.AppLogger) (*LinkAliasStore, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewLinkAliasStore: postgresClient is nil", errLinkAliasStore)
+	}
+
+	return &LinkAliasStore{postgresClient, logger}, nil
+}
+
+func (s *LinkAliasStore) Claim(
+	ctx context.Context,
+	hostDto core.LinkHostDto,
+	aliasDto core.LinkAliasDto,
+	keyDto core.LinkKeyDto,
+) (bool, error) {
+	result, err := s.postgresClient.ExecContext(
+		ctx,
+		`INSERT INTO link_aliases (host, alias, token_identifier) VALUES ($1, $2, $3)
+		ON CONFLICT (host, alias) DO NOTHING`,
+		hostDto.Hostname,
+		aliasDto.Value,
+		keyDto.Value,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%w: Claim: %s", errLinkAliasStore, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: Claim: %s", errLinkAliasStore, err)
+	}
+
+	return affected == 1, nil
+}
+
+func (s *LinkAliasStore) Release(ctx context.Context, hostDto core.LinkHostDto, aliasDto core.LinkAliasDto) error {
+	_, err := s.postgresClient.ExecContext(
+		ctx,
+		"DELETE FROM link_aliases WHERE host = $1 AND alias = $2",
+		hostDto.Hostname,
+		aliasDto.Value,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: Release: %s", errLinkAliasStore, err)
+	}
+
+	return nil
+}
+
+func (s *LinkAliasStore) FindKey(
+	ctx context.Context,
+	hostDto core.LinkHostDto,
+	aliasDto core.LinkAliasDto,
+) (*core.LinkKeyDto, bool, error) {
+	var key int64
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		"SELECT token_identifier FROM link_aliases WHERE host = $1 AND alias = $2",
+		hostDto.Hostname,
+		aliasDto.Value,
+	).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: FindKey: %s", errLinkAliasStore, err)
+	}
+
+	return &core.LinkKeyDto{Value: key}, true, nil
+}
@@ -0,0 +1,160 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errLinkClickStore = errors.New("errLinkClickStore")
+
+const (
+	defaultSweepInterval  = time.Minute
+	defaultSweepBatchSize = 1000
+)
+
+// LinkClickStore counts clicks of links with a click cap in link_clicks, one row per link, so concurrent
+// clicks on any instance are counted exactly once and never past the cap. Its sweeper marks links that
+// expired or ran out of clicks in encoded_urls.expired_at and announces them like a destination change,
+// so instances drop them from their caches.
+type LinkClickStore struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	config         linkLifetimeConfig
+}
+
+func NewLinkClickStore(
+	ctx context.Context,
+	postgresClient *sqlx.DB,
+	logger *logger.AppLogger,
+	config linkLifetimeConfig,
+) (*LinkClickStore, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewLinkClickStore: postgresClient is nil", errLinkClickStore)
+	}
+
+	store := &LinkClickStore{postgresClient: postgresClient, logger: logger, config: config}
+	go store.sweepLoop(ctx)
+
+	return store, nil
+}
+
+// CountClick is false when the link had maxClicks clicks already, the click is not counted then.
+func (s *LinkClickStore) CountClick(ctx context.Context, key core.LinkKeyDto, maxClicks int64) (bool, error) {
+	var clicks int64
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		`INSERT INTO link_clicks (token_identifier, clicks) VALUES ($1, 1)
+		ON CONFLICT (token_identifier) DO UPDATE SET clicks = link_clicks.clicks + 1
+		WHERE link_clicks.clicks < $2
+		RETURNING clicks`,
+		key.Value,
+		maxClicks,
+	).Scan(&clicks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: CountClick: %s", errLinkClickStore, err)
+	}
+
+	return true, nil
+}
+
+// IsCapReached tells without counting a click.
+func (s *LinkClickStore) IsCapReached(ctx context.Context, key core.LinkKeyDto, maxClicks int64) (bool, error) {
+	var clicks int64
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		"SELECT clicks FROM link_clicks WHERE token_identifier = $1",
+		key.Value,
+	).Scan(&clicks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: IsCapReached: %s", errLinkClickStore, err)
+	}
+
+	return maxClicks <= clicks, nil
+}
+
+// sweep marks up to SweepBatchSize links, instances sweeping at once skip the links another one has locked.
+func (s *LinkClickStore) sweep(ctx context.Context) (int, error) {
+	batchSize := s.config.SweepBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultSweepBatchSize
+	}
+
+	var marked int
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		`WITH expired AS (
+			UPDATE encoded_urls SET expired_at = CURRENT_TIMESTAMP
+			WHERE token_identifier IN (
+				SELECT u.token_identifier FROM encoded_urls u
+				LEFT JOIN link_clicks c ON c.token_identifier = u.token_identifier
+				WHERE u.expired_at IS NULL AND (u.expires_at IS NOT NULL OR u.max_clicks IS NOT NULL)
+					AND (u.expires_at <= CURRENT_TIMESTAMP OR u.max_clicks <= c.clicks)
+				LIMIT $1
+				FOR UPDATE OF u SKIP LOCKED
+			)
+			RETURNING token_identifier
+		), notified AS (
+			SELECT pg_notify($2, token_identifier::text) FROM expired
+		)
+		SELECT count(*) FROM notified`,
+		batchSize,
+		linkUpdatedChannel,
+	).Scan(&marked)
+	if err != nil {
+		return 0, fmt.Errorf("%w: sweep: %s", errLinkClickStore, err)
+	}
+
+	return marked, nil
+}
+
+func (s *LinkClickStore) sweepLoop(ctx context.Context) {
+	sweepInterval := time.Duration(s.config.SweepIntervalSeconds) * time.Second
+	if sweepInterval <= 0 {
+		sweepInterval = defaultSweepInterval
+	}
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweepAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *LinkClickStore) sweepAll(ctx context.Context) {
+	total := 0
+	for ctx.Err() == nil {
+		marked, err := s.sweep(ctx)
+		if err != nil {
+			s.logger.WarnContext(ctx, "link expiry sweep failed", "err", err)
+
+			return
+		}
+		total += marked
+		if marked == 0 {
+			break
+		}
+	}
+
+	if 0 < total {
+		s.logger.InfoContext(ctx, "links marked expired", "count", total)
+	}
+}
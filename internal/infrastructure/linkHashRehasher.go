@@ -0,0 +1,129 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var errLinkHashRehasher = errors.New("errLinkHashRehasher")
+
+// LinkHashRehasher makes the url hashes of encoded_urls again from the canonical form of their url.
+// Links stored before canonical forms or under another canonicalization policy are not reused by requests
+// for the same url until then. It is run by the rehash-urls command after upgrading or changing the policy.
+type LinkHashRehasher struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	policy         core.CanonicalizationPolicy
+}
+
+func NewLinkHashRehasher(
+	postgresClient *sqlx.DB,
+	logger *logger.AppLogger,
+	policy core.CanonicalizationPolicy,
+) (*LinkHashRehasher, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewLinkHashRehasher: postgresClient is nil", errLinkHashRehasher)
+	}
+
+	return &LinkHashRehasher{postgresClient: postgresClient, logger: logger, policy: policy}, nil
+}
+
+// RehashAll goes through links hashed under another policy in batches of batchSize.
+// Links changed meanwhile are skipped, a change hashes them under the current policy already.
+func (r *LinkHashRehasher) RehashAll(ctx context.Context, batchSize int) (int, error) {
+	policyID := r.policy.ID()
+
+	var rehashed int
+	var after int64
+	for {
+		keys, urls, err := r.findStale(ctx, policyID, after, batchSize)
+		if err != nil {
+			return rehashed, err
+		}
+		if len(keys) == 0 {
+			return rehashed, nil
+		}
+
+		// An url that does not parse anymore gets no hash, it is never reused then.
+		hashes := make([][]byte, len(urls))
+		for i, rawURL := range urls {
+			destinationURL, parseErr := core.NewURLWithPolicies(rawURL, core.UserinfoStrip, r.policy)
+			if parseErr != nil {
+				r.logger.WarnContext(ctx, "stored url does not parse, its hash is dropped", "key", keys[i], "err", parseErr)
+				hashes[i] = []byte{}
+
+				continue
+			}
+			hashes[i] = destinationURL.Fingerprint()
+		}
+
+		result, err := r.postgresClient.ExecContext(
+			ctx,
+			`UPDATE encoded_urls AS e SET url_hash = NULLIF(u.url_hash, ''::bytea), url_hash_policy = $4
+			FROM unnest($1::bigint[], $2::text[], $3::bytea[]) AS u (token_identifier, url, url_hash)
+			WHERE e.token_identifier = u.token_identifier AND e.url = u.url`,
+			pq.Array(keys),
+			pq.Array(urls),
+			pq.Array(hashes),
+			policyID,
+		)
+		if err != nil {
+			return rehashed, fmt.Errorf("%w: RehashAll: %s", errLinkHashRehasher, err)
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return rehashed, fmt.Errorf("%w: RehashAll: %s", errLinkHashRehasher, err)
+		}
+
+		rehashed += int(updated)
+		after = keys[len(keys)-1]
+		r.logger.InfoContext(ctx, "url hashes remade", "rehashed", rehashed, "lastKey", after)
+	}
+}
+
+func (r *LinkHashRehasher) findStale(
+	ctx context.Context,
+	policyID string,
+	after int64,
+	batchSize int,
+) ([]int64, []string, error) {
+	rows, err := r.postgresClient.QueryxContext(
+		ctx,
+		`SELECT token_identifier, url FROM encoded_urls
+		WHERE token_identifier > $1 AND url_hash_policy IS DISTINCT FROM $2
+		ORDER BY token_identifier
+		LIMIT $3`,
+		after,
+		policyID,
+		batchSize,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: findStale: %s", errLinkHashRehasher, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	keys := make([]int64, 0, batchSize)
+	urls := make([]string, 0, batchSize)
+	for rows.Next() {
+		var key int64
+		var url string
+		if err = rows.Scan(&key, &url); err != nil {
+			return nil, nil, fmt.Errorf("%w: findStale: %s", errLinkHashRehasher, err)
+		}
+		keys = append(keys, key)
+		urls = append(urls, url)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: findStale: %s", errLinkHashRehasher, err)
+	}
+
+	return keys, urls, nil
+}
@@ -0,0 +1,258 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errLinkHostRegistry = errors.New("errLinkHostRegistry")
+
+const linkHostColumns = `hostname, owner, status, challenge_token, verification_method, verified_at, checked_at,
+	failed_checks, last_error, created_at`
+
+// LinkHostRegistry persists branded hosts in link_hosts. Lookups while encoding and resolving are answered
+// from a snapshot of the verified hosts that is refreshed periodically and right after a change on this
+// instance, so other instances see a change within RefreshIntervalSeconds.
+type LinkHostRegistry struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	config         linkHostRegistryConfig
+	hostnames      atomic.Pointer[map[string]struct{}]
+}
+
+func NewLinkHostRegistry(
+	ctx context.Context,
+	postgresClient *sqlx.DB,
+	logger *logger.AppLogger,
+	config linkHostRegistryConfig,
+) (*LinkHostRegistry, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewLinkHostRegistry: postgresClient is nil", errLinkHostRegistry)
+	}
+
+	registry := &LinkHostRegistry{postgresClient: postgresClient, logger: logger, config: config}
+	if err := registry.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	go registry.refreshLoop(ctx)
+
+	return registry, nil
+}
+
+func (r *LinkHostRegistry) IsBranded(hostname string) bool {
+	_, isBranded := (*r.hostnames.Load())[hostname]
+
+	return isBranded
+}
+
+func (r *LinkHostRegistry) List(ctx context.Context) ([]core.BrandedHostDto, error) {
+	var hosts []core.BrandedHostDto
+	rows, err := r.postgresClient.QueryxContext(
+		ctx,
+		"SELECT "+linkHostColumns+" FROM link_hosts ORDER BY hostname",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: List: %s", errLinkHostRegistry, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		host, scanErr := scanBrandedHost(rows)
+		if scanErr != nil {
+			return nil, fmt.Errorf("%w: List: scan: %s", errLinkHostRegistry, scanErr)
+		}
+		hosts = append(hosts, *host)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: List: rows: %s", errLinkHostRegistry, err)
+	}
+
+	return hosts, nil
+}
+
+func (r *LinkHostRegistry) Find(ctx context.Context, hostname string) (*core.BrandedHostDto, bool, error) {
+	host, err := scanBrandedHost(r.postgresClient.QueryRowxContext(
+		ctx,
+		"SELECT "+linkHostColumns+" FROM link_hosts WHERE hostname = $1",
+		hostname,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: Find: %s", errLinkHostRegistry, err)
+	}
+
+	return host, true, nil
+}
+
+// Register adds the host as pending with the given challenge token or updates the owner of a registered host.
+// The same owner keeps status and token, a new owner has to verify the host again with the given token.
+// It is true when the host was added.
+func (r *LinkHostRegistry) Register(ctx context.Context, host core.BrandedHostDto) (*core.BrandedHostDto, bool, error) {
+	var isAdded bool
+	registered, err := scanBrandedHost(
+		r.postgresClient.QueryRowxContext(
+			ctx,
+			`INSERT INTO link_hosts (hostname, owner, status, challenge_token) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (hostname) DO UPDATE SET owner = EXCLUDED.owner,
+				status = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.status ELSE EXCLUDED.status END,
+				challenge_token = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.challenge_token
+					ELSE EXCLUDED.challenge_token END,
+				verification_method = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.verification_method
+					ELSE '' END,
+				verified_at = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.verified_at END,
+				checked_at = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.checked_at END,
+				failed_checks = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.failed_checks ELSE 0 END,
+				last_error = CASE WHEN link_hosts.owner = EXCLUDED.owner THEN link_hosts.last_error ELSE '' END
+			RETURNING `+linkHostColumns+`, xmax = 0`,
+			host.Hostname,
+			host.Owner,
+			core.BrandedHostPending,
+			host.ChallengeToken,
+		),
+		&isAdded,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: Register: %s", errLinkHostRegistry, err)
+	}
+
+	r.refreshAfterChange(ctx)
+
+	return registered, isAdded, nil
+}
+
+// SaveCheck stores the outcome of an ownership check, it is false when the host was removed meanwhile.
+func (r *LinkHostRegistry) SaveCheck(ctx context.Context, host core.BrandedHostDto) (bool, error) {
+	result, err := r.postgresClient.ExecContext(
+		ctx,
+		`UPDATE link_hosts SET status = $2, verification_method = $3, verified_at = $4, checked_at = $5,
+			failed_checks = $6, last_error = $7
+		WHERE hostname = $1`,
+		host.Hostname,
+		host.Status,
+		host.VerificationMethod,
+		host.VerifiedAt,
+		host.CheckedAt,
+		host.FailedChecks,
+		host.LastError,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%w: SaveCheck: %s", errLinkHostRegistry, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: SaveCheck: %s", errLinkHostRegistry, err)
+	}
+
+	r.refreshAfterChange(ctx)
+
+	return affected == 1, nil
+}
+
+// Remove stops links from being issued and resolved on the host, the links themselves are kept.
+func (r *LinkHostRegistry) Remove(ctx context.Context, hostname string) (bool, error) {
+	result, err := r.postgresClient.ExecContext(ctx, "DELETE FROM link_hosts WHERE hostname = $1", hostname)
+	if err != nil {
+		return false, fmt.Errorf("%w: Remove: %s", errLinkHostRegistry, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w: Remove: %s", errLinkHostRegistry, err)
+	}
+
+	r.refreshAfterChange(ctx)
+
+	return affected == 1, nil
+}
+
+func (r *LinkHostRegistry) refreshAfterChange(ctx context.Context) {
+	if err := r.refresh(ctx); err != nil {
+		r.logger.WarnContext(ctx, "link host registry refresh after change failed", "err", err)
+	}
+}
+
+func (r *LinkHostRegistry) refresh(ctx context.Context) error {
+	var hostnames []string
+	if err := r.postgresClient.SelectContext(
+		ctx,
+		&hostnames,
+		"SELECT hostname FROM link_hosts WHERE status = $1",
+		core.BrandedHostVerified,
+	); err != nil {
+		return fmt.Errorf("%w: refresh: %s", errLinkHostRegistry, err)
+	}
+
+	snapshot := make(map[string]struct{}, len(hostnames))
+	for _, hostname := range hostnames {
+		snapshot[hostname] = struct{}{}
+	}
+	r.hostnames.Store(&snapshot)
+
+	return nil
+}
+
+func (r *LinkHostRegistry) refreshLoop(ctx context.Context) {
+	refreshInterval := time.Duration(r.config.RefreshIntervalSeconds) * time.Second
+	if refreshInterval <= 0 {
+		refreshInterval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.refresh(ctx); err != nil {
+				r.logger.WarnContext(ctx, "link host registry refresh failed", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func scanBrandedHost(row interface{ Scan(dest ...any) error }, extra ...any) (*core.BrandedHostDto, error) {
+	var (
+		host       core.BrandedHostDto
+		verifiedAt sql.NullTime
+		checkedAt  sql.NullTime
+	)
+	dest := append([]any{
+		&host.Hostname,
+		&host.Owner,
+		&host.Status,
+		&host.ChallengeToken,
+		&host.VerificationMethod,
+		&verifiedAt,
+		&checkedAt,
+		&host.FailedChecks,
+		&host.LastError,
+		&host.CreatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		host.VerifiedAt = &verifiedAt.Time
+	}
+	if checkedAt.Valid {
+		host.CheckedAt = &checkedAt.Time
+	}
+
+	return &host, nil
+}
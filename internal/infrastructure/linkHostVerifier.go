@@ -0,0 +1,163 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+var errLinkHostVerifier = errors.New("errLinkHostVerifier")
+
+const (
+	linkHostVerificationHTTP = "http"
+	linkHostVerificationDNS  = "dns"
+
+	defaultLinkHostVerifierTimeout = 5 * time.Second
+	maxVerificationFileSize        = 1024
+)
+
+// TXTResolver looks up TXT records, *net.Resolver is one.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NewTXTResolver asks dnsServer, given as host:port, instead of the system resolver when it is set.
+func NewTXTResolver(dnsServer string) TXTResolver {
+	if dnsServer == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, network, dnsServer)
+		},
+	}
+}
+
+// LinkHostVerifier checks that whoever controls a branded host was given its challenge token, either served
+// over https at core.LinkHostVerificationPath or published in a TXT record.
+type LinkHostVerifier struct {
+	httpClient *http.Client
+	resolver   TXTResolver
+	timeout    time.Duration
+}
+
+func NewLinkHostVerifier(config linkHostVerifierConfig, resolver TXTResolver) *LinkHostVerifier {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultLinkHostVerifierTimeout
+	}
+	if resolver == nil {
+		resolver = NewTXTResolver(config.DNSServer)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout, Control: rejectPrivateAddressDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // stdlib default
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &LinkHostVerifier{
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			// The token has to be served by the host itself.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		resolver: resolver,
+		timeout:  timeout,
+	}
+}
+
+// Verify answers with the method that found the token, "http" or "dns", or with why neither did.
+func (v *LinkHostVerifier) Verify(ctx context.Context, hostname string, challengeToken string) (string, error) {
+	if challengeToken == "" {
+		return "", fmt.Errorf("%w: Verify: %s has no challenge token", errLinkHostVerifier, hostname)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	httpErr := v.verifyHTTP(ctx, hostname, challengeToken)
+	if httpErr == nil {
+		return linkHostVerificationHTTP, nil
+	}
+	dnsErr := v.verifyDNS(ctx, hostname, challengeToken)
+	if dnsErr == nil {
+		return linkHostVerificationDNS, nil
+	}
+
+	return "", fmt.Errorf("%w: Verify: %s: %w", errLinkHostVerifier, hostname, errors.Join(httpErr, dnsErr))
+}
+
+func (v *LinkHostVerifier) verifyHTTP(ctx context.Context, hostname string, challengeToken string) error {
+	verificationURL := "https://" + hostname + core.LinkHostVerificationPath
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, verificationURL, nil)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+
+	response, err := v.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("http: %s answered %d", verificationURL, response.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxVerificationFileSize))
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	if strings.TrimSpace(string(body)) != challengeToken {
+		return fmt.Errorf("http: %s does not hold the challenge token", verificationURL)
+	}
+
+	return nil
+}
+
+func (v *LinkHostVerifier) verifyDNS(ctx context.Context, hostname string, challengeToken string) error {
+	recordName := core.LinkHostVerificationRecord(hostname)
+	records, err := v.resolver.LookupTXT(ctx, recordName)
+	if err != nil {
+		return fmt.Errorf("dns: %w", err)
+	}
+
+	expected := core.LinkHostVerificationValue(challengeToken)
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("dns: no TXT record %s holds the challenge token", recordName)
+}
+
+// rejectPrivateAddressDial keeps a branded host that resolves into our own network from probing it.
+func rejectPrivateAddressDial(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: dial %s: %v", errLinkHostVerifier, address, err)
+	}
+	if core.IsPrivateAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: dial %s: private address", errLinkHostVerifier, address)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// fakeTXTResolver answers records for the names it knows and err for every lookup when it is set.
+type fakeTXTResolver struct {
+	records map[string][]string
+	err     error
+}
+
+func (r fakeTXTResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	records, ok := r.records[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	return records, nil
+}
+
+func TestLinkHostVerifierVerify(t *testing.T) {
+	t.Parallel()
+
+	// localhost resolves to a loopback address, so the https check is refused before it dials and only
+	// the TXT record can verify the host.
+	const hostname = "localhost"
+	const challengeToken = "challenge-token"
+	recordName := core.LinkHostVerificationRecord(hostname)
+
+	tests := []struct {
+		name           string
+		resolver       fakeTXTResolver
+		challengeToken string
+		wantMethod     string
+		wantErr        bool
+	}{
+		{
+			name: "TXT record holds the token",
+			resolver: fakeTXTResolver{records: map[string][]string{
+				recordName: {"v=spf1 -all", core.LinkHostVerificationValue(challengeToken)},
+			}},
+			challengeToken: challengeToken,
+			wantMethod:     linkHostVerificationDNS,
+		},
+		{
+			name: "TXT record is trimmed",
+			resolver: fakeTXTResolver{records: map[string][]string{
+				recordName: {" " + core.LinkHostVerificationValue(challengeToken) + " "},
+			}},
+			challengeToken: challengeToken,
+			wantMethod:     linkHostVerificationDNS,
+		},
+		{
+			name: "TXT record holds another token",
+			resolver: fakeTXTResolver{records: map[string][]string{
+				recordName: {core.LinkHostVerificationValue("another-token")},
+			}},
+			challengeToken: challengeToken,
+			wantErr:        true,
+		},
+		{
+			name: "token is published under another name",
+			resolver: fakeTXTResolver{records: map[string][]string{
+				hostname: {core.LinkHostVerificationValue(challengeToken)},
+			}},
+			challengeToken: challengeToken,
+			wantErr:        true,
+		},
+		{
+			name:           "lookup fails",
+			resolver:       fakeTXTResolver{err: errors.New("server misbehaving")},
+			challengeToken: challengeToken,
+			wantErr:        true,
+		},
+		{
+			name: "host has no challenge token",
+			resolver: fakeTXTResolver{records: map[string][]string{
+				recordName: {core.LinkHostVerificationValue("")},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			verifier := NewLinkHostVerifier(linkHostVerifierConfig{TimeoutSeconds: 1}, tt.resolver)
+			method, err := verifier.Verify(context.Background(), hostname, tt.challengeToken)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Verify verified by %s, want an error", method)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if method != tt.wantMethod {
+				t.Errorf("Verify verified by %s, want %s", method, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestRejectPrivateAddressDial(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: "127.0.0.1:443", wantErr: true},
+		{address: "10.1.2.3:443", wantErr: true},
+		{address: "[::1]:443", wantErr: true},
+		{address: "not an address", wantErr: true},
+		{address: "93.184.216.34:443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			t.Parallel()
+
+			err := rejectPrivateAddressDial("tcp", tt.address, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rejectPrivateAddressDial(%s) = %v, want error %t", tt.address, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+var errLinkKeyFilter = errors.New("errLinkKeyFilter")
+
+// linkKeyFilterStaleMargin is how late a refresh may be before the filter stops rejecting keys.
+const linkKeyFilterStaleMargin = 5 * time.Second
+
+type LinkKeyFilter interface {
+	MayContain(int64) bool
+	AddMany([]int64)
+	Rejected() int64
+}
+
+// LinkKeyFilterBloom answers "definitely not persisted" for token identifiers without a database round trip.
+// It is built from encoded_urls, kept up to date by SaveMany on this instance and by polling rows
+// created by other instances, and snapshotted to disk so restarts only catch up the tail. While polling fails
+// it may miss keys of other instances, so once the last catch up is a refresh interval and a margin old
+// it rejects nothing until one succeeds again.
+type LinkKeyFilterBloom struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	config         linkKeyFilterConfig
+
+	filter    *bloomFilter
+	mu        sync.Mutex
+	watermark string
+	count     atomic.Int64
+	rejected  atomic.Int64
+	// caughtUpAt is when the last successful catch up started, in unix nanoseconds.
+	caughtUpAt atomic.Int64
+}
+
+func NewLinkKeyFilter(
+	ctx context.Context,
+	logger *logger.AppLogger,
+	postgresClient *sqlx.DB,
+	config linkKeyFilterConfig,
+) (LinkKeyFilter, error) {
+	if !config.Enabled {
+		return &LinkKeyFilterMock{}, nil
+	}
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewLinkKeyFilter: postgresClient is nil", errLinkKeyFilter)
+	}
+
+	keyFilter := &LinkKeyFilterBloom{postgresClient: postgresClient, logger: logger, config: config}
+
+	startedAt := time.Now()
+	if !keyFilter.loadSnapshot(ctx) {
+		keyFilter.filter = newBloomFilter(config.ExpectedItems, config.FalsePositiveRate)
+	}
+
+	if err := keyFilter.catchUp(ctx); err != nil {
+		return nil, err
+	}
+
+	logger.InfoContext(
+		ctx,
+		"link key filter is ready",
+		"keys", keyFilter.count.Load(),
+		"watermark", keyFilter.watermark,
+		"took", time.Since(startedAt),
+	)
+
+	go keyFilter.refreshLoop(ctx)
+
+	return keyFilter, nil
+}
+
+func (f *LinkKeyFilterBloom) MayContain(key int64) bool {
+	if f.filter.mayContain(key) || f.isStale() {
+		return true
+	}
+	f.rejected.Add(1)
+
+	return false
+}
+
+func (f *LinkKeyFilterBloom) AddMany(keys []int64) {
+	for _, key := range keys {
+		f.filter.add(key)
+	}
+	f.count.Add(int64(len(keys)))
+}
+
+func (f *LinkKeyFilterBloom) Rejected() int64 {
+	return f.rejected.Load()
+}
+
+func (f *LinkKeyFilterBloom) isStale() bool {
+	caughtUpAt := time.Unix(0, f.caughtUpAt.Load())
+
+	return f.refreshInterval()+linkKeyFilterStaleMargin < time.Since(caughtUpAt)
+}
+
+func (f *LinkKeyFilterBloom) refreshInterval() time.Duration {
+	refreshInterval := time.Duration(f.config.RefreshIntervalMs) * time.Millisecond
+	if refreshInterval <= 0 {
+		return time.Second
+	}
+
+	return refreshInterval
+}
+
+func (f *LinkKeyFilterBloom) refreshLoop(ctx context.Context) {
+	snapshotInterval := time.Duration(f.config.SnapshotIntervalSeconds) * time.Second
+	if snapshotInterval <= 0 {
+		snapshotInterval = 5 * time.Minute
+	}
+
+	refreshTicker := time.NewTicker(f.refreshInterval())
+	defer refreshTicker.Stop()
+	snapshotTicker := time.NewTicker(snapshotInterval)
+	defer snapshotTicker.Stop()
+
+	for {
+		select {
+		case <-refreshTicker.C:
+			if err := f.catchUp(ctx); err != nil {
+				f.logger.WarnContext(ctx, "link key filter refresh failed", "err", err)
+			}
+		case <-snapshotTicker.C:
+			f.saveSnapshot(ctx)
+		case <-ctx.Done():
+			f.saveSnapshot(context.WithoutCancel(ctx))
+
+			return
+		}
+	}
+}
+
+// catchUp adds every row created since the watermark. Rows are re-read with an overlap because
+// created_at is the transaction start time and slow transactions commit out of order.
+// The watermark is kept as text so it is never shifted by session time zones.
+func (f *LinkKeyFilterBloom) catchUp(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	startedAt := time.Now()
+	query := "SELECT token_identifier, to_char(created_at, 'YYYY-MM-DD HH24:MI:SS.US') FROM encoded_urls"
+	args := []interface{}{}
+	if f.watermark != "" {
+		query += " WHERE $1::timestamp - make_interval(secs => $2) <= created_at"
+		args = append(args, f.watermark, f.config.CatchUpOverlapSeconds)
+	}
+
+	rows, err := f.postgresClient.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%w: catchUp: query: %s", errLinkKeyFilter, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var (
+		key       int64
+		createdAt string
+		added     int64
+	)
+	watermark := f.watermark
+	for rows.Next() {
+		if err = rows.Scan(&key, &createdAt); err != nil {
+			return fmt.Errorf("%w: catchUp: scan: %s", errLinkKeyFilter, err)
+		}
+		if !f.filter.mayContain(key) {
+			f.filter.add(key)
+			added++
+		}
+		if watermark < createdAt {
+			watermark = createdAt
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("%w: catchUp: rows: %s", errLinkKeyFilter, err)
+	}
+
+	f.watermark = watermark
+	f.caughtUpAt.Store(startedAt.UnixNano())
+	count := f.count.Add(added)
+	if 0 < f.config.ExpectedItems && f.config.ExpectedItems < count {
+		f.logger.WarnContext(ctx, "link key filter holds more keys than expected, false positive rate grows", "keys", count)
+	}
+
+	return nil
+}
+
+func (f *LinkKeyFilterBloom) loadSnapshot(ctx context.Context) bool {
+	if f.config.SnapshotPath == "" {
+		return false
+	}
+
+	file, err := os.Open(f.config.SnapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		f.logger.WarnContext(ctx, "link key filter snapshot can not be opened, rebuilding", "err", err)
+
+		return false
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	filter, watermark, err := readBloomFilter(file)
+	if err != nil {
+		f.logger.WarnContext(ctx, "link key filter snapshot is corrupted, rebuilding", "err", err)
+
+		return false
+	}
+
+	f.filter = filter
+	f.watermark = watermark
+
+	return true
+}
+
+func (f *LinkKeyFilterBloom) saveSnapshot(ctx context.Context) {
+	if f.config.SnapshotPath == "" {
+		return
+	}
+
+	f.mu.Lock()
+	watermark := f.watermark
+	f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.config.SnapshotPath), 0o750); err != nil {
+		f.logger.WarnContext(ctx, "link key filter snapshot failed", "err", err)
+
+		return
+	}
+
+	tmpPath := f.config.SnapshotPath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		f.logger.WarnContext(ctx, "link key filter snapshot failed", "err", err)
+
+		return
+	}
+
+	err = f.filter.writeTo(file, watermark)
+	if err == nil {
+		err = file.Sync()
+	}
+	_ = file.Close()
+	if err == nil {
+		err = os.Rename(tmpPath, f.config.SnapshotPath)
+	}
+	if err != nil {
+		f.logger.WarnContext(ctx, "link key filter snapshot failed", "err", err)
+	}
+}
+
+type LinkKeyFilterMock struct{}
+
+func (m *LinkKeyFilterMock) MayContain(_ int64) bool {
+	return true
+}
+
+func (m *LinkKeyFilterMock) AddMany(_ []int64) {}
+
+func (m *LinkKeyFilterMock) Rejected() int64 {
+	return 0
+}
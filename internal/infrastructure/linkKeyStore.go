@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/beard-programmer/shortorg/internal/app/logger"
@@ -13,11 +16,19 @@ import (
 
 var errLinkKeyStore = errors.New("errLinkKeyStore")
 
+// LinkKeyStore issues keys from the token_identifier sequence. Bands of keys with the same slug length follow
+// each other, so once a band is used up the sequence rolls over into the next one by itself.
+// The store only starts the sequence at the first band and stops at the last one.
 type LinkKeyStore struct {
 	postgresClient *sqlx.DB
 	logger         *logger.AppLogger
 	bufferChan     chan core.LinkKey
-	errChan        chan error
+	config         tokenStoreConfig
+	bands          []core.LinkKeyBand
+	lastIssued     atomic.Int64
+	leaser         *keyLeaser
+	degradedCause  atomic.Pointer[string]
+	failures       int
 }
 
 func NewLinkKeyStore(
@@ -29,69 +40,283 @@ func NewLinkKeyStore(
 	if postgresClient == nil {
 		return nil, fmt.Errorf("%w: NewLinkKeyStore: postgresClient is not provided", errLinkKeyStore)
 	}
-	bufferChan := make(chan core.LinkKey, config.BufferSize)
-	errChan := make(chan error, 1)
-	store := LinkKeyStore{
-		postgresClient, logger, bufferChan, errChan,
+
+	bands, err := newLinkKeyBands(config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewLinkKeyStore: %s", errLinkKeyStore, err)
+	}
+
+	store := &LinkKeyStore{
+		postgresClient: postgresClient,
+		logger:         logger,
+		bufferChan:     make(chan core.LinkKey, config.BufferSize),
+		config:         config,
+		bands:          bands,
+	}
+
+	switch config.Mode {
+	case "", linkKeyStoreModeSequence:
+	case linkKeyStoreModeLease:
+		store.leaser = newKeyLeaser(postgresClient, logger, config)
+	default:
+		return nil, fmt.Errorf("%w: NewLinkKeyStore: unknown mode %s", errLinkKeyStore, config.Mode)
+	}
+
+	lastIssued, err := store.startAtFirstBand(ctx)
+	if err != nil {
+		return nil, err
 	}
-	go store.bufferRefillInfiniteLoop(ctx)
-	return &store, nil
+	store.lastIssued.Store(lastIssued)
+
+	go store.superviseRefill(ctx)
+	return store, nil
+}
+
+func newLinkKeyBands(config tokenStoreConfig) ([]core.LinkKeyBand, error) {
+	minSlugLength := config.MinSlugLength
+	if minSlugLength == 0 {
+		minSlugLength = core.MinSlugLength
+	}
+	maxSlugLength := config.MaxSlugLength
+	if maxSlugLength == 0 {
+		maxSlugLength = core.MaxSlugLength
+	}
+	if maxSlugLength < minSlugLength {
+		return nil, fmt.Errorf("max slug length %d is less than min slug length %d", maxSlugLength, minSlugLength)
+	}
+
+	bands := make([]core.LinkKeyBand, 0, maxSlugLength-minSlugLength+1)
+	for slugLength := minSlugLength; slugLength <= maxSlugLength; slugLength++ {
+		band, err := core.NewLinkKeyBand(slugLength)
+		if err != nil {
+			return nil, err
+		}
+		bands = append(bands, *band)
+	}
+
+	return bands, nil
+}
+
+// startAtFirstBand moves the sequence forward to the first configured band, it never moves it back.
+// The advisory lock keeps instances starting together from both resetting a sequence one of them already uses.
+func (s *LinkKeyStore) startAtFirstBand(ctx context.Context) (int64, error) {
+	tx, err := s.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: startAtFirstBand: begin: %s", errLinkKeyStore, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, linkKeySequenceLock); err != nil {
+		return 0, fmt.Errorf("%w: startAtFirstBand: lock: %s", errLinkKeyStore, err)
+	}
+
+	var lastValue int64
+	if err = tx.GetContext(ctx, &lastValue, "SELECT last_value FROM token_identifier"); err != nil {
+		return 0, fmt.Errorf("%w: startAtFirstBand: read sequence: %s", errLinkKeyStore, err)
+	}
+
+	firstBand := s.bands[0]
+	if lastValue < firstBand.First {
+		if _, err = tx.ExecContext(ctx, "SELECT setval('token_identifier', $1, false)", firstBand.First); err != nil {
+			return 0, fmt.Errorf("%w: startAtFirstBand: setval: %s", errLinkKeyStore, err)
+		}
+		s.logger.InfoContext(ctx, "link key sequence moved to first band", "slugLength", firstBand.SlugLength)
+		lastValue = firstBand.First - 1
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: startAtFirstBand: commit: %s", errLinkKeyStore, err)
+	}
+
+	return lastValue, nil
+}
+
+// RemainingByBand reports free keys per slug length as seen by this instance.
+func (s *LinkKeyStore) RemainingByBand() map[string]int64 {
+	lastIssued := s.lastIssued.Load()
+	remaining := make(map[string]int64, len(s.bands))
+	for _, band := range s.bands {
+		remaining[strconv.Itoa(band.SlugLength)] = band.Remaining(lastIssued)
+	}
+
+	return remaining
+}
+
+func (s *LinkKeyStore) bandOf(key int64) (core.LinkKeyBand, bool) {
+	for _, band := range s.bands {
+		if band.Contains(key) {
+			return band, true
+		}
+	}
+
+	return core.LinkKeyBand{}, false
 }
 
 const issueTimeout = 50 * time.Millisecond
 
-func (s *LinkKeyStore) Issue(ctx context.Context) (*core.LinkKey, error) {
+// Issue hands out buffered keys even while the store is degraded, it fails fast only once the buffer is empty.
+func (s *LinkKeyStore) Issue(ctx context.Context, _ core.LinkKeySeedDto) (*core.LinkKey, error) {
+	select {
+	case ti := <-s.bufferChan:
+		return &ti, nil
+	default:
+	}
+
+	if err := s.Health(); err != nil {
+		return nil, fmt.Errorf("%w: issue: %w", errLinkKeyStore, err)
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, issueTimeout)
 	defer cancel()
 
-	for {
+	select {
+	case ti := <-s.bufferChan:
+		return &ti, nil
+	case <-ctx.Done():
+		if err := s.Health(); err != nil {
+			return nil, fmt.Errorf("%w: issue: %w", errLinkKeyStore, err)
+		}
+
+		return nil, fmt.Errorf("%w: issue: %s", errLinkKeyStore, ctx.Err())
+	}
+}
+
+// IssueMany takes what the buffer holds and fetches the rest in one round trip, so a batch does not drain
+// the buffer key by key.
+func (s *LinkKeyStore) IssueMany(ctx context.Context, count int) ([]core.LinkKey, error) {
+	keys := make([]core.LinkKey, 0, count)
+drain:
+	for len(keys) < count {
 		select {
 		case ti := <-s.bufferChan:
-			return &ti, nil
-		case err := <-s.errChan:
-			return nil, fmt.Errorf("%w: issue: %s", errLinkKeyStore, err)
+			keys = append(keys, ti)
+		default:
+			break drain
+		}
+	}
+	if len(keys) == count {
+		return keys, nil
+	}
+
+	if err := s.Health(); err != nil {
+		return keys, fmt.Errorf("%w: IssueMany: %w", errLinkKeyStore, err)
+	}
+
+	batch, err := s.issueBatch(ctx, count-len(keys))
+	if err != nil {
+		return keys, fmt.Errorf("%w: IssueMany: %s", errLinkKeyStore, err)
+	}
+	for _, key := range batch {
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+// Health reports ErrLinkKeyStoreDegraded while refilling the buffer keeps failing.
+func (s *LinkKeyStore) Health() error {
+	cause := s.degradedCause.Load()
+	if cause == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", core.ErrLinkKeyStoreDegraded, *cause)
+}
+
+// superviseRefill keeps the refill loop running. A failed or panicked refill marks the store degraded
+// and is restarted after a backoff, so the store heals itself once the identity db is reachable again.
+func (s *LinkKeyStore) superviseRefill(ctx context.Context) {
+	defer func() {
+		if s.leaser != nil {
+			s.leaser.release(ctx)
+		}
+	}()
+
+	for {
+		err := s.refill(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.failures++
+		cause := err.Error()
+		s.degradedCause.Store(&cause)
+		delay := refillBackoff(s.config, s.failures)
+		s.logger.ErrorContext(ctx, "link key store is degraded", "failures", s.failures, "retryIn", delay, "err", err)
+
+		select {
+		case <-time.After(delay):
 		case <-ctx.Done():
-			return nil, fmt.Errorf("%w: issue: %s", errLinkKeyStore, ctx.Err())
+			return
 		}
 	}
 }
 
-func (s *LinkKeyStore) bufferRefillInfiniteLoop(ctx context.Context) {
+func (s *LinkKeyStore) refill(ctx context.Context) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%w: refill: panic: %v", errLinkKeyStore, recovered)
+		}
+	}()
+
 	const targetRps = 100000
 	refillFrequency := time.Duration(1+cap(s.bufferChan)*1000/targetRps) * time.Millisecond
 	ticker := time.NewTicker(refillFrequency)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			freeCapacity := cap(s.bufferChan) - len(s.bufferChan)
 			if freeCapacity != 0 {
-				batch, err := s.issueBatch(ctx, freeCapacity)
-				if err != nil {
-					s.errChan <- fmt.Errorf("%w: bufferRefillInfiniteLoop : %s", errLinkKeyStore, err)
-					return
+				batch, issueErr := s.issueBatch(ctx, freeCapacity)
+				if issueErr != nil {
+					return fmt.Errorf("%w: refill: %s", errLinkKeyStore, issueErr)
 				}
 				for _, tokenKey := range batch {
 					s.bufferChan <- *tokenKey
 				}
+				s.markRecovered(ctx)
 				ticker.Reset(refillFrequency)
 			}
 		case <-ctx.Done():
-			s.errChan <- ctx.Err()
-			return
+			return nil
 		}
 	}
 }
 
-func (s *LinkKeyStore) issueBatch(ctx context.Context, batchSize int) ([]*core.LinkKey, error) {
-	var uniqueIDs []int64
+func (s *LinkKeyStore) markRecovered(ctx context.Context) {
+	if s.degradedCause.Swap(nil) != nil {
+		s.logger.WarnContext(ctx, "link key store recovered", "failures", s.failures)
+	}
+	s.failures = 0
+}
+
+// refillBackoff is an exponential backoff with full jitter.
+func refillBackoff(config tokenStoreConfig, failures int) time.Duration {
+	baseDelay := time.Duration(max(1, config.RetryBaseDelayMs)) * time.Millisecond
+	maxDelay := time.Duration(max(config.RetryBaseDelayMs, config.RetryMaxDelayMs)) * time.Millisecond
 
-	err := s.postgresClient.SelectContext(
-		ctx,
-		&uniqueIDs,
-		`SELECT nextval('token_identifier') FROM generate_series(1, $1)`,
-		batchSize,
+	delay := maxDelay
+	if shift := failures - 1; shift < 32 && baseDelay<<shift < maxDelay { //nolint:mnd // avoid overflow
+		delay = baseDelay << shift
+	}
+
+	return time.Duration(rand.Int64N(int64(delay)) + 1)
+}
+
+func (s *LinkKeyStore) issueBatch(ctx context.Context, batchSize int) ([]*core.LinkKey, error) {
+	var (
+		uniqueIDs []int64
+		err       error
 	)
+	if s.leaser != nil {
+		uniqueIDs, err = s.leaser.nextIDs(ctx, batchSize)
+	} else {
+		uniqueIDs, err = s.nextSequenceIDs(ctx, batchSize)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("%w: issueBatch: %s", errLinkKeyStore, err)
 	}
@@ -104,8 +329,26 @@ func (s *LinkKeyStore) issueBatch(ctx context.Context, batchSize int) ([]*core.L
 		)
 	}
 
+	previousBand, _ := s.bandOf(s.lastIssued.Load())
 	tokens := make([]*core.LinkKey, 0, batchSize)
 	for _, id := range uniqueIDs {
+		band, isInBand := s.bandOf(id)
+		if !isInBand {
+			return nil, fmt.Errorf(
+				"%w: issueBatch: key space is exhausted, id %d is beyond slug length %d",
+				errLinkKeyStore,
+				id,
+				s.bands[len(s.bands)-1].SlugLength,
+			)
+		}
+		if previousBand.SlugLength != 0 && band.SlugLength != previousBand.SlugLength {
+			s.logger.WarnContext(ctx, "link key store rolled over to next band", "slugLength", band.SlugLength)
+		}
+		previousBand = band
+		if s.lastIssued.Load() < id {
+			s.lastIssued.Store(id)
+		}
+
 		token, newLinkKeyErr := core.NewLinkKey(id)
 		if newLinkKeyErr != nil {
 			return nil,
@@ -116,3 +359,29 @@ func (s *LinkKeyStore) issueBatch(ctx context.Context, batchSize int) ([]*core.L
 
 	return tokens, nil
 }
+
+func (s *LinkKeyStore) nextSequenceIDs(ctx context.Context, count int) ([]int64, error) {
+	tx, err := s.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("nextSequenceIDs: begin: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, linkKeyBatchLock); err != nil {
+		return nil, fmt.Errorf("nextSequenceIDs: lock: %w", err)
+	}
+
+	var ids []int64
+	err = tx.SelectContext(ctx, &ids, `SELECT nextval('token_identifier') FROM generate_series(1, $1)`, count)
+	if err != nil {
+		return nil, fmt.Errorf("nextSequenceIDs: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("nextSequenceIDs: commit: %w", err)
+	}
+
+	return ids, nil
+}
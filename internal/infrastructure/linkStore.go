@@ -1,41 +1,145 @@
 package infrastructure
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/beard-programmer/shortorg/internal/app/logger"
 	"github.com/beard-programmer/shortorg/internal/core"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"golang.org/x/sync/singleflight"
 )
 
 var errEncodedURLStore = errors.New("errEncodedURLStore")
 
 type LinkStore struct {
 	postgresClient *sqlx.DB
-	cache          Cache[string]
+	cache          Cache[core.LinkDTO]
 	logger         *logger.AppLogger
+	config         linkStoreConfig
+	keyFilter      LinkKeyFilter
+	// canonicalizationPolicy tells destinations with the same canonical form apart from different ones.
+	canonicalizationPolicy core.CanonicalizationPolicy
+	// urlHashPolicy is stored next to each url hash, see LinkHashRehasher.
+	urlHashPolicy string
+	findGroup     singleflight.Group
+	// invalidations counts destination changes seen, a link read while one happened is not cached.
+	invalidations atomic.Uint64
+	// isCacheBypassed is set while destination changes made on other instances can not be heard of.
+	isCacheBypassed atomic.Bool
 }
 
 type Cache[T any] interface {
 	Get(context.Context, any) (T, error)
-	Set(context.Context, any, T) error
+	Set(context.Context, any, T, int64) error
+	Delete(context.Context, any) error
+	Clear(context.Context) error
 }
 
-func NewEncodedURLStore(postgresClient *sqlx.DB, cache Cache[string], logger *logger.AppLogger) (
+func NewEncodedURLStore(
+	postgresClient *sqlx.DB,
+	cache Cache[core.LinkDTO],
+	logger *logger.AppLogger,
+	config linkStoreConfig,
+	keyFilter LinkKeyFilter,
+	canonicalizationPolicy core.CanonicalizationPolicy,
+) (
 	*LinkStore,
 	error,
 ) {
 	if postgresClient == nil {
 		return nil, fmt.Errorf("%w: NewEncodedURLStore: postgresClient is nil", errEncodedURLStore)
 	}
-	return &LinkStore{postgresClient, cache, logger}, nil
+	return &LinkStore{
+		postgresClient:         postgresClient,
+		cache:                  cache,
+		logger:                 logger,
+		config:                 config,
+		keyFilter:              keyFilter,
+		canonicalizationPolicy: canonicalizationPolicy,
+		urlHashPolicy:          canonicalizationPolicy.ID(),
+	}, nil
+}
+
+const findOneLinkTimeout = 2 * time.Second
+
+// FindOneLink answers keys rejected by the key filter right away, otherwise it reads through
+// the cache and concurrent misses on the same key share one query. Keys are global, a link is only found
+// on the host it was issued on.
+func (s *LinkStore) FindOneLink(
+	ctx context.Context,
+	slugDto core.LinkSlugDto,
+	keyDto core.LinkKeyDto,
+	hostDto core.LinkHostDto,
+) (
+	*core.LinkDTO,
+	bool,
+	error,
+) {
+	if !s.keyFilter.MayContain(keyDto.Value) {
+		return nil, false, nil
+	}
+
+	if !s.isCacheBypassed.Load() {
+		cached, err := s.cache.Get(ctx, keyDto.Value)
+		if err == nil {
+			if cached.Host.Hostname != hostDto.Hostname {
+				return nil, false, nil
+			}
+
+			return &cached, true, nil
+		}
+	}
+
+	// The shared query runs without the cancellation of the caller that started it, a caller that gives up
+	// stops waiting but does not fail the rest.
+	flightKey := hostDto.Hostname + "/" + strconv.FormatInt(keyDto.Value, 10)
+	resultCh := s.findGroup.DoChan(flightKey, func() (interface{}, error) {
+		sharedCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), findOneLinkTimeout)
+		defer cancel()
+
+		invalidations := s.invalidations.Load()
+		link, isFound, findErr := s.findOneLink(sharedCtx, slugDto, keyDto, hostDto)
+		if findErr != nil || !isFound {
+			return nil, findErr
+		}
+
+		s.setCache(sharedCtx, *link)
+		// The link may have been read before a destination change that was invalidated meanwhile.
+		if s.invalidations.Load() != invalidations {
+			_ = s.cache.Delete(sharedCtx, keyDto.Value)
+		}
+
+		return link, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case result = <-resultCh:
+	case <-ctx.Done():
+		return nil, false, fmt.Errorf("%w: FindOneLink: %s", errEncodedURLStore, ctx.Err())
+	}
+	if result.Err != nil {
+		return nil, false, result.Err
+	}
+
+	link, isFound := result.Val.(*core.LinkDTO)
+	if !isFound || link == nil {
+		return nil, false, nil
+	}
+
+	return link, true, nil
 }
 
-func (s *LinkStore) FindOneNonBrandedLink(
+func (s *LinkStore) findOneLink(
 	ctx context.Context,
 	slugDto core.LinkSlugDto,
 	keyDto core.LinkKeyDto,
@@ -46,18 +150,31 @@ func (s *LinkStore) FindOneNonBrandedLink(
 	error,
 ) {
 	var (
-		key  int64
-		url  string
-		slug string
+		key            int64
+		url            string
+		slug           string
+		redirectStatus sql.NullInt16
+		alias          sql.NullString
+		owner          string
+		notBefore      sql.NullTime
+		expiresAt      sql.NullTime
+		maxClicks      sql.NullInt64
+		expiredAt      sql.NullTime
+		passwordHash   []byte
 	)
 
 	row := s.postgresClient.QueryRowxContext(
 		ctx,
-		"SELECT url, token, token_identifier FROM encoded_urls WHERE token_identifier=$1 LIMIT 1",
+		`SELECT url, token, token_identifier, redirect_status, alias, owner, not_before, expires_at, max_clicks, expired_at,
+			password_hash
+		FROM encoded_urls WHERE token_identifier=$1 AND host=$2 LIMIT 1`,
 		keyDto.Value,
+		hostDto.Hostname,
 	)
 
-	err := row.Scan(&url, &slug, &key)
+	err := row.Scan(
+		&url, &slug, &key, &redirectStatus, &alias, &owner, &notBefore, &expiresAt, &maxClicks, &expiredAt, &passwordHash,
+	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, false, nil
 	}
@@ -65,76 +182,430 @@ func (s *LinkStore) FindOneNonBrandedLink(
 		return nil, false, fmt.Errorf("%w: FindOne: failed to execute%s", errLinkKeyStore, err)
 	}
 
-	return &core.LinkDTO{Key: keyDto, Slug: slugDto, Host: hostDto, DestinationURL: core.URLDto{Value: url}}, true, nil
+	link := core.LinkDTO{
+		Key:            keyDto,
+		Slug:           slugDto,
+		Host:           hostDto,
+		DestinationURL: core.URLDto{Value: url},
+		Owner:          owner,
+		PasswordHash:   passwordHash,
+	}
+	if redirectStatus.Valid {
+		link.RedirectStatus = &core.RedirectStatusDto{Value: int(redirectStatus.Int16)}
+	}
+	if alias.Valid {
+		link.Alias = &core.LinkAliasDto{Value: alias.String}
+	}
+	if notBefore.Valid || expiresAt.Valid || maxClicks.Valid {
+		link.Lifetime = &core.LinkLifetimeDto{
+			NotBefore: nullTimePtr(notBefore),
+			ExpiresAt: nullTimePtr(expiresAt),
+			ExpiredAt: nullTimePtr(expiredAt),
+		}
+		if maxClicks.Valid {
+			link.Lifetime.MaxClicks = &maxClicks.Int64
+		}
+	}
+
+	return &link, true, nil
 }
 
-func (s *LinkStore) FindOne(ctx context.Context, key core.LinkKey) (string, bool, error) {
+// FindReusable finds the oldest link of the owner to the same canonical url with the same redirect status.
+// Links with an alias, a lifetime or a password are never reused.
+func (s *LinkStore) FindReusable(ctx context.Context, query core.ReusableLinkQueryDto) (*core.LinkDTO, bool, error) {
+	var redirectStatus sql.NullInt16
+	if query.RedirectStatus != nil {
+		redirectStatus = sql.NullInt16{Int16: int16(query.RedirectStatus.Value), Valid: true} //nolint:gosec // its validated
+	}
+
 	var (
-		url string
-		err error
+		key  int64
+		url  string
+		slug string
 	)
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		`SELECT token_identifier, token, url FROM encoded_urls
+		WHERE owner = $1 AND url_hash = $2 AND host = $3 AND alias IS NULL AND redirect_status IS NOT DISTINCT FROM $4
+			AND not_before IS NULL AND expires_at IS NULL AND max_clicks IS NULL AND password_hash IS NULL
+		ORDER BY token_identifier
+		LIMIT 1`,
+		query.Owner,
+		query.URLFingerprint,
+		query.Host.Hostname,
+		redirectStatus,
+	).Scan(&key, &slug, &url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: FindReusable: %s", errEncodedURLStore, err)
+	}
+
+	return &core.LinkDTO{
+		Key:            core.LinkKeyDto{Value: key},
+		Slug:           core.LinkSlugDto{Value: slug},
+		Host:           query.Host,
+		DestinationURL: core.URLDto{Value: url},
+		RedirectStatus: query.RedirectStatus,
+		Owner:          query.Owner,
+		URLFingerprint: query.URLFingerprint,
+	}, true, nil
+}
 
-	url, err = s.cache.Get(ctx, key.Value())
-	if nil == err {
-		return url, true, nil
+// linkCacheEntryOverhead approximates memory taken by a cached link besides its strings.
+const linkCacheEntryOverhead = 96
+
+func (s *LinkStore) setCache(ctx context.Context, link core.LinkDTO) {
+	if s.isCacheBypassed.Load() {
+		return
 	}
 
-	row := s.postgresClient.QueryRowxContext(
-		ctx,
-		"SELECT url FROM encoded_urls WHERE token_identifier=$1 LIMIT 1",
-		key.Value(),
+	cost := int64(
+		linkCacheEntryOverhead + len(link.DestinationURL.Value) + len(link.Slug.Value) + len(link.Host.Hostname) +
+			len(link.PasswordHash),
 	)
 
-	err = row.Scan(&url)
-	if errors.Is(err, sql.ErrNoRows) {
-		return url, false, nil
-	}
+	err := s.cache.Set(ctx, link.Key.Value, link, cost)
 	if err != nil {
-		return url, false, fmt.Errorf("%w: FindOne: failed to execute%s", errLinkKeyStore, err)
+		s.logger.WarnContext(ctx, "LinkStore: error storing link in cache", "key", link.Key.Value, "err", err)
+	}
+}
+
+// encodedURLsColumns is the column order used by both bulk insert paths, see linkRow.
+var encodedURLsColumns = []string{
+	"token_identifier", "token", "url", "redirect_status", "alias", "owner", "url_hash", "host",
+	"not_before", "expires_at", "max_clicks", "password_hash", "url_hash_policy",
+}
+
+const postgresMaxParams = 65535
+
+func linkRow(linkDto core.LinkDTO, urlHashPolicy string) []interface{} {
+	redirectStatus := linkRedirectStatus(linkDto)
+
+	var alias sql.NullString
+	if linkDto.Alias != nil {
+		alias = sql.NullString{String: linkDto.Alias.Value, Valid: true}
 	}
 
-	setCacheErr := s.cache.Set(ctx, key.Value(), url)
-	if setCacheErr != nil {
-		s.logger.WarnContext(ctx, fmt.Sprintf("FindOne: Error storing in cache key %v value %v", key, url))
+	// Links replayed from logs written before fingerprints existed have none, they are stored without a hash.
+	var urlHash interface{}
+	var hashPolicy sql.NullString
+	if len(linkDto.URLFingerprint) != 0 {
+		urlHash = linkDto.URLFingerprint
+		hashPolicy = sql.NullString{String: urlHashPolicy, Valid: true}
 	}
-	return url, true, nil
+
+	var notBefore, expiresAt sql.NullTime
+	var maxClicks sql.NullInt64
+	if linkDto.Lifetime != nil {
+		notBefore = timePtrToNull(linkDto.Lifetime.NotBefore)
+		expiresAt = timePtrToNull(linkDto.Lifetime.ExpiresAt)
+		if linkDto.Lifetime.MaxClicks != nil {
+			maxClicks = sql.NullInt64{Int64: *linkDto.Lifetime.MaxClicks, Valid: true}
+		}
+	}
+
+	var passwordHash interface{}
+	if len(linkDto.PasswordHash) != 0 {
+		passwordHash = linkDto.PasswordHash
+	}
+
+	return []interface{}{
+		linkDto.Key.Value,
+		linkDto.Slug.Value,
+		linkDto.DestinationURL.Value,
+		redirectStatus,
+		alias,
+		linkDto.Owner,
+		urlHash,
+		linkDto.Host.Hostname,
+		notBefore,
+		expiresAt,
+		maxClicks,
+		passwordHash,
+		hashPolicy,
+	}
+}
+
+func linkRedirectStatus(linkDto core.LinkDTO) sql.NullInt16 {
+	if linkDto.RedirectStatus == nil {
+		return sql.NullInt16{}
+	}
+
+	return sql.NullInt16{Int16: int16(linkDto.RedirectStatus.Value), Valid: true} //nolint:gosec // its validated
+}
+
+func nullTimePtr(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+
+	return &value.Time
+}
+
+func timePtrToNull(value *time.Time) sql.NullTime {
+	if value == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: *value, Valid: true}
 }
 
 func (s *LinkStore) SaveMany(ctx context.Context, links []core.LinkDTO) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	inserted := make(map[int64]struct{}, len(links))
+	if s.config.ForceCopy || (0 < s.config.CopyThreshold && s.config.CopyThreshold <= len(links)) {
+		if err := s.saveManyWithCopy(ctx, links, inserted); err != nil {
+			return err
+		}
+
+		s.setManyCache(ctx, links, inserted)
+
+		return nil
+	}
+
+	chunkSize := postgresMaxParams / len(encodedURLsColumns)
+	for start := 0; start < len(links); start += chunkSize {
+		end := min(start+chunkSize, len(links))
+		if err := s.saveManyWithInsert(ctx, links[start:end], inserted); err != nil {
+			return err
+		}
+	}
+
+	s.setManyCache(ctx, links, inserted)
+
+	return nil
+}
+
+// setManyCache only caches links this call inserted, a replayed link may have changed its destination since.
+func (s *LinkStore) setManyCache(ctx context.Context, links []core.LinkDTO, inserted map[int64]struct{}) {
+	keys := make([]int64, 0, len(links))
+	for _, link := range links {
+		keys = append(keys, link.Key.Value)
+		if _, isInserted := inserted[link.Key.Value]; isInserted {
+			s.setCache(ctx, link)
+		}
+	}
+	s.keyFilter.AddMany(keys)
+}
+
+func collectInsertedKeys(rows *sql.Rows, inserted map[int64]struct{}) error {
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var key int64
+		if err := rows.Scan(&key); err != nil {
+			return err
+		}
+		inserted[key] = struct{}{}
+	}
+
+	return rows.Err()
+}
+
+func (s *LinkStore) saveManyWithInsert(ctx context.Context, links []core.LinkDTO, inserted map[int64]struct{}) error {
 	// NamedExecContext is generating invalid sql so building query manually.
+	columnsCount := len(encodedURLsColumns)
 	valueStrings := make([]string, 0, len(links))
-	valueArgs := make([]interface{}, 0, len(links)*3) //nolint:mnd // _
+	valueArgs := make([]interface{}, 0, len(links)*columnsCount)
+	placeholders := make([]string, columnsCount)
 
 	for i, linkDto := range links {
-		valueStrings = append(
-			valueStrings, fmt.Sprintf("($%d, $%d, $%d)", i*3+1, i*3+2, i*3+3), //nolint:mnd // _
-		)
-		valueArgs = append(
-			valueArgs,
-			linkDto.Key.Value,
-			linkDto.Slug.Value,
-			linkDto.DestinationURL.Value,
-		)
+		for j := range columnsCount {
+			placeholders[j] = fmt.Sprintf("$%d", i*columnsCount+j+1)
+		}
+		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+		valueArgs = append(valueArgs, linkRow(linkDto, s.urlHashPolicy)...)
 	}
 
 	query := fmt.Sprintf(
-		"INSERT INTO encoded_urls (token_identifier, token, url) VALUES %s",
+		"INSERT INTO encoded_urls (%s) VALUES %s ON CONFLICT (token_identifier) DO NOTHING RETURNING token_identifier",
+		strings.Join(encodedURLsColumns, ", "),
 		strings.Join(valueStrings, ","),
 	)
 
-	_, err := s.postgresClient.ExecContext(ctx, query, valueArgs...)
+	rows, err := s.postgresClient.QueryContext(ctx, query, valueArgs...)
+	if err != nil {
+		return fmt.Errorf("%w: SaveMany: failed to execute bulk insert: %w", errEncodedURLStore, classifyPostgresError(err))
+	}
+	if err = collectInsertedKeys(rows, inserted); err != nil {
+		return fmt.Errorf("%w: SaveMany: read inserted keys: %w", errEncodedURLStore, classifyPostgresError(err))
+	}
+	if err = checkKeyCollisions(ctx, s.postgresClient, s.canonicalizationPolicy, links, inserted); err != nil {
+		return fmt.Errorf("%w: SaveMany: %w", errEncodedURLStore, err)
+	}
+
+	return nil
+}
+
+// checkKeyCollisions tells a replayed link, or a deterministic one issued again for another spelling of the
+// same canonical url, apart from a key that was issued twice. Links that were not inserted have to match
+// the stored row, its first version when the destination has been changed since. A link that does not is
+// non retryable, the batch saver moves it to the dead-letter store.
+func checkKeyCollisions(
+	ctx context.Context,
+	queryer sqlx.QueryerContext,
+	canonicalizationPolicy core.CanonicalizationPolicy,
+	links []core.LinkDTO,
+	inserted map[int64]struct{},
+) error {
+	skipped := make(map[int64]core.LinkDTO)
+	for _, link := range links {
+		if _, isInserted := inserted[link.Key.Value]; !isInserted {
+			skipped[link.Key.Value] = link
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+
+	keys := make([]int64, 0, len(skipped))
+	for key := range skipped {
+		keys = append(keys, key)
+	}
+
+	rows, err := queryer.QueryxContext(
+		ctx,
+		`SELECT encoded_urls.token_identifier, encoded_urls.host, encoded_urls.owner, encoded_urls.redirect_status,
+			COALESCE(link_versions.url, encoded_urls.url)
+		FROM encoded_urls
+		LEFT JOIN link_versions
+			ON link_versions.token_identifier = encoded_urls.token_identifier AND link_versions.version = 1
+		WHERE encoded_urls.token_identifier = ANY($1)`,
+		pq.Array(keys),
+	)
 	if err != nil {
-		return fmt.Errorf("%w: SaveMany: failed to execute bulk insert: %s", errLinkKeyStore, err)
+		return fmt.Errorf("checkKeyCollisions: %s", err)
 	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var (
+			key              int64
+			host, owner, url string
+			redirectStatus   sql.NullInt16
+		)
+		if err = rows.Scan(&key, &host, &owner, &redirectStatus, &url); err != nil {
+			return fmt.Errorf("checkKeyCollisions: scan: %s", err)
+		}
 
-	//for _, encodedURL := range links {
-	//	key := encodedURL.NonBrandedLink.Key.Value()
-	//	url := encodedURL.NonBrandedLink.DestinationURL.String()
-	//	err = s.cache.Set(ctx, encodedURL.NonBrandedLink.Key.Value(), encodedURL.NonBrandedLink.DestinationURL.String())
-	//	if err != nil {
-	//		s.logger.WarnContext(ctx, fmt.Sprintf("SaveMany: Error storing in cache key %v value %v", key, url))
-	//	}
-	//}
+		link := skipped[key]
+		if host != link.Host.Hostname || owner != link.Owner ||
+			redirectStatus != linkRedirectStatus(link) ||
+			!isSameDestination(canonicalizationPolicy, url, link.DestinationURL.Value) {
+			return fmt.Errorf("%w: checkKeyCollisions: key %d is taken by another link", core.ErrNonRetryable, key)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("checkKeyCollisions: %s", err)
+	}
 
 	return nil
 }
+
+// isSameDestination compares urls by their canonical form, an url that does not parse only equals itself.
+func isSameDestination(canonicalizationPolicy core.CanonicalizationPolicy, stored, linked string) bool {
+	if stored == linked {
+		return true
+	}
+
+	storedURL, err := core.NewURLWithPolicies(stored, core.UserinfoStrip, canonicalizationPolicy)
+	if err != nil {
+		return false
+	}
+	linkedURL, err := core.NewURLWithPolicies(linked, core.UserinfoStrip, canonicalizationPolicy)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(storedURL.Fingerprint(), linkedURL.Fingerprint())
+}
+
+// saveManyWithCopy streams rows with COPY into a transaction scoped staging table and moves them
+// into encoded_urls with ON CONFLICT, so replaying an already persisted batch is a no-op.
+func (s *LinkStore) saveManyWithCopy(ctx context.Context, links []core.LinkDTO, inserted map[int64]struct{}) error {
+	tx, err := s.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: begin: %s", errEncodedURLStore, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"CREATE TEMP TABLE encoded_urls_staging (LIKE encoded_urls INCLUDING DEFAULTS) ON COMMIT DROP",
+	)
+	if err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: create staging table: %s", errEncodedURLStore, err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("encoded_urls_staging", encodedURLsColumns...))
+	if err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: prepare copy: %s", errEncodedURLStore, err)
+	}
+
+	for _, linkDto := range links {
+		if _, err = stmt.ExecContext(ctx, linkRow(linkDto, s.urlHashPolicy)...); err != nil {
+			_ = stmt.Close()
+
+			return fmt.Errorf("%w: saveManyWithCopy: copy row: %w", errEncodedURLStore, classifyPostgresError(err))
+		}
+	}
+
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+
+		return fmt.Errorf("%w: saveManyWithCopy: flush copy: %w", errEncodedURLStore, classifyPostgresError(err))
+	}
+	if err = stmt.Close(); err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: close copy: %s", errEncodedURLStore, err)
+	}
+
+	columns := strings.Join(encodedURLsColumns, ", ")
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			`INSERT INTO encoded_urls (%s) SELECT %s FROM encoded_urls_staging
+			ON CONFLICT (token_identifier) DO NOTHING RETURNING token_identifier`,
+			columns,
+			columns,
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: move from staging: %w", errEncodedURLStore, classifyPostgresError(err))
+	}
+	if err = collectInsertedKeys(rows, inserted); err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: read inserted keys: %w", errEncodedURLStore, classifyPostgresError(err))
+	}
+	if err = checkKeyCollisions(ctx, tx, s.canonicalizationPolicy, links, inserted); err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: %w", errEncodedURLStore, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("%w: saveManyWithCopy: commit: %s", errEncodedURLStore, err)
+	}
+
+	return nil
+}
+
+// classifyPostgresError marks data and integrity violations as non retryable, the same rows will fail again.
+func classifyPostgresError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "22", "23":
+			return fmt.Errorf("%w: %s", core.ErrNonRetryable, err)
+		}
+	}
+
+	return err
+}
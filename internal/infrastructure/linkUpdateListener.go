@@ -0,0 +1,107 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/lib/pq"
+)
+
+var errLinkUpdateListener = errors.New("errLinkUpdateListener")
+
+const (
+	listenerMinReconnectInterval = time.Second
+	listenerMaxReconnectInterval = 30 * time.Second
+	listenerPingInterval         = time.Minute
+)
+
+// LinkUpdateListener keeps this instance from serving a destination that was changed on another one: it drops
+// links announced on linkUpdatedChannel from the cache and from pending links. While its connection is down
+// announcements are missed, so the link store bypasses the cache until it is back.
+type LinkUpdateListener struct {
+	listener     *pq.Listener
+	linkStore    *LinkStore
+	pendingLinks *PendingLinks
+	logger       *logger.AppLogger
+}
+
+func NewLinkUpdateListener(
+	ctx context.Context,
+	logger *logger.AppLogger,
+	cfg postgresClientConfig,
+	appName string,
+	linkStore *LinkStore,
+	pendingLinks *PendingLinks,
+) (*LinkUpdateListener, error) {
+	listener := pq.NewListener(
+		postgresConnString(cfg, appName),
+		listenerMinReconnectInterval,
+		listenerMaxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			switch event {
+			case pq.ListenerEventDisconnected:
+				logger.WarnContext(ctx, "link update listener disconnected, bypassing link cache", "err", err)
+				linkStore.BypassCache(ctx)
+			case pq.ListenerEventReconnected:
+				logger.InfoContext(ctx, "link update listener reconnected, using link cache again")
+				linkStore.UseCache(ctx)
+			case pq.ListenerEventConnectionAttemptFailed:
+				logger.WarnContext(ctx, "link update listener failed to reconnect", "err", err)
+			}
+		},
+	)
+	if err := listener.Listen(linkUpdatedChannel); err != nil {
+		_ = listener.Close()
+
+		return nil, fmt.Errorf("%w: NewLinkUpdateListener: listen: %s", errLinkUpdateListener, err)
+	}
+
+	updateListener := &LinkUpdateListener{
+		listener:     listener,
+		linkStore:    linkStore,
+		pendingLinks: pendingLinks,
+		logger:       logger,
+	}
+	go updateListener.listen(ctx)
+
+	return updateListener, nil
+}
+
+func (l *LinkUpdateListener) listen(ctx context.Context) {
+	defer func() {
+		_ = l.listener.Close()
+	}()
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification := <-l.listener.Notify:
+			// pq sends nil after a reconnect, the cache was cleared then.
+			if notification == nil {
+				continue
+			}
+
+			key, err := strconv.ParseInt(notification.Extra, 10, 64)
+			if err != nil {
+				l.logger.WarnContext(ctx, "link update listener got invalid key", "payload", notification.Extra)
+
+				continue
+			}
+			l.linkStore.Invalidate(ctx, key)
+			l.pendingLinks.Remove(core.LinkKeyDto{Value: key})
+		case <-ticker.C:
+			if err := l.listener.Ping(); err != nil {
+				l.logger.WarnContext(ctx, "link update listener ping failed", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+// linkUpdatedChannel carries the key of every link whose destination changed, see LinkUpdateListener.
+const linkUpdatedChannel = "shortorg_link_updated"
+
+// ChangeDestination records the new destination as the next version of the link and points the link at it.
+// Version 1, the destination the link was issued with, is recorded on the first change. Other instances drop
+// the link from their caches once the change commits. It is false when the link is not stored on the host.
+func (s *LinkStore) ChangeDestination(
+	ctx context.Context,
+	change core.LinkDestinationChangeDto,
+) (*core.LinkVersionDto, bool, error) {
+	tx, err := s.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: ChangeDestination: begin: %s", errEncodedURLStore, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var (
+		url       string
+		owner     string
+		version   int
+		createdAt sql.NullTime
+	)
+	err = tx.QueryRowxContext(
+		ctx,
+		`SELECT url, owner, version, created_at FROM encoded_urls
+		WHERE token_identifier = $1 AND host = $2
+		FOR UPDATE`,
+		change.Key.Value,
+		change.Host.Hostname,
+	).Scan(&url, &owner, &version, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: ChangeDestination: lock link: %s", errEncodedURLStore, err)
+	}
+	// Links encoded without an owner have nobody who may change them.
+	if owner == "" || owner != change.Author {
+		return nil, false, fmt.Errorf("%w: ChangeDestination: key %d", core.ErrNotLinkOwner, change.Key.Value)
+	}
+
+	var isDeterministic bool
+	err = tx.QueryRowxContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM deterministic_link_keys WHERE token_identifier = $1)",
+		change.Key.Value,
+	).Scan(&isDeterministic)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: ChangeDestination: %s", errEncodedURLStore, err)
+	}
+	if isDeterministic {
+		return nil, false, fmt.Errorf(
+			"%w: ChangeDestination: key %d is derived from its destination",
+			core.ErrImmutableLink,
+			change.Key.Value,
+		)
+	}
+
+	if version == 1 {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO link_versions (token_identifier, version, url, author, created_at) VALUES ($1, 1, $2, $3, $4)
+			ON CONFLICT (token_identifier, version) DO NOTHING`,
+			change.Key.Value,
+			url,
+			owner,
+			nullTimeOrNow(createdAt),
+		)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: ChangeDestination: record first version: %s", errEncodedURLStore, err)
+		}
+	}
+
+	changed := core.LinkVersionDto{
+		Version:        version + 1,
+		DestinationURL: change.DestinationURL,
+		Author:         change.Author,
+		RestoredFrom:   change.RestoredFrom,
+	}
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO link_versions (token_identifier, version, url, author, restored_from) VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`,
+		change.Key.Value,
+		changed.Version,
+		change.DestinationURL.Value,
+		change.Author,
+		change.RestoredFrom,
+	).Scan(&changed.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf(
+			"%w: ChangeDestination: record version: %w",
+			errEncodedURLStore,
+			classifyPostgresError(err),
+		)
+	}
+
+	var urlHash interface{}
+	var hashPolicy sql.NullString
+	if len(change.URLFingerprint) != 0 {
+		urlHash = change.URLFingerprint
+		hashPolicy = sql.NullString{String: s.urlHashPolicy, Valid: true}
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE encoded_urls SET url = $2, url_hash = $3, url_hash_policy = $4, version = $5 WHERE token_identifier = $1",
+		change.Key.Value,
+		change.DestinationURL.Value,
+		urlHash,
+		hashPolicy,
+		changed.Version,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf(
+			"%w: ChangeDestination: update link: %w",
+			errEncodedURLStore,
+			classifyPostgresError(err),
+		)
+	}
+
+	// Notifications are delivered on commit, never for a rolled back change.
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", linkUpdatedChannel, strconv.FormatInt(change.Key.Value, 10))
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: ChangeDestination: notify: %s", errEncodedURLStore, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("%w: ChangeDestination: commit: %s", errEncodedURLStore, err)
+	}
+
+	s.Invalidate(ctx, change.Key.Value)
+
+	return &changed, true, nil
+}
+
+// ListVersions answers the owner of the link with its destinations, oldest first. It is false when the link is
+// not stored on the host.
+func (s *LinkStore) ListVersions(
+	ctx context.Context,
+	keyDto core.LinkKeyDto,
+	hostDto core.LinkHostDto,
+	requestedBy string,
+) ([]core.LinkVersionDto, bool, error) {
+	var (
+		url       string
+		owner     string
+		version   int
+		createdAt sql.NullTime
+	)
+	err := s.postgresClient.QueryRowxContext(
+		ctx,
+		"SELECT url, owner, version, created_at FROM encoded_urls WHERE token_identifier = $1 AND host = $2",
+		keyDto.Value,
+		hostDto.Hostname,
+	).Scan(&url, &owner, &version, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: ListVersions: %s", errEncodedURLStore, err)
+	}
+	if owner == "" || owner != requestedBy {
+		return nil, false, fmt.Errorf("%w: ListVersions: key %d", core.ErrNotLinkOwner, keyDto.Value)
+	}
+
+	// A link that never changed has no recorded versions yet.
+	if version == 1 {
+		return []core.LinkVersionDto{{
+			Version:        1,
+			DestinationURL: core.URLDto{Value: url},
+			Author:         owner,
+			CreatedAt:      nullTimeOrNow(createdAt),
+		}}, true, nil
+	}
+
+	versions, err := s.listVersions(ctx, keyDto)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return versions, true, nil
+}
+
+func (s *LinkStore) listVersions(ctx context.Context, keyDto core.LinkKeyDto) ([]core.LinkVersionDto, error) {
+	rows, err := s.postgresClient.QueryxContext(
+		ctx,
+		`SELECT version, url, author, restored_from, created_at FROM link_versions
+		WHERE token_identifier = $1
+		ORDER BY version`,
+		keyDto.Value,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ListVersions: %s", errEncodedURLStore, err)
+	}
+
+	versions, err := scanLinkVersions(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ListVersions: scan: %s", errEncodedURLStore, err)
+	}
+
+	return versions, nil
+}
+
+func scanLinkVersions(rows *sqlx.Rows) ([]core.LinkVersionDto, error) {
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var versions []core.LinkVersionDto
+	for rows.Next() {
+		var (
+			version      core.LinkVersionDto
+			restoredFrom sql.NullInt32
+		)
+		if err := rows.Scan(
+			&version.Version,
+			&version.DestinationURL.Value,
+			&version.Author,
+			&restoredFrom,
+			&version.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if restoredFrom.Valid {
+			from := int(restoredFrom.Int32)
+			version.RestoredFrom = &from
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
+// Invalidate drops the link from the cache after its destination changed.
+func (s *LinkStore) Invalidate(ctx context.Context, key int64) {
+	s.invalidations.Add(1)
+	if err := s.cache.Delete(ctx, key); err != nil {
+		s.logger.WarnContext(ctx, "LinkStore: error invalidating link in cache", "key", key, "err", err)
+	}
+}
+
+// InvalidateAll drops every cached link, for when destination changes may have been missed.
+func (s *LinkStore) InvalidateAll(ctx context.Context) {
+	s.invalidations.Add(1)
+	if err := s.cache.Clear(ctx); err != nil {
+		s.logger.WarnContext(ctx, "LinkStore: error clearing link cache", "err", err)
+	}
+}
+
+// BypassCache reads every link from the database until UseCache, the cache may be stale by then.
+func (s *LinkStore) BypassCache(ctx context.Context) {
+	s.isCacheBypassed.Store(true)
+	s.InvalidateAll(ctx)
+}
+
+// UseCache starts from an empty cache, changes made while it was bypassed are not in it.
+func (s *LinkStore) UseCache(ctx context.Context) {
+	s.InvalidateAll(ctx)
+	s.isCacheBypassed.Store(false)
+}
+
+// nullTimeOrNow covers links stored before encoded_urls.created_at had a value.
+func nullTimeOrNow(value sql.NullTime) time.Time {
+	if value.Valid {
+		return value.Time
+	}
+
+	return time.Now().UTC()
+}
@@ -0,0 +1,314 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+)
+
+var errNodeLinkKeyStore = errors.New("errNodeLinkKeyStore")
+
+// nodeKeyEpoch is tick zero, ticks are whole seconds since.
+var nodeKeyEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	minNodeKeyTickBits  = 31 // ~68 years of ticks
+	releaseNodeTimeout  = time.Second
+	defaultNodeBits     = 10
+	defaultCounterBits  = 16
+	defaultNodeReserve  = 60
+	defaultNodeBeat     = 5
+	defaultNodeStaleFor = 30
+)
+
+// NodeLinkKeyStore builds keys without any per key database call: offset in its band is
+// tick<<(nodeBits+counterBits) | node<<counterBits | counter. Instances never share a node, so keys are unique
+// as long as a node never repeats a tick, which the registry high-water mark guarantees across restarts
+// and which a local logical clock guarantees when the wall clock goes back.
+type NodeLinkKeyStore struct {
+	logger   *logger.AppLogger
+	config   nodeKeyStoreConfig
+	registry nodeRegistry
+	band     core.LinkKeyBand
+	nodeID   int64
+
+	mu      sync.Mutex
+	tick    int64
+	counter int64
+
+	maxTick       int64
+	reservedTick  atomic.Int64
+	ownedUntil    atomic.Int64
+	degradedCause atomic.Pointer[string]
+}
+
+func NewNodeLinkKeyStore(
+	ctx context.Context,
+	logger *logger.AppLogger,
+	postgresClient *sqlx.DB,
+	config nodeKeyStoreConfig,
+	tokenStoreConfig tokenStoreConfig,
+) (*NodeLinkKeyStore, error) {
+	config = withNodeKeyStoreDefaults(config)
+
+	band, err := core.NewLinkKeyBand(config.SlugLength)
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewNodeLinkKeyStore: %s", errNodeLinkKeyStore, err)
+	}
+
+	// The band must be above every band the sequence may have issued, node keys would meet those otherwise.
+	minSequence, maxSequence, err := tokenStoreConfig.sequenceSlugLengths()
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewNodeLinkKeyStore: %s", errNodeLinkKeyStore, err)
+	}
+	if band.SlugLength <= maxSequence {
+		return nil, fmt.Errorf(
+			"%w: NewNodeLinkKeyStore: slug length %d is not above the sequence bands (%d .. %d)",
+			errNodeLinkKeyStore,
+			band.SlugLength,
+			minSequence,
+			maxSequence,
+		)
+	}
+
+	bandBits := bits.Len64(uint64(band.Last-band.First+1)) - 1 //nolint:gosec // positive
+	tickBits := bandBits - config.NodeBits - config.CounterBits
+	if tickBits < minNodeKeyTickBits {
+		return nil, fmt.Errorf(
+			"%w: NewNodeLinkKeyStore: %d bits left for time in slug length %d, at least %d are needed",
+			errNodeLinkKeyStore,
+			tickBits,
+			config.SlugLength,
+			minNodeKeyTickBits,
+		)
+	}
+	if config.ReserveSeconds <= 2*config.HeartbeatIntervalSeconds ||
+		config.StaleAfterSeconds <= 2*config.HeartbeatIntervalSeconds {
+		return nil, fmt.Errorf(
+			"%w: NewNodeLinkKeyStore: ReserveSeconds and StaleAfterSeconds must exceed two heartbeats",
+			errNodeLinkKeyStore,
+		)
+	}
+
+	registry, err := newNodeRegistry(postgresClient, config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewNodeLinkKeyStore: %s", errNodeLinkKeyStore, err)
+	}
+
+	nodeID, reservedTick, err := registry.claim(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: NewNodeLinkKeyStore: %s", errNodeLinkKeyStore, err)
+	}
+
+	store := &NodeLinkKeyStore{
+		logger:   logger,
+		config:   config,
+		registry: registry,
+		band:     *band,
+		nodeID:   int64(nodeID),
+		maxTick:  int64(1)<<tickBits - 1,
+		tick:     max(currentNodeKeyTick(), reservedTick+1),
+	}
+
+	if err = store.reserve(ctx); err != nil {
+		return nil, err
+	}
+
+	logger.InfoContext(ctx, "node link key store is ready", "node", nodeID, "tick", store.tick)
+
+	go store.heartbeatLoop(ctx)
+
+	return store, nil
+}
+
+func withNodeKeyStoreDefaults(config nodeKeyStoreConfig) nodeKeyStoreConfig {
+	if config.NodeBits == 0 {
+		config.NodeBits = defaultNodeBits
+	}
+	if config.CounterBits == 0 {
+		config.CounterBits = defaultCounterBits
+	}
+	if config.HeartbeatIntervalSeconds == 0 {
+		config.HeartbeatIntervalSeconds = defaultNodeBeat
+	}
+	if config.StaleAfterSeconds == 0 {
+		config.StaleAfterSeconds = defaultNodeStaleFor
+	}
+	if config.ReserveSeconds == 0 {
+		config.ReserveSeconds = defaultNodeReserve
+	}
+
+	return config
+}
+
+func newNodeRegistry(postgresClient *sqlx.DB, config nodeKeyStoreConfig) (nodeRegistry, error) {
+	maxNodes := 1 << config.NodeBits
+
+	switch config.Registry {
+	case "", nodeRegistryModeTable:
+		if postgresClient == nil {
+			return nil, errors.New("postgresClient is nil")
+		}
+
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+
+		return &nodeRegistryPostgres{
+			postgresClient: postgresClient,
+			owner:          hostname + ":" + strconv.Itoa(os.Getpid()),
+			maxNodes:       maxNodes,
+			staleAfter:     time.Duration(config.StaleAfterSeconds) * time.Second,
+		}, nil
+	case nodeRegistryModeStatic:
+		if config.StaticNodeID < 0 || maxNodes <= config.StaticNodeID {
+			return nil, fmt.Errorf("static node id must be included in 0 .. %d", maxNodes-1)
+		}
+		if config.StatePath == "" {
+			return nil, errors.New("static node registry needs a StatePath")
+		}
+
+		return &nodeRegistryStatic{nodeID: config.StaticNodeID, statePath: config.StatePath}, nil
+	default:
+		return nil, fmt.Errorf("unknown node registry %s", config.Registry)
+	}
+}
+
+func (s *NodeLinkKeyStore) Issue(_ context.Context, _ core.LinkKeySeedDto) (*core.LinkKey, error) {
+	if err := s.Health(); err != nil {
+		return nil, fmt.Errorf("%w: Issue: %w", errNodeLinkKeyStore, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issueLocked()
+}
+
+func (s *NodeLinkKeyStore) IssueMany(_ context.Context, count int) ([]core.LinkKey, error) {
+	if err := s.Health(); err != nil {
+		return nil, fmt.Errorf("%w: IssueMany: %w", errNodeLinkKeyStore, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]core.LinkKey, 0, count)
+	for range count {
+		key, err := s.issueLocked()
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+func (s *NodeLinkKeyStore) issueLocked() (*core.LinkKey, error) {
+	// The tick never goes back with the wall clock, a used up tick borrows the next one.
+	if now := currentNodeKeyTick(); s.tick < now {
+		s.tick, s.counter = now, 0
+	}
+	if s.counter>>s.config.CounterBits != 0 {
+		s.tick, s.counter = s.tick+1, 0
+	}
+	if s.reservedTick.Load() < s.tick {
+		return nil, fmt.Errorf("%w: Issue: tick %d is not reserved yet", core.ErrLinkKeyStoreDegraded, s.tick)
+	}
+	if s.maxTick < s.tick {
+		return nil, fmt.Errorf("%w: Issue: key space of slug length %d is exhausted", errNodeLinkKeyStore, s.band.SlugLength)
+	}
+
+	offset := s.tick<<(s.config.NodeBits+s.config.CounterBits) | s.nodeID<<s.config.CounterBits | s.counter
+	s.counter++
+
+	return core.NewLinkKey(s.band.First + offset)
+}
+
+// Health reports ErrLinkKeyStoreDegraded once the node may have been taken over, its reservation ran out.
+func (s *NodeLinkKeyStore) Health() error {
+	if time.Now().UnixNano() < s.ownedUntil.Load() {
+		return nil
+	}
+
+	cause := "node ownership expired"
+	if degradedCause := s.degradedCause.Load(); degradedCause != nil {
+		cause = *degradedCause
+	}
+
+	return fmt.Errorf("%w: %s", core.ErrLinkKeyStoreDegraded, cause)
+}
+
+func (s *NodeLinkKeyStore) RemainingByBand() map[string]int64 {
+	s.mu.Lock()
+	tick := s.tick
+	s.mu.Unlock()
+
+	perTick := int64(1) << (s.config.NodeBits + s.config.CounterBits)
+	remaining := (s.maxTick - min(tick, s.maxTick)) * perTick
+
+	return map[string]int64{strconv.Itoa(s.band.SlugLength): remaining}
+}
+
+func (s *NodeLinkKeyStore) heartbeatLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.HeartbeatIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.reserve(ctx); err != nil {
+				cause := err.Error()
+				s.degradedCause.Store(&cause)
+				s.logger.ErrorContext(ctx, "node link key store heartbeat failed", "node", s.nodeID, "err", err)
+			}
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseNodeTimeout)
+			s.registry.release(releaseCtx)
+			cancel()
+
+			return
+		}
+	}
+}
+
+// reserve moves the high-water mark ReserveSeconds ahead and extends ownership of the node.
+// Ownership ends a heartbeat before the registry considers the node stale, so two owners never overlap.
+func (s *NodeLinkKeyStore) reserve(ctx context.Context) error {
+	startedAt := time.Now()
+
+	s.mu.Lock()
+	tick := max(s.tick, currentNodeKeyTick()) + int64(s.config.ReserveSeconds)
+	s.mu.Unlock()
+
+	if err := s.registry.reserve(ctx, tick); err != nil {
+		return fmt.Errorf("%w: reserve: %w", errNodeLinkKeyStore, err)
+	}
+
+	if s.reservedTick.Load() < tick {
+		s.reservedTick.Store(tick)
+	}
+	ownedFor := time.Duration(s.config.StaleAfterSeconds-s.config.HeartbeatIntervalSeconds) * time.Second
+	s.ownedUntil.Store(startedAt.Add(ownedFor).UnixNano())
+	if s.degradedCause.Swap(nil) != nil {
+		s.logger.WarnContext(ctx, "node link key store recovered", "node", s.nodeID)
+	}
+
+	return nil
+}
+
+func currentNodeKeyTick() int64 {
+	return int64(time.Since(nodeKeyEpoch) / time.Second)
+}
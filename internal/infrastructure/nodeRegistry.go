@@ -0,0 +1,155 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var errNodeLost = errors.New("node is owned by another instance")
+
+// nodeRegistry hands out a node id and keeps its high-water mark: the last time tick keys may have been
+// issued at. A node only issues keys at ticks it has reserved beforehand, and a new owner of the node
+// starts after the mark, so a clock going back never repeats a key.
+type nodeRegistry interface {
+	claim(context.Context) (int, int64, error)
+	reserve(context.Context, int64) error
+	release(context.Context)
+}
+
+const (
+	nodeRegistryModeTable  = "table"
+	nodeRegistryModeStatic = "static"
+	nodeClaimAttempts      = 3
+)
+
+// nodeRegistryPostgres claims the first free or stale node in key_nodes, heartbeats keep it owned.
+type nodeRegistryPostgres struct {
+	postgresClient *sqlx.DB
+	owner          string
+	maxNodes       int
+	staleAfter     time.Duration
+	nodeID         int
+}
+
+func (r *nodeRegistryPostgres) claim(ctx context.Context) (int, int64, error) {
+	for range nodeClaimAttempts {
+		var (
+			nodeID       int
+			reservedTick int64
+		)
+		err := r.postgresClient.QueryRowxContext(
+			ctx,
+			`WITH candidate AS (
+				SELECT n AS node_id
+				FROM generate_series(0, $2::int - 1) AS n
+				LEFT JOIN key_nodes ON key_nodes.node_id = n
+				WHERE key_nodes.node_id IS NULL OR key_nodes.heartbeat_at < now() - make_interval(secs => $3)
+				ORDER BY n
+				LIMIT 1
+			)
+			INSERT INTO key_nodes (node_id, owner, heartbeat_at)
+			SELECT node_id, $1, now() FROM candidate
+			ON CONFLICT (node_id) DO UPDATE SET owner = EXCLUDED.owner, heartbeat_at = now(), claimed_at = now()
+			WHERE key_nodes.heartbeat_at < now() - make_interval(secs => $3)
+			RETURNING node_id, reserved_until_tick`,
+			r.owner,
+			r.maxNodes,
+			r.staleAfter.Seconds(),
+		).Scan(&nodeID, &reservedTick)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Either every node is taken or another instance claimed the same candidate first.
+			continue
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("claim: %w", err)
+		}
+
+		r.nodeID = nodeID
+
+		return nodeID, reservedTick, nil
+	}
+
+	return 0, 0, fmt.Errorf("claim: no free node out of %d", r.maxNodes)
+}
+
+// reserve doubles as heartbeat.
+func (r *nodeRegistryPostgres) reserve(ctx context.Context, tick int64) error {
+	result, err := r.postgresClient.ExecContext(
+		ctx,
+		`UPDATE key_nodes SET heartbeat_at = now(), reserved_until_tick = GREATEST(reserved_until_tick, $3)
+		WHERE node_id = $1 AND owner = $2`,
+		r.nodeID,
+		r.owner,
+		tick,
+	)
+	if err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+	if affected != 1 {
+		return fmt.Errorf("reserve: node %d: %w", r.nodeID, errNodeLost)
+	}
+
+	return nil
+}
+
+// release lets another instance claim the node right away, the high-water mark stays with it.
+func (r *nodeRegistryPostgres) release(ctx context.Context) {
+	_, _ = r.postgresClient.ExecContext(
+		ctx,
+		"UPDATE key_nodes SET heartbeat_at = to_timestamp(0) WHERE node_id = $1 AND owner = $2",
+		r.nodeID,
+		r.owner,
+	)
+}
+
+// nodeRegistryStatic takes the node id from config, operators keep ids unique. The high-water mark is kept
+// in a local file, which therefore has to survive restarts.
+type nodeRegistryStatic struct {
+	nodeID    int
+	statePath string
+}
+
+func (r *nodeRegistryStatic) claim(_ context.Context) (int, int64, error) {
+	content, err := os.ReadFile(r.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return r.nodeID, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("claim: %w", err)
+	}
+
+	reservedTick, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("claim: corrupted state file %s: %w", r.statePath, err)
+	}
+
+	return r.nodeID, reservedTick, nil
+}
+
+func (r *nodeRegistryStatic) reserve(_ context.Context, tick int64) error {
+	if err := os.MkdirAll(filepath.Dir(r.statePath), 0o750); err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+
+	if err := writeFileAtomically(r.statePath, []byte(strconv.FormatInt(tick, 10))); err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+
+	return nil
+}
+
+func (r *nodeRegistryStatic) release(_ context.Context) {}
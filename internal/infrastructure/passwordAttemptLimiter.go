@@ -0,0 +1,187 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var errPasswordAttemptLimiter = errors.New("errPasswordAttemptLimiter")
+
+const (
+	defaultPasswordAttemptsPerLink = 20
+	defaultPasswordAttemptsPerIP   = 10
+	defaultPasswordAttemptsWindow  = 15 * time.Minute
+)
+
+// PasswordAttemptLimiter counts password attempts per link and per client ip in fixed windows.
+// Counts are kept in password_attempts, so the configured attempts hold across all instances together.
+// Its sweeper drops windows that reset.
+type PasswordAttemptLimiter struct {
+	postgresClient *sqlx.DB
+	logger         *logger.AppLogger
+	perLink        int
+	perIP          int
+	window         time.Duration
+}
+
+func NewPasswordAttemptLimiter(
+	ctx context.Context,
+	postgresClient *sqlx.DB,
+	logger *logger.AppLogger,
+	config passwordAttemptsConfig,
+) (*PasswordAttemptLimiter, error) {
+	if postgresClient == nil {
+		return nil, fmt.Errorf("%w: NewPasswordAttemptLimiter: postgresClient is nil", errPasswordAttemptLimiter)
+	}
+
+	perLink := config.PerLinkLimit
+	if perLink <= 0 {
+		perLink = defaultPasswordAttemptsPerLink
+	}
+	perIP := config.PerIPLimit
+	if perIP <= 0 {
+		perIP = defaultPasswordAttemptsPerIP
+	}
+	window := time.Duration(config.WindowSeconds) * time.Second
+	if window <= 0 {
+		window = defaultPasswordAttemptsWindow
+	}
+
+	limiter := &PasswordAttemptLimiter{
+		postgresClient: postgresClient,
+		logger:         logger,
+		perLink:        perLink,
+		perIP:          perIP,
+		window:         window,
+	}
+	go limiter.sweepLoop(ctx)
+
+	return limiter, nil
+}
+
+// Reserve takes an attempt from both the link's and the ip's window. When either is used up nothing is taken
+// and the time until it resets is returned.
+func (l *PasswordAttemptLimiter) Reserve(
+	ctx context.Context,
+	key core.LinkKeyDto,
+	clientIP string,
+) (time.Duration, bool, error) {
+	tx, err := l.postgresClient.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: Reserve: %s", errPasswordAttemptLimiter, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Both windows are locked by the upsert, always ip first, so concurrent attempts never take more than the limit.
+	ipKey, linkKey := ipAttemptsKey(clientIP), linkAttemptsKey(key)
+	rows, err := tx.QueryxContext(
+		ctx,
+		`INSERT INTO password_attempts (attempts_key, attempts, reset_at)
+		VALUES ($1, 0, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'), ($2, 0, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')
+		ON CONFLICT (attempts_key) DO UPDATE SET
+			attempts = CASE WHEN password_attempts.reset_at <= CURRENT_TIMESTAMP THEN 0
+				ELSE password_attempts.attempts END,
+			reset_at = CASE WHEN password_attempts.reset_at <= CURRENT_TIMESTAMP THEN EXCLUDED.reset_at
+				ELSE password_attempts.reset_at END
+		RETURNING attempts_key, attempts, EXTRACT(EPOCH FROM reset_at - CURRENT_TIMESTAMP)::float8`,
+		ipKey,
+		linkKey,
+		l.window.Seconds(),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: Reserve: %s", errPasswordAttemptLimiter, err)
+	}
+
+	var retryAfter time.Duration
+	for rows.Next() {
+		var attemptsKey string
+		var attempts int
+		var resetInSeconds float64
+		if err = rows.Scan(&attemptsKey, &attempts, &resetInSeconds); err != nil {
+			_ = rows.Close()
+
+			return 0, false, fmt.Errorf("%w: Reserve: %s", errPasswordAttemptLimiter, err)
+		}
+
+		limit := l.perLink
+		if attemptsKey == ipKey {
+			limit = l.perIP
+		}
+		if limit <= attempts {
+			retryAfter = max(retryAfter, time.Duration(resetInSeconds*float64(time.Second)))
+		}
+	}
+	if err = rows.Close(); err != nil {
+		return 0, false, fmt.Errorf("%w: Reserve: %s", errPasswordAttemptLimiter, err)
+	}
+	if 0 < retryAfter {
+		return retryAfter, false, nil
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE password_attempts SET attempts = attempts + 1 WHERE attempts_key = ANY($1)",
+		pq.Array([]string{ipKey, linkKey}),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: Reserve: %s", errPasswordAttemptLimiter, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("%w: Reserve: %s", errPasswordAttemptLimiter, err)
+	}
+
+	return 0, true, nil
+}
+
+// Refund gives back an attempt that turned out to be the right password, only failures count.
+// A refund that fails is only logged, the attempt then counts as a failure.
+func (l *PasswordAttemptLimiter) Refund(ctx context.Context, key core.LinkKeyDto, clientIP string) {
+	_, err := l.postgresClient.ExecContext(
+		ctx,
+		`UPDATE password_attempts SET attempts = attempts - 1
+		WHERE attempts_key = ANY($1) AND 0 < attempts AND CURRENT_TIMESTAMP < reset_at`,
+		pq.Array([]string{ipAttemptsKey(clientIP), linkAttemptsKey(key)}),
+	)
+	if err != nil {
+		l.logger.WarnContext(ctx, "password attempt refund failed", "key", key.Value, "err", err)
+	}
+}
+
+// sweepLoop drops windows that reset once per window, so the table only holds the last window's attempts.
+func (l *PasswordAttemptLimiter) sweepLoop(ctx context.Context) {
+	ticker := time.NewTicker(l.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := l.postgresClient.ExecContext(
+				ctx,
+				"DELETE FROM password_attempts WHERE reset_at <= CURRENT_TIMESTAMP",
+			)
+			if err != nil {
+				l.logger.WarnContext(ctx, "password attempts sweep failed", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func linkAttemptsKey(key core.LinkKeyDto) string {
+	return "link:" + strconv.FormatInt(key.Value, 10)
+}
+
+func ipAttemptsKey(clientIP string) string {
+	return "ip:" + clientIP
+}
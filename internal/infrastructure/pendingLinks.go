@@ -0,0 +1,102 @@
+package infrastructure
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// PendingLinks indexes links that were encoded on this instance but are not persisted yet.
+type PendingLinks struct {
+	mu    sync.RWMutex
+	links map[int64]core.LinkDTO
+	// reusable maps reusableLinkKey of links without an alias to their key.
+	reusable map[string]int64
+}
+
+func NewPendingLinks() *PendingLinks {
+	return &PendingLinks{links: make(map[int64]core.LinkDTO), reusable: make(map[string]int64)}
+}
+
+func (p *PendingLinks) Add(link core.LinkDTO) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.links[link.Key.Value] = link
+	if link.Alias == nil && link.Lifetime == nil && len(link.PasswordHash) == 0 && len(link.URLFingerprint) != 0 {
+		p.reusable[reusableLinkKey(link.Owner, link.Host, link.RedirectStatus, link.URLFingerprint)] = link.Key.Value
+	}
+}
+
+func (p *PendingLinks) RemoveMany(links []core.LinkDTO) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, link := range links {
+		delete(p.links, link.Key.Value)
+
+		reusableKey := reusableLinkKey(link.Owner, link.Host, link.RedirectStatus, link.URLFingerprint)
+		if key, ok := p.reusable[reusableKey]; ok && key == link.Key.Value {
+			delete(p.reusable, reusableKey)
+		}
+	}
+}
+
+// Remove drops the link once it is persisted and changed elsewhere, so the store answers for it.
+func (p *PendingLinks) Remove(key core.LinkKeyDto) {
+	p.mu.RLock()
+	link, ok := p.links[key.Value]
+	p.mu.RUnlock()
+
+	if ok {
+		p.RemoveMany([]core.LinkDTO{link})
+	}
+}
+
+func (p *PendingLinks) FindOne(key core.LinkKeyDto) (*core.LinkDTO, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	link, ok := p.links[key.Value]
+	if !ok {
+		return nil, false
+	}
+
+	return &link, true
+}
+
+func (p *PendingLinks) FindReusable(query core.ReusableLinkQueryDto) (*core.LinkDTO, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.reusable[reusableLinkKey(query.Owner, query.Host, query.RedirectStatus, query.URLFingerprint)]
+	if !ok {
+		return nil, false
+	}
+
+	link := p.links[key]
+
+	return &link, true
+}
+
+func (p *PendingLinks) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.links)
+}
+
+func reusableLinkKey(
+	owner string,
+	host core.LinkHostDto,
+	redirectStatus *core.RedirectStatusDto,
+	urlFingerprint []byte,
+) string {
+	var status string
+	if redirectStatus != nil {
+		status = strconv.Itoa(redirectStatus.Value)
+	}
+
+	return owner + "\x00" + host.Hostname + "\x00" + status + "\x00" + string(urlFingerprint)
+}
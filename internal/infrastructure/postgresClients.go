@@ -17,6 +17,7 @@ import (
 	"github.com/qustavo/sqlhooks/v2"
 )
 
+// Clients has TokenIdentifierClient nil when the identity db is not used.
 type Clients struct {
 	TokenIdentifierClient *sqlx.DB
 	ShortorgClient        *sqlx.DB
@@ -26,6 +27,7 @@ func ConnectToPostgresClients(
 	ctx context.Context,
 	logger *appLogger.AppLogger,
 	cfg postgresClientsConfig,
+	withTokenIdentifier bool,
 	appName string,
 	isProd bool,
 ) (*Clients, error) {
@@ -38,6 +40,10 @@ func ConnectToPostgresClients(
 		return nil, fmt.Errorf("error creating shortorg postgres client: %w", err)
 	}
 
+	if !withTokenIdentifier {
+		return &Clients{nil, shortOrgClient}, nil
+	}
+
 	tokenIdentityClient, err := newClientFn(ctx, cfg.TokenIdentifier)
 	if err != nil {
 		return nil, fmt.Errorf("error creating token identity client: %w", err)
@@ -54,10 +60,7 @@ func newPostgresClient(
 	appName string,
 	_ bool,
 ) (*sqlx.DB, error) {
-	connStr := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s application_name=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, appName,
-	)
+	connStr := postgresConnString(cfg, appName)
 
 	connection, err := sqlx.ConnectContext(ctx, registeredSQLHook.driverName(), connStr)
 
@@ -98,6 +101,13 @@ func newPostgresClient(
 	return connection, nil
 }
 
+func postgresConnString(cfg postgresClientConfig, appName string) string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s application_name=%s sslmode=disable",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, appName,
+	)
+}
+
 func registerSQLHook(logger *appLogger.AppLogger) sqlHook {
 	logger.Info("Registering sql hook")
 	hook := sqlHook{logger}
@@ -0,0 +1,539 @@
+package infrastructure
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+var errSegmentLog = errors.New("errSegmentLog")
+
+const (
+	segmentFileExt         = ".wal"
+	segmentCheckpointFile  = "checkpoint"
+	segmentRecordHeaderLen = 16 // length(4) + crc(4) + offset(8)
+	segmentMaxRecordLen    = 1 << 20
+)
+
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"
+	FsyncInterval FsyncPolicy = "interval"
+	FsyncNever    FsyncPolicy = "never"
+)
+
+// SegmentLog is an append-only log of encoded links split into segment files.
+// Every record gets a monotonically increasing offset, Commit marks offsets as persisted
+// and the checkpoint file keeps the lowest offset that is not persisted yet.
+type SegmentLog struct {
+	mu              sync.Mutex
+	dir             string
+	segmentMaxBytes int64
+	fsyncPolicy     FsyncPolicy
+	logger          *logger.AppLogger
+
+	active      *os.File
+	activeBase  uint64
+	activeSize  int64
+	segments    []uint64
+	nextOffset  uint64
+	replayUntil uint64
+	checkpoint  uint64
+	acked       map[uint64]struct{}
+	dirty       bool
+	// brokenErr is set once a failed append could not be rolled back, nothing is appended after it.
+	brokenErr error
+}
+
+func NewSegmentLog(ctx context.Context, logger *logger.AppLogger, cfg segmentLogConfig) (*SegmentLog, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("%w: NewSegmentLog: dir is not provided", errSegmentLog)
+	}
+
+	fsyncPolicy := FsyncPolicy(strings.ToLower(cfg.FsyncPolicy))
+	switch fsyncPolicy {
+	case "":
+		fsyncPolicy = FsyncAlways
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return nil, fmt.Errorf("%w: NewSegmentLog: fsync policy %s is not supported", errSegmentLog, cfg.FsyncPolicy)
+	}
+
+	segmentMaxBytes := cfg.SegmentMaxBytes
+	if segmentMaxBytes <= 0 {
+		segmentMaxBytes = 64 << 20
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("%w: NewSegmentLog: create dir: %s", errSegmentLog, err)
+	}
+
+	log := &SegmentLog{
+		dir:             cfg.Dir,
+		segmentMaxBytes: segmentMaxBytes,
+		fsyncPolicy:     fsyncPolicy,
+		logger:          logger,
+		acked:           make(map[uint64]struct{}),
+	}
+
+	if err := log.recover(); err != nil {
+		return nil, err
+	}
+
+	if fsyncPolicy == FsyncInterval {
+		interval := time.Duration(cfg.FsyncIntervalMs) * time.Millisecond
+		if interval <= 0 {
+			interval = 10 * time.Millisecond
+		}
+		go log.syncLoop(ctx, interval)
+	}
+
+	logger.InfoContext(
+		ctx,
+		"segment log recovered",
+		"dir", cfg.Dir,
+		"checkpoint", log.checkpoint,
+		"nextOffset", log.nextOffset,
+		"segments", len(log.segments),
+	)
+
+	return log, nil
+}
+
+func (l *SegmentLog) Append(_ context.Context, link core.LinkDTO) (uint64, error) {
+	payload, err := json.Marshal(link)
+	if err != nil {
+		return 0, fmt.Errorf("%w: Append: marshal: %s", errSegmentLog, err)
+	}
+	if segmentMaxRecordLen < len(payload) {
+		return 0, fmt.Errorf("%w: Append: record of %d bytes is too large", errSegmentLog, len(payload))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.brokenErr != nil {
+		return 0, fmt.Errorf("%w: Append: %w", errSegmentLog, l.brokenErr)
+	}
+
+	if l.segmentMaxBytes <= l.activeSize {
+		if err = l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	offset := l.nextOffset
+	record := encodeSegmentRecord(offset, payload)
+	if _, err = l.active.Write(record); err != nil {
+		return 0, l.rollbackAppend(fmt.Errorf("%w: Append: write: %s", errSegmentLog, err))
+	}
+
+	if l.fsyncPolicy == FsyncAlways {
+		if err = l.active.Sync(); err != nil {
+			return 0, l.rollbackAppend(fmt.Errorf("%w: Append: fsync: %s", errSegmentLog, err))
+		}
+	} else {
+		l.dirty = true
+	}
+
+	l.activeSize += int64(len(record))
+	l.nextOffset++
+
+	return offset, nil
+}
+
+// rollbackAppend cuts a record that failed to be written or synced off the active segment, its offset is
+// given to the next record. When that fails too the log stops taking records, a record with the same offset
+// written after it would be skipped on recovery.
+func (l *SegmentLog) rollbackAppend(appendErr error) error {
+	if err := l.active.Truncate(l.activeSize); err != nil {
+		l.brokenErr = fmt.Errorf("log is broken after %w: truncate: %s", appendErr, err)
+
+		return fmt.Errorf("%w: %w", errSegmentLog, l.brokenErr)
+	}
+
+	return appendErr
+}
+
+// Health reports the log as broken once a failed append could not be rolled back.
+func (l *SegmentLog) Health() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.brokenErr
+}
+
+// Commit marks offsets as persisted, moves the checkpoint over every contiguous persisted offset
+// and removes segments that are entirely behind it.
+func (l *SegmentLog) Commit(_ context.Context, offsets []uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, offset := range offsets {
+		if l.checkpoint <= offset {
+			l.acked[offset] = struct{}{}
+		}
+	}
+
+	previousCheckpoint := l.checkpoint
+	for {
+		if _, ok := l.acked[l.checkpoint]; !ok {
+			break
+		}
+		delete(l.acked, l.checkpoint)
+		l.checkpoint++
+	}
+
+	if l.checkpoint == previousCheckpoint {
+		return nil
+	}
+
+	if err := l.writeCheckpoint(); err != nil {
+		return err
+	}
+
+	return l.removePersistedSegments()
+}
+
+// Replay calls fn for every record that was in the log on startup and is not persisted yet.
+func (l *SegmentLog) Replay(ctx context.Context, fn func(uint64, core.LinkDTO) error) error {
+	l.mu.Lock()
+	segments := append([]uint64(nil), l.segments...)
+	checkpoint := l.checkpoint
+	replayUntil := l.replayUntil
+	l.mu.Unlock()
+
+	for i, base := range segments {
+		if replayUntil <= base {
+			break
+		}
+		if i+1 < len(segments) && segments[i+1] <= checkpoint {
+			continue
+		}
+
+		err := l.scanSegment(base, func(offset uint64, payload []byte) error {
+			if offset < checkpoint || replayUntil <= offset {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			var link core.LinkDTO
+			if err := json.Unmarshal(payload, &link); err != nil {
+				return fmt.Errorf("%w: Replay: unmarshal record %d: %s", errSegmentLog, offset, err)
+			}
+
+			return fn(offset, link)
+		})
+		if err != nil && !errors.Is(err, errSegmentTornRecord) && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *SegmentLog) syncLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.sync(ctx)
+		case <-ctx.Done():
+			l.sync(ctx)
+
+			return
+		}
+	}
+}
+
+func (l *SegmentLog) sync(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty {
+		return
+	}
+
+	if err := l.active.Sync(); err != nil {
+		l.logger.ErrorContext(ctx, "segment log fsync failed", "err", err)
+
+		return
+	}
+	l.dirty = false
+}
+
+func (l *SegmentLog) recover() error {
+	checkpoint, err := l.readCheckpoint()
+	if err != nil {
+		return err
+	}
+	l.checkpoint = checkpoint
+
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("%w: recover: read dir: %s", errSegmentLog, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentFileExt) {
+			continue
+		}
+		base, parseErr := strconv.ParseUint(strings.TrimSuffix(name, segmentFileExt), 10, 64)
+		if parseErr != nil {
+			continue
+		}
+		l.segments = append(l.segments, base)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	l.nextOffset = checkpoint
+	for i, base := range l.segments {
+		isLast := i == len(l.segments)-1
+		validSize := int64(0)
+		next := base
+
+		scanErr := l.scanSegment(base, func(offset uint64, payload []byte) error {
+			if offset != next {
+				return fmt.Errorf("%w: recover: segment %d has offset %d, expected %d", errSegmentLog, base, offset, next)
+			}
+			next++
+			validSize += int64(segmentRecordHeaderLen + len(payload))
+
+			return nil
+		})
+
+		switch {
+		case errors.Is(scanErr, errSegmentTornRecord) && isLast:
+			l.logger.Warn("segment log: truncating torn tail", "segment", base, "validSize", validSize)
+			if truncateErr := os.Truncate(l.segmentPath(base), validSize); truncateErr != nil {
+				return fmt.Errorf("%w: recover: truncate: %s", errSegmentLog, truncateErr)
+			}
+		case scanErr != nil:
+			return scanErr
+		}
+
+		if l.nextOffset < next {
+			l.nextOffset = next
+		}
+		if isLast {
+			l.activeBase = base
+			l.activeSize = validSize
+		}
+	}
+	l.replayUntil = l.nextOffset
+
+	if len(l.segments) == 0 {
+		return l.createSegment(l.nextOffset)
+	}
+
+	active, err := os.OpenFile(l.segmentPath(l.activeBase), os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("%w: recover: open active segment: %s", errSegmentLog, err)
+	}
+	l.active = active
+
+	return nil
+}
+
+var errSegmentTornRecord = errors.New("torn record")
+
+func (l *SegmentLog) scanSegment(base uint64, fn func(uint64, []byte) error) error {
+	file, err := os.Open(l.segmentPath(base))
+	if err != nil {
+		return fmt.Errorf("%w: scanSegment: open: %w", errSegmentLog, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, segmentRecordHeaderLen)
+	for {
+		_, err = io.ReadFull(reader, header)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: segment %d: %w", errSegmentLog, base, errSegmentTornRecord)
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+		offset := binary.BigEndian.Uint64(header[8:16])
+		if segmentMaxRecordLen < length {
+			return fmt.Errorf("%w: segment %d: %w", errSegmentLog, base, errSegmentTornRecord)
+		}
+
+		payload := make([]byte, length)
+		if _, err = io.ReadFull(reader, payload); err != nil {
+			return fmt.Errorf("%w: segment %d: %w", errSegmentLog, base, errSegmentTornRecord)
+		}
+
+		if segmentRecordChecksum(header[8:16], payload) != checksum {
+			return fmt.Errorf("%w: segment %d: %w", errSegmentLog, base, errSegmentTornRecord)
+		}
+
+		if err = fn(offset, payload); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *SegmentLog) rotate() error {
+	if err := l.active.Sync(); err != nil {
+		return fmt.Errorf("%w: rotate: fsync: %s", errSegmentLog, err)
+	}
+	if err := l.active.Close(); err != nil {
+		return fmt.Errorf("%w: rotate: close: %s", errSegmentLog, err)
+	}
+	l.dirty = false
+
+	return l.createSegment(l.nextOffset)
+}
+
+func (l *SegmentLog) createSegment(base uint64) error {
+	active, err := os.OpenFile(l.segmentPath(base), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("%w: createSegment: %s", errSegmentLog, err)
+	}
+
+	if err = syncDir(l.dir); err != nil {
+		return err
+	}
+
+	l.active = active
+	l.activeBase = base
+	l.activeSize = 0
+	l.segments = append(l.segments, base)
+
+	return nil
+}
+
+func (l *SegmentLog) removePersistedSegments() error {
+	kept := l.segments[:0]
+	for i, base := range l.segments {
+		isPersisted := i+1 < len(l.segments) && l.segments[i+1] <= l.checkpoint
+		if !isPersisted || base == l.activeBase {
+			kept = append(kept, base)
+
+			continue
+		}
+		if err := os.Remove(l.segmentPath(base)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: removePersistedSegments: %s", errSegmentLog, err)
+		}
+	}
+	l.segments = kept
+
+	return nil
+}
+
+func (l *SegmentLog) readCheckpoint() (uint64, error) {
+	content, err := os.ReadFile(filepath.Join(l.dir, segmentCheckpointFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: readCheckpoint: %s", errSegmentLog, err)
+	}
+
+	checkpoint, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: readCheckpoint: invalid content: %s", errSegmentLog, err)
+	}
+
+	return checkpoint, nil
+}
+
+func (l *SegmentLog) writeCheckpoint() error {
+	return writeFileAtomically(
+		filepath.Join(l.dir, segmentCheckpointFile),
+		[]byte(strconv.FormatUint(l.checkpoint, 10)),
+	)
+}
+
+func (l *SegmentLog) segmentPath(base uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", base, segmentFileExt))
+}
+
+func encodeSegmentRecord(offset uint64, payload []byte) []byte {
+	record := make([]byte, segmentRecordHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload))) //nolint:gosec // its validated
+	binary.BigEndian.PutUint64(record[8:16], offset)
+	copy(record[segmentRecordHeaderLen:], payload)
+	binary.BigEndian.PutUint32(record[4:8], segmentRecordChecksum(record[8:16], payload))
+
+	return record
+}
+
+var segmentCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+func segmentRecordChecksum(offset []byte, payload []byte) uint32 {
+	checksum := crc32.Update(0, segmentCRCTable, offset)
+
+	return crc32.Update(checksum, segmentCRCTable, payload)
+}
+
+func writeFileAtomically(path string, content []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("writeFileAtomically: open: %w", err)
+	}
+
+	if _, err = file.Write(content); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("writeFileAtomically: write: %w", err)
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("writeFileAtomically: fsync: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("writeFileAtomically: close: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("writeFileAtomically: rename: %w", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("syncDir: open: %w", err)
+	}
+	defer func() {
+		_ = dirFile.Close()
+	}()
+
+	if err = dirFile.Sync(); err != nil {
+		return fmt.Errorf("syncDir: fsync: %w", err)
+	}
+
+	return nil
+}
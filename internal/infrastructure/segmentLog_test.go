@@ -0,0 +1,188 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+func TestSegmentLogRecoversAfterTornWrite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// tear damages the last of three records in the segment of size bytes, whose last record is lastLen bytes.
+		tear func(t *testing.T, path string, size, lastLen int64)
+	}{
+		{
+			name: "payload cut short",
+			tear: func(t *testing.T, path string, size, _ int64) {
+				t.Helper()
+				truncateFile(t, path, size-3)
+			},
+		},
+		{
+			name: "header cut short",
+			tear: func(t *testing.T, path string, size, lastLen int64) {
+				t.Helper()
+				truncateFile(t, path, size-lastLen+segmentRecordHeaderLen/2)
+			},
+		},
+		{
+			name: "payload does not match its checksum",
+			tear: func(t *testing.T, path string, size, _ int64) {
+				t.Helper()
+				flipByte(t, path, size-1)
+			},
+		},
+		{
+			name: "length is out of range",
+			tear: func(t *testing.T, path string, size, lastLen int64) {
+				t.Helper()
+				flipByte(t, path, size-lastLen)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			log := openSegmentLog(t, dir)
+			appendLink(t, log, 100)
+			appendLink(t, log, 101)
+			sizeBeforeLast := log.activeSize
+			appendLink(t, log, 102)
+			path := log.segmentPath(log.activeBase)
+			size := log.activeSize
+			closeSegmentLog(t, log)
+
+			tt.tear(t, path, size, size-sizeBeforeLast)
+
+			recovered := openSegmentLog(t, dir)
+			if got := replayKeys(t, recovered); !slices.Equal(got, []int64{100, 101}) {
+				t.Fatalf("replayed %v after a torn write, want [100 101]", got)
+			}
+
+			offset := appendLink(t, recovered, 103)
+			if offset != 2 {
+				t.Errorf("appended at offset %d after recovery, want 2", offset)
+			}
+			closeSegmentLog(t, recovered)
+
+			// The record appended after recovery is only readable when the torn tail was cut off.
+			reopened := openSegmentLog(t, dir)
+			if got := replayKeys(t, reopened); !slices.Equal(got, []int64{100, 101, 103}) {
+				t.Errorf("replayed %v after reopening, want [100 101 103]", got)
+			}
+			closeSegmentLog(t, reopened)
+		})
+	}
+}
+
+func TestSegmentLogReplaysFromCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	log := openSegmentLog(t, dir)
+	for _, key := range []int64{100, 101, 102} {
+		appendLink(t, log, key)
+	}
+
+	// Offset 2 is committed out of order, the checkpoint only moves over the contiguous offsets 0 and 1.
+	if err := log.Commit(context.Background(), []uint64{0, 2}); err != nil {
+		t.Fatal(err)
+	}
+	closeSegmentLog(t, log)
+
+	reopened := openSegmentLog(t, dir)
+	if got := replayKeys(t, reopened); !slices.Equal(got, []int64{101, 102}) {
+		t.Errorf("replayed %v, want [101 102]", got)
+	}
+	closeSegmentLog(t, reopened)
+}
+
+func openSegmentLog(t *testing.T, dir string) *SegmentLog {
+	t.Helper()
+
+	log, err := NewSegmentLog(
+		context.Background(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		segmentLogConfig{Dir: dir, FsyncPolicy: string(FsyncAlways)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return log
+}
+
+func closeSegmentLog(t *testing.T, log *SegmentLog) {
+	t.Helper()
+
+	if err := log.active.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendLink(t *testing.T, log *SegmentLog, key int64) uint64 {
+	t.Helper()
+
+	offset, err := log.Append(context.Background(), core.LinkDTO{Key: core.LinkKeyDto{Value: key}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return offset
+}
+
+func replayKeys(t *testing.T, log *SegmentLog) []int64 {
+	t.Helper()
+
+	var keys []int64
+	err := log.Replay(context.Background(), func(_ uint64, link core.LinkDTO) error {
+		keys = append(keys, link.Key.Value)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+func truncateFile(t *testing.T, path string, size int64) {
+	t.Helper()
+
+	if err := os.Truncate(path, size); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func flipByte(t *testing.T, path string, at int64) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	b := make([]byte, 1)
+	if _, err = file.ReadAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xff
+	if _, err = file.WriteAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+}
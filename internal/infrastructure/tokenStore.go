@@ -0,0 +1,61 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+const linkKeyStoreModeNode = "node"
+
+// TokenStore is the key store selected by TokenStore.Mode.
+type TokenStore interface {
+	Issue(context.Context, core.LinkKeySeedDto) (*core.LinkKey, error)
+	IssueMany(context.Context, int) ([]core.LinkKey, error)
+	Health() error
+	RemainingByBand() map[string]int64
+}
+
+func NewTokenStore(
+	ctx context.Context,
+	logger *logger.AppLogger,
+	postgresClients Clients,
+	config tokenStoreConfig,
+) (TokenStore, error) {
+	if config.Mode == linkKeyStoreModeNode {
+		return NewNodeLinkKeyStore(ctx, logger, postgresClients.ShortorgClient, config.Node, config)
+	}
+
+	return NewLinkKeyStore(ctx, logger, postgresClients.TokenIdentifierClient, config)
+}
+
+// UsesIdentityDB is false in node mode, keys are then built without the identity db.
+func (c tokenStoreConfig) UsesIdentityDB() bool {
+	return c.Mode != linkKeyStoreModeNode
+}
+
+// issuedSlugLengths is the range of slug lengths the token store may have issued. Node mode follows the
+// sequence, whose keys stay in encoded_urls, so its range reaches from the sequence bands up to the node band.
+func (c tokenStoreConfig) issuedSlugLengths() (int, int, error) {
+	minSequence, maxSequence, err := c.sequenceSlugLengths()
+	if err != nil {
+		return 0, 0, fmt.Errorf("issuedSlugLengths: %w", err)
+	}
+	if c.Mode == linkKeyStoreModeNode {
+		return minSequence, max(maxSequence, c.Node.SlugLength), nil
+	}
+
+	return minSequence, maxSequence, nil
+}
+
+// sequenceSlugLengths is the range of slug lengths of the sequence bands, in any mode.
+func (c tokenStoreConfig) sequenceSlugLengths() (int, int, error) {
+	bands, err := newLinkKeyBands(c)
+	if err != nil {
+		return 0, 0, fmt.Errorf("sequenceSlugLengths: %w", err)
+	}
+
+	return bands[0].SlugLength, bands[len(bands)-1].SlugLength, nil
+}
@@ -0,0 +1,7 @@
+package manageLinkHosts
+
+type Config struct {
+	ReverifyIntervalSeconds int
+	// SuspendAfterFailures consecutive failed re-verifications suspend a verified host.
+	SuspendAfterFailures int
+}
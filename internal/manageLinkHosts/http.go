@@ -0,0 +1,260 @@
+package manageLinkHosts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+	"github.com/beard-programmer/shortorg/internal/httpEncoder"
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	errValidation     = errors.New("validation")
+	errNotFound       = errors.New("not found")
+	errInfrastructure = errors.New("infrastructure")
+	errApplication    = errors.New("application")
+)
+
+const maxOwnerSize = 64
+
+var ownerPattern = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+
+type registerAPIRequest struct {
+	Owner string `json:"owner"`
+}
+
+type linkHostAPIResponse struct {
+	Hostname     string                  `json:"hostname"`
+	Owner        string                  `json:"owner"`
+	Status       string                  `json:"status"`
+	Verification verificationAPIResponse `json:"verification"`
+	CreatedAt    time.Time               `json:"createdAt"`
+}
+
+// verificationAPIResponse tells how to prove ownership: serve ChallengeToken at HTTPPath over https,
+// or publish a TXT record DNSRecord holding DNSValue.
+type verificationAPIResponse struct {
+	ChallengeToken string     `json:"challengeToken"`
+	HTTPPath       string     `json:"httpPath"`
+	DNSRecord      string     `json:"dnsRecord"`
+	DNSValue       string     `json:"dnsValue"`
+	Method         string     `json:"method,omitempty"`
+	VerifiedAt     *time.Time `json:"verifiedAt,omitempty"`
+	CheckedAt      *time.Time `json:"checkedAt,omitempty"`
+	FailedChecks   int        `json:"failedChecks"`
+	LastError      string     `json:"lastError,omitempty"`
+}
+
+type apiErrResponse struct {
+	httpStatusCode int
+	Code           string `json:"code"`
+	Message        string `json:"message"`
+}
+
+func newLinkHostAPIResponse(host core.BrandedHostDto) linkHostAPIResponse {
+	return linkHostAPIResponse{
+		Hostname: host.Hostname,
+		Owner:    host.Owner,
+		Status:   host.Status,
+		Verification: verificationAPIResponse{
+			ChallengeToken: host.ChallengeToken,
+			HTTPPath:       core.LinkHostVerificationPath,
+			DNSRecord:      core.LinkHostVerificationRecord(host.Hostname),
+			DNSValue:       core.LinkHostVerificationValue(host.ChallengeToken),
+			Method:         host.VerificationMethod,
+			VerifiedAt:     host.VerifiedAt,
+			CheckedAt:      host.CheckedAt,
+			FailedChecks:   host.FailedChecks,
+			LastError:      host.LastError,
+		},
+		CreatedAt: host.CreatedAt,
+	}
+}
+
+func ListHTTPHandlerFunc(logger *appLogger.AppLogger, registry LinkHostRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hosts, err := registry.List(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "manageLinkHosts: failed to list hosts", "err", err)
+			handleError(w, r, fmt.Errorf("%w: list: %v", errInfrastructure, err))
+
+			return
+		}
+
+		response := make([]linkHostAPIResponse, 0, len(hosts))
+		for _, host := range hosts {
+			response = append(response, newLinkHostAPIResponse(host))
+		}
+		httpEncoder.EncodeResponse(w, r, http.StatusOK, response)
+	}
+}
+
+func GetHTTPHandlerFunc(logger *appLogger.AppLogger, registry LinkHostRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hostname, err := core.NewBrandedHostname(chi.URLParam(r, "hostname"))
+		if err != nil {
+			handleError(w, r, fmt.Errorf("%w: get: %v", errValidation, err))
+
+			return
+		}
+
+		host, isFound, err := registry.Find(r.Context(), hostname)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "manageLinkHosts: failed to find host", "err", err)
+			handleError(w, r, fmt.Errorf("%w: get: %v", errInfrastructure, err))
+
+			return
+		}
+		if !isFound {
+			handleError(w, r, fmt.Errorf("%w: get: host %s is not registered", errNotFound, hostname))
+
+			return
+		}
+
+		httpEncoder.EncodeResponse(w, r, http.StatusOK, newLinkHostAPIResponse(*host))
+	}
+}
+
+// PutHTTPHandlerFunc registers the host as pending with a new challenge token, or updates its owner when it is
+// registered already.
+func PutHTTPHandlerFunc(logger *appLogger.AppLogger, registry LinkHostRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hostname, err := core.NewBrandedHostname(chi.URLParam(r, "hostname"))
+		if err != nil {
+			handleError(w, r, fmt.Errorf("%w: put: %v", errValidation, err))
+
+			return
+		}
+
+		var apiRequest registerAPIRequest
+		if r.ContentLength != 0 {
+			apiRequest, err = httpEncoder.DecodeRequest[registerAPIRequest](r)
+			if err != nil {
+				handleError(w, r, fmt.Errorf("%w: put: invalid request body", errValidation))
+
+				return
+			}
+		}
+		if maxOwnerSize < len(apiRequest.Owner) || !ownerPattern.MatchString(apiRequest.Owner) {
+			handleError(w, r, fmt.Errorf(
+				"%w: put: owner must be up to %d latin letters, digits, dots, dashes and underscores",
+				errValidation,
+				maxOwnerSize,
+			))
+
+			return
+		}
+
+		challengeToken, err := newChallengeToken()
+		if err != nil {
+			handleError(w, r, fmt.Errorf("%w: put: %v", errApplication, err))
+
+			return
+		}
+
+		host, isAdded, err := registry.Register(
+			r.Context(),
+			core.BrandedHostDto{Hostname: hostname, Owner: apiRequest.Owner, ChallengeToken: challengeToken},
+		)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "manageLinkHosts: failed to register host", "err", err)
+			handleError(w, r, fmt.Errorf("%w: put: %v", errInfrastructure, err))
+
+			return
+		}
+
+		status := http.StatusOK
+		if isAdded {
+			logger.InfoContext(r.Context(), "branded link host registered", "hostname", hostname, "owner", host.Owner)
+			status = http.StatusCreated
+		}
+		httpEncoder.EncodeResponse(w, r, status, newLinkHostAPIResponse(*host))
+	}
+}
+
+// VerifyHTTPHandlerFunc checks the ownership right away instead of waiting for the next re-verification,
+// the outcome is in the status and verification of the host.
+func VerifyHTTPHandlerFunc(logger *appLogger.AppLogger, verifyFn VerifyFn) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hostname, err := core.NewBrandedHostname(chi.URLParam(r, "hostname"))
+		if err != nil {
+			handleError(w, r, fmt.Errorf("%w: verify: %v", errValidation, err))
+
+			return
+		}
+
+		host, isFound, err := verifyFn(r.Context(), hostname)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "manageLinkHosts: failed to verify host", "err", err)
+			handleError(w, r, err)
+
+			return
+		}
+		if !isFound {
+			handleError(w, r, fmt.Errorf("%w: verify: host %s is not registered", errNotFound, hostname))
+
+			return
+		}
+
+		httpEncoder.EncodeResponse(w, r, http.StatusOK, newLinkHostAPIResponse(*host))
+	}
+}
+
+func DeleteHTTPHandlerFunc(logger *appLogger.AppLogger, registry LinkHostRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hostname, err := core.NewBrandedHostname(chi.URLParam(r, "hostname"))
+		if err != nil {
+			handleError(w, r, fmt.Errorf("%w: delete: %v", errValidation, err))
+
+			return
+		}
+
+		isRemoved, err := registry.Remove(r.Context(), hostname)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "manageLinkHosts: failed to remove host", "err", err)
+			handleError(w, r, fmt.Errorf("%w: delete: %v", errInfrastructure, err))
+
+			return
+		}
+		if !isRemoved {
+			handleError(w, r, fmt.Errorf("%w: delete: host %s is not registered", errNotFound, hostname))
+
+			return
+		}
+
+		logger.InfoContext(r.Context(), "branded link host removed", "hostname", hostname)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr apiErrResponse
+
+	switch {
+	case errors.Is(err, errValidation):
+		apiErr = apiErrResponse{Code: "ValidationError", Message: err.Error(), httpStatusCode: http.StatusBadRequest}
+	case errors.Is(err, errNotFound):
+		apiErr = apiErrResponse{Code: "NotFoundError", Message: err.Error(), httpStatusCode: http.StatusNotFound}
+	case errors.Is(err, errInfrastructure):
+		apiErr = apiErrResponse{
+			Code:           "InfrastructureError",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusServiceUnavailable,
+		}
+	case errors.Is(err, errApplication):
+		apiErr = apiErrResponse{
+			Code:           "ApplicationError",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusInternalServerError,
+		}
+	default:
+		apiErr = apiErrResponse{Code: "UnknownError", Message: err.Error(), httpStatusCode: http.StatusInternalServerError}
+	}
+
+	httpEncoder.EncodeResponse(w, r, apiErr.httpStatusCode, apiErr)
+}
@@ -0,0 +1,20 @@
+package manageLinkHosts
+
+import (
+	"context"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+type LinkHostRegistry interface {
+	List(context.Context) ([]core.BrandedHostDto, error)
+	Find(context.Context, string) (*core.BrandedHostDto, bool, error)
+	Register(context.Context, core.BrandedHostDto) (*core.BrandedHostDto, bool, error)
+	SaveCheck(context.Context, core.BrandedHostDto) (bool, error)
+	Remove(context.Context, string) (bool, error)
+}
+
+// OwnershipVerifier answers with the method that found the challenge token on the host.
+type OwnershipVerifier interface {
+	Verify(ctx context.Context, hostname string, challengeToken string) (string, error)
+}
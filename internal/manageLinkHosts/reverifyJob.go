@@ -0,0 +1,76 @@
+package manageLinkHosts
+
+import (
+	"context"
+	"time"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// ReverifyJob checks every registered host each ReverifyIntervalSeconds: pending hosts get verified as soon as
+// the token shows up, verified hosts are suspended once they keep failing and suspended ones come back.
+type ReverifyJob = func(ctx context.Context) <-chan error
+
+func NewReverifyJob(
+	logger *appLogger.AppLogger,
+	registry LinkHostRegistry,
+	verifier OwnershipVerifier,
+	config Config,
+) ReverifyJob {
+	interval := time.Duration(config.ReverifyIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultReverifyEvery
+	}
+
+	return func(ctx context.Context) <-chan error {
+		errChan := make(chan error, 1)
+
+		reportErr := func(err error) {
+			select {
+			case errChan <- err:
+			default:
+				logger.ErrorContext(ctx, "Error channel full, error discarded", "err", err)
+			}
+		}
+
+		go func() {
+			defer close(errChan)
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					hosts, err := registry.List(ctx)
+					if err != nil {
+						reportErr(err)
+
+						continue
+					}
+					for _, host := range hosts {
+						if ctx.Err() != nil {
+							return
+						}
+						if !isDue(host, interval) {
+							continue
+						}
+						if _, _, err = checkHost(ctx, logger, registry, verifier, config, host); err != nil {
+							reportErr(err)
+						}
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		return errChan
+	}
+}
+
+// isDue skips hosts that were checked within the interval already, e.g. through the verify endpoint.
+func isDue(host core.BrandedHostDto, interval time.Duration) bool {
+	return host.CheckedAt == nil || interval/2 <= time.Since(*host.CheckedAt)
+}
@@ -0,0 +1,126 @@
+package manageLinkHosts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// VerifyFn checks the ownership of a registered host right away, it is false when the host is not registered.
+type VerifyFn = func(ctx context.Context, hostname string) (*core.BrandedHostDto, bool, error)
+
+const (
+	challengeTokenSize   = 16
+	maxLastErrorSize     = 512
+	defaultSuspendAfter  = 3
+	defaultReverifyEvery = time.Hour
+)
+
+func NewVerifyFn(
+	logger *appLogger.AppLogger,
+	registry LinkHostRegistry,
+	verifier OwnershipVerifier,
+	config Config,
+) VerifyFn {
+	return func(ctx context.Context, hostname string) (*core.BrandedHostDto, bool, error) {
+		host, isFound, err := registry.Find(ctx, hostname)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: verify: %v", errInfrastructure, err)
+		}
+		if !isFound {
+			return nil, false, nil
+		}
+
+		return checkHost(ctx, logger, registry, verifier, config, *host)
+	}
+}
+
+func checkHost(
+	ctx context.Context,
+	logger *appLogger.AppLogger,
+	registry LinkHostRegistry,
+	verifier OwnershipVerifier,
+	config Config,
+	host core.BrandedHostDto,
+) (*core.BrandedHostDto, bool, error) {
+	method, verifyErr := verifier.Verify(ctx, host.Hostname, host.ChallengeToken)
+	checked := withCheck(host, method, verifyErr, time.Now().UTC(), suspendAfter(config))
+
+	isSaved, err := registry.SaveCheck(ctx, checked)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: verify: %v", errInfrastructure, err)
+	}
+	if !isSaved {
+		return nil, false, nil
+	}
+
+	switch {
+	case host.Status != core.BrandedHostVerified && checked.Status == core.BrandedHostVerified:
+		logger.InfoContext(ctx, "branded link host verified", "hostname", host.Hostname, "method", method)
+	case host.Status == core.BrandedHostVerified && checked.Status == core.BrandedHostSuspended:
+		logger.WarnContext(
+			ctx,
+			"branded link host suspended",
+			"hostname", host.Hostname,
+			"failedChecks", checked.FailedChecks,
+			"err", verifyErr,
+		)
+	}
+
+	return &checked, true, nil
+}
+
+// withCheck applies a check to the host: a passed check verifies it, also a suspended one, and failed checks
+// suspend a verified host once suspendAfter of them came in a row. A pending host stays pending.
+func withCheck(
+	host core.BrandedHostDto,
+	method string,
+	verifyErr error,
+	checkedAt time.Time,
+	suspendAfter int,
+) core.BrandedHostDto {
+	host.CheckedAt = &checkedAt
+
+	if verifyErr == nil {
+		host.Status = core.BrandedHostVerified
+		host.VerificationMethod = method
+		host.VerifiedAt = &checkedAt
+		host.FailedChecks = 0
+		host.LastError = ""
+
+		return host
+	}
+
+	host.FailedChecks++
+	host.LastError = verifyErr.Error()
+	if len(host.LastError) > maxLastErrorSize {
+		host.LastError = host.LastError[:maxLastErrorSize]
+	}
+	if host.Status == core.BrandedHostVerified && suspendAfter <= host.FailedChecks {
+		host.Status = core.BrandedHostSuspended
+	}
+
+	return host
+}
+
+func suspendAfter(config Config) int {
+	if config.SuspendAfterFailures <= 0 {
+		return defaultSuspendAfter
+	}
+
+	return config.SuspendAfterFailures
+}
+
+func newChallengeToken() (string, error) {
+	token := make([]byte, challengeTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("newChallengeToken: %w", err)
+	}
+
+	return hex.EncodeToString(token), nil
+}
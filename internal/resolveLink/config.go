@@ -0,0 +1,12 @@
+package resolveLink
+
+type Config struct {
+	DefaultRedirectStatus int
+	HostRedirectStatus    map[string]int
+	// ExpiredFallbackURL is where expired links redirect to instead of answering 410, when it is set.
+	ExpiredFallbackURL string
+	// UnlockCookieSecret signs the cookies of unlocked password protected links, a random one is used when it is
+	// empty. UnlockCookieTTLSeconds is how long the password is not asked again.
+	UnlockCookieSecret     string
+	UnlockCookieTTLSeconds int
+}
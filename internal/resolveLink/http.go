@@ -3,20 +3,43 @@ package resolveLink
 import (
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
 	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
 	"github.com/beard-programmer/shortorg/internal/httpEncoder"
 )
 
 type requestHTTP struct {
-	URL string `json:"shortUrl"`
+	URL           string  `json:"shortUrl"`
+	PasswordValue *string `json:"password"`
+	clientIP      string
 }
 
 func (r requestHTTP) Url() string {
 	return r.URL
 }
 
+// IsClick is always true, the api answers with the destination, so it would otherwise get around click caps.
+func (r requestHTTP) IsClick() bool {
+	return true
+}
+
+func (r requestHTTP) Password() *string {
+	return r.PasswordValue
+}
+
+// UnlockToken is never set, the api is given the password with every request.
+func (r requestHTTP) UnlockToken() string {
+	return ""
+}
+
+func (r requestHTTP) ClientIP() string {
+	return r.clientIP
+}
+
 type responseHTTP struct {
 	OriginalURL string `json:"url"`
 	ShortURL    string `json:"shortUrl"`
@@ -39,6 +62,7 @@ func HTTPHandlerFunc(
 
 			return
 		}
+		apiRequest.clientIP = clientIP(request)
 
 		urlWasDecoded, found, err := resolveLinkFn(request.Context(), apiRequest)
 
@@ -58,7 +82,7 @@ func HTTPHandlerFunc(
 			ShortURL: fmt.Sprintf(
 				"https://%s/%s",
 				urlWasDecoded.NonBrandedLink.Host.Hostname(),
-				urlWasDecoded.NonBrandedLink.Slug.Value(),
+				urlWasDecoded.NonBrandedLink.ShortPath(),
 			),
 		}
 		httpEncoder.EncodeResponse(writer, request, http.StatusOK, response)
@@ -71,6 +95,24 @@ func handleError(w http.ResponseWriter, r *http.Request, err error) {
 	switch {
 	case errors.Is(err, errValidation):
 		apiErr = responseErrHTTP{Code: "ErrorValidation", Message: err.Error(), httpStatusCode: http.StatusBadRequest}
+	case errors.Is(err, errGone):
+		apiErr = responseErrHTTP{Code: "ErrorLinkGone", Message: err.Error(), httpStatusCode: http.StatusGone}
+	case errors.Is(err, errNotYetActive):
+		apiErr = responseErrHTTP{Code: "ErrorLinkNotActive", Message: err.Error(), httpStatusCode: http.StatusNotFound}
+	case errors.Is(err, errPasswordRequired):
+		apiErr = responseErrHTTP{
+			Code:           "ErrorPasswordRequired",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusUnauthorized,
+		}
+	case errors.Is(err, errWrongPassword):
+		apiErr = responseErrHTTP{Code: "ErrorWrongPassword", Message: err.Error(), httpStatusCode: http.StatusUnauthorized}
+	case errors.Is(err, errTooManyAttempts):
+		apiErr = responseErrHTTP{
+			Code:           "ErrorTooManyAttempts",
+			Message:        err.Error(),
+			httpStatusCode: http.StatusTooManyRequests,
+		}
 	case errors.Is(err, errApplication):
 		apiErr = responseErrHTTP{
 			Code:           "ErrorApplication",
@@ -91,5 +133,23 @@ func handleError(w http.ResponseWriter, r *http.Request, err error) {
 		}
 	}
 
+	setRetryAfter(w, err)
 	httpEncoder.EncodeResponse(w, r, apiErr.httpStatusCode, apiErr)
 }
+
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var tooManyAttemptsErr tooManyAttemptsError
+	if errors.As(err, &tooManyAttemptsErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyAttemptsErr.retryAfter.Seconds()))))
+	}
+}
+
+// clientIP is the address the trusted proxies left in RemoteAddr, without its port.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return host
+}
@@ -3,6 +3,7 @@ package resolveLink
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/beard-programmer/shortorg/internal/core"
 )
@@ -10,7 +11,28 @@ import (
 var ErrLinkNotFound = errors.New("link not found")
 
 type LinksStore interface {
-	FindOneNonBrandedLink(context.Context, core.LinkSlugDto, core.LinkKeyDto, core.LinkHostDto) (*core.LinkDTO, bool, error)
+	FindOneLink(context.Context, core.LinkSlugDto, core.LinkKeyDto, core.LinkHostDto) (*core.LinkDTO, bool, error)
+}
+
+type LinkAliasStore interface {
+	FindKey(context.Context, core.LinkHostDto, core.LinkAliasDto) (*core.LinkKeyDto, bool, error)
+}
+
+type PendingLinks interface {
+	FindOne(core.LinkKeyDto) (*core.LinkDTO, bool)
+}
+
+// ClickCounter keeps count of clicks on links with a click cap.
+type ClickCounter interface {
+	CountClick(ctx context.Context, key core.LinkKeyDto, maxClicks int64) (bool, error)
+	IsCapReached(ctx context.Context, key core.LinkKeyDto, maxClicks int64) (bool, error)
+}
+
+// PasswordAttempts limits password attempts per link and per client ip. Reserve tells how long to wait
+// when either is used up, Refund gives back the attempt of a right password.
+type PasswordAttempts interface {
+	Reserve(ctx context.Context, key core.LinkKeyDto, clientIP string) (time.Duration, bool, error)
+	Refund(ctx context.Context, key core.LinkKeyDto, clientIP string)
 }
 
 type EncodedUrlDto interface {
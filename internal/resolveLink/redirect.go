@@ -0,0 +1,228 @@
+package resolveLink
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+
+	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	unlockCookieName = "shortorg_unlock"
+	// maxPasswordFormSize is plenty for a password of up to 72 bytes, url encoded.
+	maxPasswordFormSize = 1 << 10
+)
+
+type redirectRequest struct {
+	host string
+	slug string
+	// isClick is false for HEAD requests, e.g. link previews, and for the password form being submitted.
+	isClick     bool
+	password    *string
+	unlockToken string
+	clientIP    string
+}
+
+func (r redirectRequest) Url() string {
+	return fmt.Sprintf("https://%s/%s", r.host, r.slug)
+}
+
+func (r redirectRequest) IsClick() bool {
+	return r.isClick
+}
+
+func (r redirectRequest) Password() *string {
+	return r.password
+}
+
+func (r redirectRequest) UnlockToken() string {
+	return r.unlockToken
+}
+
+func (r redirectRequest) ClientIP() string {
+	return r.clientIP
+}
+
+// newRedirectRequest reads the password from the submitted form, a form that can not be read has none.
+func newRedirectRequest(writer http.ResponseWriter, request *http.Request) redirectRequest {
+	host, _, err := net.SplitHostPort(request.Host)
+	if err != nil {
+		host = request.Host
+	}
+
+	redirect := redirectRequest{
+		host:     host,
+		slug:     chi.URLParam(request, "slug"),
+		isClick:  request.Method == http.MethodGet,
+		clientIP: clientIP(request),
+	}
+
+	if cookie, cookieErr := request.Cookie(unlockCookieName); cookieErr == nil {
+		redirect.unlockToken = cookie.Value
+	}
+
+	if request.Method == http.MethodPost {
+		request.Body = http.MaxBytesReader(writer, request.Body, maxPasswordFormSize)
+		if request.ParseForm() == nil && request.PostForm.Has("password") {
+			password := request.PostForm.Get("password")
+			redirect.password = &password
+		}
+	}
+
+	return redirect
+}
+
+var redirectErrorPage = template.Must(
+	template.New("redirectError").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+</body>
+</html>
+`),
+)
+
+type redirectErrorPageData struct {
+	Status  int
+	Title   string
+	Message string
+}
+
+var passwordFormPage = template.Must(
+	template.New("passwordForm").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Password required</title></head>
+<body>
+<h1>Password required</h1>
+<p>This short link is protected by a password.</p>
+{{if .Message}}<p role="alert">{{.Message}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`),
+)
+
+type passwordFormPageData struct {
+	Action  string
+	Message string
+}
+
+func RedirectHTTPHandlerFunc(
+	logger *appLogger.AppLogger,
+	resolveLinkFn ResolveLinkFn,
+	redirectPolicy RedirectPolicy,
+) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		urlWasDecoded, found, err := resolveLinkFn(request.Context(), newRedirectRequest(writer, request))
+
+		switch {
+		case errors.Is(err, errValidation):
+			handleRedirectError(writer, http.StatusNotFound, "This short link does not exist.")
+
+			return
+		case errors.Is(err, errGone):
+			writer.Header().Set("Cache-Control", "no-store")
+			if fallbackURL, isSet := redirectPolicy.ExpiredFallbackURL(); isSet {
+				http.Redirect(writer, request, fallbackURL, http.StatusFound)
+
+				return
+			}
+			handleRedirectError(writer, http.StatusGone, "This short link has expired.")
+
+			return
+		case errors.Is(err, errNotYetActive):
+			writer.Header().Set("Cache-Control", "no-store")
+			handleRedirectError(writer, http.StatusNotFound, "This short link is not active yet.")
+
+			return
+		case errors.Is(err, errPasswordRequired):
+			if request.Method == http.MethodPost {
+				handlePasswordForm(writer, request, http.StatusUnauthorized, "Please enter the password.")
+
+				return
+			}
+			handlePasswordForm(writer, request, http.StatusOK, "")
+
+			return
+		case errors.Is(err, errWrongPassword):
+			handlePasswordForm(writer, request, http.StatusUnauthorized, "The password is wrong.")
+
+			return
+		case errors.Is(err, errTooManyAttempts):
+			setRetryAfter(writer, err)
+			handlePasswordForm(writer, request, http.StatusTooManyRequests, "Too many wrong passwords, try again later.")
+
+			return
+		case errors.Is(err, errInfrastructure):
+			logger.ErrorContext(request.Context(), "redirect: failed to resolve link", "err", err)
+			handleRedirectError(writer, http.StatusServiceUnavailable, "Please try again in a moment.")
+
+			return
+		case err != nil:
+			logger.ErrorContext(request.Context(), "redirect: failed to resolve link", "err", err)
+			handleRedirectError(writer, http.StatusInternalServerError, "Something went wrong.")
+
+			return
+		case !found:
+			handleRedirectError(writer, http.StatusNotFound, "This short link does not exist.")
+
+			return
+		}
+
+		link := urlWasDecoded.NonBrandedLink
+		// Browsers would keep following a cached redirect past the end of its lifetime, even a 301,
+		// and past the password of a protected link.
+		if link.Lifetime != nil || link.Password != nil {
+			writer.Header().Set("Cache-Control", "no-store")
+		}
+		if urlWasDecoded.UnlockToken != nil {
+			setUnlockCookie(writer, request, *urlWasDecoded.UnlockToken)
+		}
+		// The submitted form goes back to the link, which then counts as the click.
+		if request.Method == http.MethodPost {
+			http.Redirect(writer, request, request.URL.Path, http.StatusSeeOther)
+
+			return
+		}
+		http.Redirect(writer, request, link.DestinationURL.String(), redirectPolicy.StatusFor(link))
+	}
+}
+
+// setUnlockCookie scopes the cookie to the link's path, it unlocks no other link.
+func setUnlockCookie(w http.ResponseWriter, r *http.Request, token unlockToken) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookieName,
+		Value:    token.Value,
+		Path:     r.URL.Path,
+		Expires:  token.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func handlePasswordForm(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = passwordFormPage.Execute(w, passwordFormPageData{Action: r.URL.Path, Message: message})
+}
+
+func handleRedirectError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = redirectErrorPage.Execute(
+		w,
+		redirectErrorPageData{Status: status, Title: http.StatusText(status), Message: message},
+	)
+}
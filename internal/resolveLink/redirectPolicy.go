@@ -0,0 +1,73 @@
+package resolveLink
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+// RedirectPolicy picks the redirect status for a resolved link:
+// the link's own status wins, then the status configured for its host, then the default.
+// Expired links go to expiredFallbackURL when it is set.
+type RedirectPolicy struct {
+	defaultStatus      core.RedirectStatus
+	hostStatus         map[string]core.RedirectStatus
+	expiredFallbackURL *core.URL
+}
+
+func NewRedirectPolicy(cfg Config) (*RedirectPolicy, error) {
+	defaultStatusValue := cfg.DefaultRedirectStatus
+	if defaultStatusValue == 0 {
+		defaultStatusValue = http.StatusFound
+	}
+
+	defaultStatus, err := core.NewRedirectStatus(defaultStatusValue)
+	if err != nil {
+		return nil, fmt.Errorf("NewRedirectPolicy: invalid default redirect status: %w", err)
+	}
+
+	hostStatus := make(map[string]core.RedirectStatus, len(cfg.HostRedirectStatus))
+	for host, value := range cfg.HostRedirectStatus {
+		status, statusErr := core.NewRedirectStatus(value)
+		if statusErr != nil {
+			return nil, fmt.Errorf("NewRedirectPolicy: invalid redirect status for host %s: %w", host, statusErr)
+		}
+		hostStatus[strings.ToLower(host)] = *status
+	}
+
+	var expiredFallbackURL *core.URL
+	if cfg.ExpiredFallbackURL != "" {
+		expiredFallbackURL, err = core.NewURL(cfg.ExpiredFallbackURL)
+		if err != nil {
+			return nil, fmt.Errorf("NewRedirectPolicy: invalid expired fallback url: %w", err)
+		}
+	}
+
+	return &RedirectPolicy{
+		defaultStatus:      *defaultStatus,
+		hostStatus:         hostStatus,
+		expiredFallbackURL: expiredFallbackURL,
+	}, nil
+}
+
+func (p RedirectPolicy) StatusFor(link core.Link) int {
+	if link.RedirectStatus != nil {
+		return link.RedirectStatus.Value()
+	}
+
+	if status, ok := p.hostStatus[link.Host.Hostname()]; ok {
+		return status.Value()
+	}
+
+	return p.defaultStatus.Value()
+}
+
+func (p RedirectPolicy) ExpiredFallbackURL() (string, bool) {
+	if p.expiredFallbackURL == nil {
+		return "", false
+	}
+
+	return p.expiredFallbackURL.String(), true
+}
@@ -1,19 +1,32 @@
 package resolveLink
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/beard-programmer/shortorg/internal/core"
 )
 
 type resolveLinkRequest interface {
 	Url() string
+	// IsClick is true when the link is followed, only clicks count towards a click cap.
+	IsClick() bool
+	// Password is nil when none was given, UnlockToken is empty when the link was not unlocked before.
+	Password() *string
+	UnlockToken() string
+	// ClientIP is who password attempts are counted against.
+	ClientIP() string
 }
 
 type validatedRequest struct {
 	ShortURL shortUrl
 }
 
-func newValidatedRequest(request resolveLinkRequest) (*validatedRequest, error) {
-	shortURL, err := newShortUrl(request.Url())
+func newValidatedRequest(
+	request resolveLinkRequest,
+	linkHostRegistry core.LinkHostRegistry,
+) (*validatedRequest, error) {
+	shortURL, err := newShortUrl(request.Url(), linkHostRegistry)
 	if err != nil {
 		return nil, err
 	}
@@ -22,24 +35,36 @@ func newValidatedRequest(request resolveLinkRequest) (*validatedRequest, error)
 
 }
 
+// shortUrl points either at a generated slug or at a custom alias, never both.
 type shortUrl struct {
-	linkSlug core.LinkSlug
-	linkHost core.LinkHost
+	linkSlug  *core.LinkSlug
+	linkAlias *core.LinkAlias
+	linkHost  core.LinkHost
 }
 
-func newShortUrl(url string) (*shortUrl, error) {
+func newShortUrl(url string, linkHostRegistry core.LinkHostRegistry) (*shortUrl, error) {
 	uri, err := core.NewURL(url)
-	hostname := uri.Hostname()
-	tokenHost, err := core.NewLinkHost(&hostname)
 	if err != nil {
 		return nil, err
 	}
 
-	encodedKey, err := core.NewLinkSlug(uri.Path()[1:])
+	hostname := uri.Hostname()
+	tokenHost, err := core.NewLinkHost(&hostname, linkHostRegistry)
 	if err != nil {
 		return nil, err
 	}
 
-	return &shortUrl{linkSlug: *encodedKey, linkHost: *tokenHost}, nil
+	path := strings.TrimPrefix(uri.Path(), "/")
+	encodedKey, err := core.NewLinkSlug(path)
+	if err == nil {
+		return &shortUrl{linkSlug: encodedKey, linkHost: *tokenHost}, nil
+	}
+
+	linkAlias, aliasErr := core.NewLinkAlias(path)
+	if aliasErr != nil {
+		return nil, errors.Join(err, aliasErr)
+	}
+
+	return &shortUrl{linkAlias: linkAlias, linkHost: *tokenHost}, nil
 
 }
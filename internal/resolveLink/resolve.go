@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	appLogger "github.com/beard-programmer/shortorg/internal/app/logger"
 	"github.com/beard-programmer/shortorg/internal/core"
@@ -11,49 +12,225 @@ import (
 
 type linkWasResolvedEvent struct {
 	NonBrandedLink core.Link
+	// UnlockToken is set when the request unlocked a password protected link with its password.
+	UnlockToken *unlockToken
+}
+
+// tooManyAttemptsError is a password attempt refused before the password was checked.
+type tooManyAttemptsError struct {
+	retryAfter time.Duration
+}
+
+func (e tooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", errTooManyAttempts, e.retryAfter)
+}
+
+func (e tooManyAttemptsError) Unwrap() error {
+	return errTooManyAttempts
 }
 
 var (
 	errValidation     = errors.New("validation")
 	errInfrastructure = errors.New("infrastructure")
 	errApplication    = errors.New("application")
+	// errGone is a link that expired or ran out of clicks, errNotYetActive one that redirects from NotBefore on.
+	errGone         = errors.New("link is gone")
+	errNotYetActive = errors.New("link is not active yet")
+	// errPasswordRequired is a password protected link asked for without its password.
+	errPasswordRequired = errors.New("password required")
+	errWrongPassword    = errors.New("wrong password")
+	errTooManyAttempts  = errors.New("too many password attempts")
 )
 
 type ResolveLinkFn = func(context.Context, resolveLinkRequest) (*linkWasResolvedEvent, bool, error)
 
-func NewResolveLinkFn(logger *appLogger.AppLogger, encodedUrlsProvider LinksStore) ResolveLinkFn {
+func NewResolveLinkFn(
+	logger *appLogger.AppLogger,
+	linkKeyCodec core.LinkKeyCodec,
+	linkHostRegistry core.LinkHostRegistry,
+	pendingLinks PendingLinks,
+	linkAliasStore LinkAliasStore,
+	encodedUrlsProvider LinksStore,
+	clickCounter ClickCounter,
+	passwordAttempts PasswordAttempts,
+	unlockTokens UnlockTokenSigner,
+) ResolveLinkFn {
 	return func(ctx context.Context, r resolveLinkRequest) (*linkWasResolvedEvent, bool, error) {
-		return resolveLink(ctx, logger, encodedUrlsProvider, r)
+		event, isFound, err := resolveLink(
+			ctx,
+			logger,
+			linkKeyCodec,
+			linkHostRegistry,
+			pendingLinks,
+			linkAliasStore,
+			encodedUrlsProvider,
+			r,
+		)
+		if err != nil || !isFound {
+			return event, isFound, err
+		}
+
+		now := time.Now()
+		if err = checkLifetimeState(event.NonBrandedLink, now); err != nil {
+			return nil, false, err
+		}
+
+		event.UnlockToken, err = checkPassword(ctx, passwordAttempts, unlockTokens, event.NonBrandedLink, r, now)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err = countClick(ctx, clickCounter, event.NonBrandedLink, r.IsClick()); err != nil {
+			return nil, false, err
+		}
+
+		return event, true, nil
+	}
+}
+
+func checkLifetimeState(link core.Link, now time.Time) error {
+	switch link.Lifetime.StateAt(now) {
+	case core.LinkExpired:
+		return fmt.Errorf("%w: expired", errGone)
+	case core.LinkNotYetActive:
+		return fmt.Errorf("%w: redirects from %s on", errNotYetActive, link.Lifetime.NotBefore().Format(time.RFC3339))
+	case core.LinkActive:
+	}
+
+	return nil
+}
+
+// checkPassword lets a protected link through with a valid unlock token or its password, a right password
+// also gets a token. Attempts are reserved before the password is hashed, so refused guesses cost nothing.
+func checkPassword(
+	ctx context.Context,
+	passwordAttempts PasswordAttempts,
+	unlockTokens UnlockTokenSigner,
+	link core.Link,
+	request resolveLinkRequest,
+	now time.Time,
+) (*unlockToken, error) {
+	if link.Password == nil {
+		return nil, nil //nolint:nilnil // links without a password need no token
+	}
+	if request.UnlockToken() != "" && unlockTokens.IsValid(link.Key, request.UnlockToken(), now) {
+		return nil, nil //nolint:nilnil // the link stays unlocked with the token it has
+	}
+	if request.Password() == nil {
+		return nil, errPasswordRequired
+	}
+
+	retryAfter, isReserved, err := passwordAttempts.Reserve(ctx, link.Key.IntoDto(), request.ClientIP())
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to reserve password attempt: %v", errInfrastructure, err)
 	}
+	if !isReserved {
+		return nil, tooManyAttemptsError{retryAfter: retryAfter}
+	}
+	if !link.Password.Matches(*request.Password()) {
+		return nil, errWrongPassword
+	}
+	passwordAttempts.Refund(ctx, link.Key.IntoDto(), request.ClientIP())
+
+	token := unlockTokens.Issue(link.Key, now)
+
+	return &token, nil
+}
+
+// countClick counts the click of a link with a click cap, a link that is only looked at is not counted.
+func countClick(
+	ctx context.Context,
+	clickCounter ClickCounter,
+	link core.Link,
+	isClick bool,
+) error {
+	if link.Lifetime == nil || link.Lifetime.MaxClicks() == nil {
+		return nil
+	}
+
+	maxClicks := *link.Lifetime.MaxClicks()
+	if isClick {
+		isCounted, err := clickCounter.CountClick(ctx, link.Key.IntoDto(), maxClicks)
+		if err != nil {
+			return fmt.Errorf("%w: failed to count click: %v", errInfrastructure, err)
+		}
+		if !isCounted {
+			return fmt.Errorf("%w: out of clicks", errGone)
+		}
+
+		return nil
+	}
+
+	isCapReached, err := clickCounter.IsCapReached(ctx, link.Key.IntoDto(), maxClicks)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read clicks: %v", errInfrastructure, err)
+	}
+	if isCapReached {
+		return fmt.Errorf("%w: out of clicks", errGone)
+	}
+
+	return nil
 }
 
 func resolveLink(
 	ctx context.Context,
 	l *appLogger.AppLogger,
+	linkKeyCodec core.LinkKeyCodec,
+	linkHostRegistry core.LinkHostRegistry,
+	pendingLinks PendingLinks,
+	linkAliasStore LinkAliasStore,
 	linksStore LinksStore,
 	request resolveLinkRequest,
 ) (*linkWasResolvedEvent, bool, error) {
-	validatedRequest, err := newValidatedRequest(request)
+	validatedRequest, err := newValidatedRequest(request, linkHostRegistry)
 	if err != nil {
-		return nil, false, err // validation
+		return nil, false, fmt.Errorf("%w: invalid short url: %v", errValidation, err)
 	}
 
 	shortURL := validatedRequest.ShortURL
 
-	tokenKey, err := shortURL.linkSlug.IntoLinkKey()
+	linkSlug := shortURL.linkSlug
+	if shortURL.linkAlias != nil {
+		keyDto, isClaimed, findErr := linkAliasStore.FindKey(ctx, shortURL.linkHost.IntoDto(), shortURL.linkAlias.IntoDto())
+		if findErr != nil {
+			return nil, false, fmt.Errorf("%w: failed to resolve alias: %v", errInfrastructure, findErr)
+		}
+		if !isClaimed {
+			return nil, false, nil
+		}
+
+		aliasedKey, keyErr := keyDto.IntoDomain()
+		if keyErr != nil {
+			return nil, false, fmt.Errorf("%w: failed to resolve alias: %v", errApplication, keyErr)
+		}
+
+		linkSlug, err = aliasedKey.IntoLinkSlug(linkKeyCodec)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: failed to resolve alias: %v", errApplication, err)
+		}
+	}
+
+	tokenKey, err := linkSlug.IntoLinkKey(linkKeyCodec)
 	if err != nil {
 		return nil, false, fmt.Errorf("%w: failed to validate request: %v", errValidation, err)
 	}
 
-	dto, isFound, err := linksStore.FindOneNonBrandedLink(
-		ctx,
-		shortURL.linkSlug.IntoDto(),
-		tokenKey.IntoDto(),
-		shortURL.linkHost.IntoDto(),
-	)
+	// Keys are global, a slug belongs to the one host it was issued on and does not exist on any other.
+	dto, isFound := pendingLinks.FindOne(tokenKey.IntoDto())
+	if isFound && dto.Host.Hostname != shortURL.linkHost.Hostname() {
+		return nil, false, nil
+	}
+	if !isFound {
+		dto, isFound, err = linksStore.FindOneLink(
+			ctx,
+			linkSlug.IntoDto(),
+			tokenKey.IntoDto(),
+			shortURL.linkHost.IntoDto(),
+		)
 
-	if err != nil {
-		return nil, false, fmt.Errorf("%w: failed to resolve link: %v", errInfrastructure, err)
+		if err != nil {
+			return nil, false, fmt.Errorf("%w: failed to resolve link: %v", errInfrastructure, err)
+		}
 	}
 
 	if !isFound {
@@ -85,5 +262,5 @@ func resolveLink(
 	//	return nil, false, fmt.Errorf("%w: failed to build token %v", errApplication, err)
 	//}
 
-	return &linkWasResolvedEvent{*link}, true, nil
+	return &linkWasResolvedEvent{NonBrandedLink: *link}, true, nil
 }
@@ -0,0 +1,93 @@
+package resolveLink
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beard-programmer/shortorg/internal/core"
+)
+
+const (
+	defaultUnlockTTL     = 15 * time.Minute
+	unlockSecretSize     = 32
+	minUnlockSecretSize  = 16
+	unlockTokenSeparator = "."
+)
+
+// UnlockTokenSigner signs proof that the password of a link was given, so it is not asked again until the proof
+// expires. Tokens are bound to the link's key and carry their expiry.
+type UnlockTokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewUnlockTokenSigner uses a random secret when none is configured, tokens then do not survive a restart
+// and are only accepted by the instance that issued them.
+func NewUnlockTokenSigner(cfg Config) (*UnlockTokenSigner, error) {
+	secret := []byte(cfg.UnlockCookieSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, unlockSecretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("NewUnlockTokenSigner: failed to generate secret: %w", err)
+		}
+	}
+	if len(secret) < minUnlockSecretSize {
+		return nil, fmt.Errorf("NewUnlockTokenSigner: secret must be at least %d bytes", minUnlockSecretSize)
+	}
+
+	ttl := time.Duration(cfg.UnlockCookieTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultUnlockTTL
+	}
+
+	return &UnlockTokenSigner{secret: secret, ttl: ttl}, nil
+}
+
+func (s UnlockTokenSigner) Issue(key core.LinkKey, now time.Time) unlockToken {
+	expiresAt := now.Add(s.ttl).Truncate(time.Second)
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	return unlockToken{
+		Value:     expiry + unlockTokenSeparator + base64.RawURLEncoding.EncodeToString(s.sign(key, expiry)),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (s UnlockTokenSigner) IsValid(key core.LinkKey, token string, now time.Time) bool {
+	expiry, signature, isCut := strings.Cut(token, unlockTokenSeparator)
+	if !isCut {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || expiresAt <= now.Unix() {
+		return false
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(decoded, s.sign(key, expiry))
+}
+
+func (s UnlockTokenSigner) sign(key core.LinkKey, expiry string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strconv.FormatInt(key.Value(), 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expiry))
+
+	return mac.Sum(nil)
+}
+
+type unlockToken struct {
+	Value     string
+	ExpiresAt time.Time
+}
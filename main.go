@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"os"
 	"os/signal"
 	"syscall"
 
@@ -15,9 +16,19 @@ func main() {
 		panic(err)
 	}
 
+	if 1 < len(os.Args) {
+		err = app.RunCommand(context.Background(), logger, os.Args[1:])
+		if err != nil {
+			logger.Error("command error", "err", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	application, err := app.New(context.Background(), logger)
 	if err != nil {
-		logger.Error("application setup error", err)
+		logger.Error("application setup error", "err", err)
 		panic(err)
 	}
 
@@ -25,7 +36,7 @@ func main() {
 	defer cancel()
 	err = application.Serve(ctx)
 	if err != nil {
-		logger.ErrorContext(ctx, "application serve error", err)
+		logger.ErrorContext(ctx, "application serve error", "err", err)
 	}
 
 	logger.Warn("program exits")
@@ -0,0 +1,3 @@
+DROP TABLE key_leases;
+
+DROP TABLE key_lease_cursor;
@@ -0,0 +1,20 @@
+CREATE TABLE key_lease_cursor (
+    id       SMALLINT PRIMARY KEY CHECK (id = 1),
+    next_key BIGINT NOT NULL
+);
+
+INSERT INTO key_lease_cursor (id, next_key) VALUES (1, 0);
+
+CREATE TABLE key_leases (
+    id              BIGSERIAL PRIMARY KEY,
+    owner           VARCHAR(255) NOT NULL,
+    first_key       BIGINT       NOT NULL,
+    last_key        BIGINT       NOT NULL,
+    last_issued_key BIGINT       NULL,
+    claimed_at      TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    released_at     TIMESTAMP    NULL
+);
+
+CREATE INDEX key_leases_not_released_idx
+    ON key_leases (owner)
+    WHERE released_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE encoded_urls DROP COLUMN IF EXISTS redirect_status;
@@ -0,0 +1 @@
+ALTER TABLE encoded_urls ADD COLUMN redirect_status SMALLINT NULL;
@@ -0,0 +1 @@
+ALTER TABLE encoded_urls ALTER COLUMN url TYPE VARCHAR(255);
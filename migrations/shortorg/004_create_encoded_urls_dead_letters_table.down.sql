@@ -0,0 +1 @@
+DROP TABLE IF EXISTS encoded_urls_dead_letters;
@@ -0,0 +1,12 @@
+CREATE TABLE encoded_urls_dead_letters (
+    id               BIGSERIAL PRIMARY KEY,
+    token_identifier BIGINT    NOT NULL,
+    link             JSONB     NOT NULL,
+    reason           TEXT      NOT NULL,
+    created_at       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    replayed_at      TIMESTAMP NULL
+);
+
+CREATE INDEX encoded_urls_dead_letters_not_replayed_idx
+    ON encoded_urls_dead_letters (id)
+    WHERE replayed_at IS NULL;
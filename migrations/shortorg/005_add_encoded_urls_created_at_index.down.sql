@@ -0,0 +1 @@
+DROP INDEX IF EXISTS encoded_urls_created_at_idx;
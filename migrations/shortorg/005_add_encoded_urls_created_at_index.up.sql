@@ -0,0 +1 @@
+CREATE INDEX encoded_urls_created_at_idx ON encoded_urls (created_at);
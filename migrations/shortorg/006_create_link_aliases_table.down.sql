@@ -0,0 +1,3 @@
+ALTER TABLE encoded_urls DROP COLUMN alias;
+
+DROP TABLE link_aliases;
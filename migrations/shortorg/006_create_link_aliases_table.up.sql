@@ -0,0 +1,9 @@
+CREATE TABLE link_aliases (
+    host             VARCHAR(255) NOT NULL,
+    alias            VARCHAR(64)  NOT NULL,
+    token_identifier BIGINT       NOT NULL,
+    created_at       TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (host, alias)
+);
+
+ALTER TABLE encoded_urls ADD COLUMN alias VARCHAR(64) NULL;
@@ -0,0 +1 @@
+ALTER TABLE encoded_urls ALTER COLUMN token TYPE VARCHAR(7);
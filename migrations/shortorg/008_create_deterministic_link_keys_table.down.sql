@@ -0,0 +1 @@
+DROP TABLE deterministic_link_keys;
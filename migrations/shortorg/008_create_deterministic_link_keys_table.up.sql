@@ -0,0 +1,6 @@
+CREATE TABLE deterministic_link_keys (
+    token_identifier BIGINT PRIMARY KEY,
+    namespace        VARCHAR(64)   NOT NULL,
+    url              VARCHAR(2048) NOT NULL,
+    created_at       TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
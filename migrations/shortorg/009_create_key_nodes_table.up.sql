@@ -0,0 +1,7 @@
+CREATE TABLE key_nodes (
+    node_id             INTEGER PRIMARY KEY,
+    owner               VARCHAR(255) NOT NULL,
+    heartbeat_at        TIMESTAMPTZ  NOT NULL,
+    reserved_until_tick BIGINT       NOT NULL DEFAULT 0,
+    claimed_at          TIMESTAMPTZ  NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
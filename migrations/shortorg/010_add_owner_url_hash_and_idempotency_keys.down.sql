@@ -0,0 +1,5 @@
+DROP TABLE idempotency_keys;
+
+DROP INDEX encoded_urls_owner_url_hash_idx;
+ALTER TABLE encoded_urls DROP COLUMN url_hash;
+ALTER TABLE encoded_urls DROP COLUMN owner;
@@ -0,0 +1,16 @@
+ALTER TABLE encoded_urls ADD COLUMN owner VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE encoded_urls ADD COLUMN url_hash BYTEA NULL;
+
+CREATE INDEX encoded_urls_owner_url_hash_idx ON encoded_urls (owner, url_hash)
+    WHERE url_hash IS NOT NULL AND alias IS NULL;
+
+CREATE TABLE idempotency_keys (
+    owner               VARCHAR(64)  NOT NULL,
+    idempotency_key     VARCHAR(255) NOT NULL,
+    request_fingerprint BYTEA        NOT NULL,
+    link                JSONB        NULL,
+    created_at          TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (owner, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE deterministic_link_keys DROP COLUMN host;
+
+DROP INDEX encoded_urls_host_token_idx;
+ALTER TABLE encoded_urls ADD CONSTRAINT encoded_urls_token_key UNIQUE (token);
+ALTER TABLE encoded_urls DROP COLUMN host;
+
+DROP TABLE link_hosts;
@@ -0,0 +1,11 @@
+CREATE TABLE link_hosts (
+    hostname   VARCHAR(255) PRIMARY KEY,
+    owner      VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE encoded_urls ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'shortl.org';
+ALTER TABLE encoded_urls DROP CONSTRAINT encoded_urls_token_key;
+CREATE UNIQUE INDEX encoded_urls_host_token_idx ON encoded_urls (host, token);
+
+ALTER TABLE deterministic_link_keys ADD COLUMN host VARCHAR(255) NOT NULL DEFAULT 'shortl.org';
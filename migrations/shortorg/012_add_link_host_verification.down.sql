@@ -0,0 +1,7 @@
+ALTER TABLE link_hosts DROP COLUMN last_error;
+ALTER TABLE link_hosts DROP COLUMN failed_checks;
+ALTER TABLE link_hosts DROP COLUMN checked_at;
+ALTER TABLE link_hosts DROP COLUMN verified_at;
+ALTER TABLE link_hosts DROP COLUMN verification_method;
+ALTER TABLE link_hosts DROP COLUMN challenge_token;
+ALTER TABLE link_hosts DROP COLUMN status;
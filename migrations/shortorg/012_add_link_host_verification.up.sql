@@ -0,0 +1,11 @@
+ALTER TABLE link_hosts ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'pending';
+ALTER TABLE link_hosts ADD COLUMN challenge_token VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE link_hosts ADD COLUMN verification_method VARCHAR(8) NOT NULL DEFAULT '';
+ALTER TABLE link_hosts ADD COLUMN verified_at TIMESTAMP NULL;
+ALTER TABLE link_hosts ADD COLUMN checked_at TIMESTAMP NULL;
+ALTER TABLE link_hosts ADD COLUMN failed_checks INT NOT NULL DEFAULT 0;
+ALTER TABLE link_hosts ADD COLUMN last_error VARCHAR(512) NOT NULL DEFAULT '';
+
+-- Hosts registered before verification existed keep working until their first re-verification fails.
+UPDATE link_hosts
+SET status = 'verified', verified_at = CURRENT_TIMESTAMP, challenge_token = md5(random()::text || hostname);
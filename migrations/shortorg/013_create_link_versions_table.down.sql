@@ -0,0 +1,3 @@
+DROP TABLE link_versions;
+
+ALTER TABLE encoded_urls DROP COLUMN version;
@@ -0,0 +1,11 @@
+ALTER TABLE encoded_urls ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE link_versions (
+    token_identifier BIGINT        NOT NULL,
+    version          INT           NOT NULL,
+    url              VARCHAR(2048) NOT NULL,
+    author           VARCHAR(64)   NOT NULL DEFAULT '',
+    restored_from    INT           NULL,
+    created_at       TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (token_identifier, version)
+);
@@ -0,0 +1,7 @@
+DROP TABLE link_clicks;
+
+DROP INDEX encoded_urls_expiring_idx;
+ALTER TABLE encoded_urls DROP COLUMN expired_at;
+ALTER TABLE encoded_urls DROP COLUMN max_clicks;
+ALTER TABLE encoded_urls DROP COLUMN expires_at;
+ALTER TABLE encoded_urls DROP COLUMN not_before;
@@ -0,0 +1,13 @@
+ALTER TABLE encoded_urls ADD COLUMN not_before TIMESTAMPTZ NULL;
+ALTER TABLE encoded_urls ADD COLUMN expires_at TIMESTAMPTZ NULL;
+ALTER TABLE encoded_urls ADD COLUMN max_clicks BIGINT NULL;
+ALTER TABLE encoded_urls ADD COLUMN expired_at TIMESTAMPTZ NULL;
+
+-- Only links that may still expire are looked at by the sweeper.
+CREATE INDEX encoded_urls_expiring_idx ON encoded_urls (expires_at)
+    WHERE expired_at IS NULL AND (expires_at IS NOT NULL OR max_clicks IS NOT NULL);
+
+CREATE TABLE link_clicks (
+    token_identifier BIGINT PRIMARY KEY,
+    clicks           BIGINT NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE encoded_urls DROP COLUMN password_hash;
@@ -0,0 +1 @@
+ALTER TABLE encoded_urls ADD COLUMN password_hash BYTEA NULL;
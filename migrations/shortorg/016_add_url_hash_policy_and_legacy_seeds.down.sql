@@ -0,0 +1,4 @@
+DROP INDEX deterministic_link_keys_legacy_seed_idx;
+ALTER TABLE deterministic_link_keys DROP COLUMN is_legacy_seed;
+
+ALTER TABLE encoded_urls DROP COLUMN url_hash_policy;
@@ -0,0 +1,7 @@
+ALTER TABLE encoded_urls ADD COLUMN url_hash_policy VARCHAR(255) NULL;
+
+ALTER TABLE deterministic_link_keys ADD COLUMN is_legacy_seed BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE deterministic_link_keys ALTER COLUMN is_legacy_seed SET DEFAULT false;
+
+CREATE INDEX deterministic_link_keys_legacy_seed_idx ON deterministic_link_keys (host, namespace, url)
+    WHERE is_legacy_seed;
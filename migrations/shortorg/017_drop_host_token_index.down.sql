@@ -0,0 +1,2 @@
+ALTER TABLE encoded_urls DROP CONSTRAINT encoded_urls_token_key;
+CREATE UNIQUE INDEX encoded_urls_host_token_idx ON encoded_urls (host, token);
@@ -0,0 +1,2 @@
+DROP INDEX encoded_urls_host_token_idx;
+ALTER TABLE encoded_urls ADD CONSTRAINT encoded_urls_token_key UNIQUE (token);
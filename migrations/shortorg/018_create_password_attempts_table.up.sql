@@ -0,0 +1,7 @@
+CREATE TABLE password_attempts (
+    attempts_key VARCHAR(128) PRIMARY KEY,
+    attempts     INT          NOT NULL,
+    reset_at     TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX password_attempts_reset_at_idx ON password_attempts (reset_at);
@@ -0,0 +1,2 @@
+-- The deleted idempotency keys can not be restored, their requests are simply not deduplicated anymore.
+SELECT 1;
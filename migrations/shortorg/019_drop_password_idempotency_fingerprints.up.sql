@@ -0,0 +1,2 @@
+-- Fingerprints of requests with a password used to include an unsalted digest of it.
+DELETE FROM idempotency_keys WHERE COALESCE(link ->> 'PasswordHash', '') <> '';
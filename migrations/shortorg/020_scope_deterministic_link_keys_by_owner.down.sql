@@ -0,0 +1,7 @@
+DROP INDEX deterministic_link_keys_unscoped_seed_idx;
+CREATE INDEX deterministic_link_keys_legacy_seed_idx ON deterministic_link_keys (host, namespace, url)
+    WHERE is_legacy_seed;
+
+ALTER TABLE deterministic_link_keys DROP COLUMN is_unscoped_seed;
+ALTER TABLE deterministic_link_keys DROP COLUMN redirect_status;
+ALTER TABLE deterministic_link_keys DROP COLUMN owner;
@@ -0,0 +1,15 @@
+ALTER TABLE deterministic_link_keys ADD COLUMN owner VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE deterministic_link_keys ADD COLUMN redirect_status SMALLINT NULL;
+
+-- Claims made so far were derived without owner and redirect status, they take them from their stored link.
+ALTER TABLE deterministic_link_keys ADD COLUMN is_unscoped_seed BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE deterministic_link_keys ALTER COLUMN is_unscoped_seed SET DEFAULT false;
+
+UPDATE deterministic_link_keys AS d
+SET owner = e.owner, redirect_status = e.redirect_status
+FROM encoded_urls AS e
+WHERE e.token_identifier = d.token_identifier;
+
+DROP INDEX deterministic_link_keys_legacy_seed_idx;
+CREATE INDEX deterministic_link_keys_unscoped_seed_idx ON deterministic_link_keys (host, namespace, url)
+    WHERE is_unscoped_seed;